@@ -2,7 +2,7 @@ package autoencoding
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
 	"reflect"
 	"unicode"
 
@@ -57,12 +57,12 @@ func newItem(val interface{}) (gkvstore.Item, error) {
 
 	rv := reflect.ValueOf(val)
 	if rv.Kind() != reflect.Ptr && rv.Kind() != reflect.Interface {
-		return nil, errors.New("incorrect value type: use pointer")
+		return nil, fmt.Errorf("%w: incorrect value type: use pointer", gkvstore.ErrInvalidItem)
 	}
 	t := rv.Elem().Type()
 
 	if t.Name() == "" {
-		return nil, errors.New("incorrect name of type")
+		return nil, fmt.Errorf("%w: incorrect name of type", gkvstore.ErrInvalidItem)
 	}
 	ns = t.Name()
 
@@ -75,7 +75,7 @@ func newItem(val interface{}) (gkvstore.Item, error) {
 		}
 	}
 	if encoding == 0 {
-		return nil, errors.New("no exported field")
+		return nil, fmt.Errorf("%w: no exported field", gkvstore.ErrInvalidItem)
 	}
 
 	for i := 0; i < t.NumField(); i++ {
@@ -83,30 +83,30 @@ func newItem(val interface{}) (gkvstore.Item, error) {
 		tagval, ok := field.Tag.Lookup("aenc")
 		if (field.Name == "ID" || field.Name == "Id") || (ok && tagval == "id") {
 			if foundId {
-				return nil, errors.New("duplicate ID field configured")
+				return nil, fmt.Errorf("%w: duplicate ID field configured", gkvstore.ErrInvalidItem)
 			}
 			if field.Type.Kind() != reflect.String {
-				return nil, errors.New("ID field should be string")
+				return nil, fmt.Errorf("%w: ID field should be string", gkvstore.ErrInvalidItem)
 			}
 			foundId = true
 			id = field.Name
 		}
 		if (field.Name == "Created" || field.Name == "CreatedAt") || (ok && tagval == "created") {
 			if foundCreated {
-				return nil, errors.New("duplicate Created field configured")
+				return nil, fmt.Errorf("%w: duplicate Created field configured", gkvstore.ErrInvalidItem)
 			}
 			if field.Type.Kind() != reflect.Int64 {
-				return nil, errors.New("Created field should be uint64")
+				return nil, fmt.Errorf("%w: Created field should be uint64", gkvstore.ErrInvalidItem)
 			}
 			foundCreated = true
 			created = field.Name
 		}
 		if (field.Name == "Updated" || field.Name == "UpdatedAt") || (ok && tagval == "updated") {
 			if foundUpdated {
-				return nil, errors.New("duplicate Updated field configured")
+				return nil, fmt.Errorf("%w: duplicate Updated field configured", gkvstore.ErrInvalidItem)
 			}
 			if field.Type.Kind() != reflect.Int64 {
-				return nil, errors.New("Updated field should be uint64")
+				return nil, fmt.Errorf("%w: Updated field should be uint64", gkvstore.ErrInvalidItem)
 			}
 			foundUpdated = true
 			updated = field.Name
@@ -114,7 +114,7 @@ func newItem(val interface{}) (gkvstore.Item, error) {
 	}
 
 	if !foundId {
-		return nil, errors.New("ID field not configured")
+		return nil, fmt.Errorf("%w: ID field not configured", gkvstore.ErrInvalidItem)
 	}
 
 	if foundCreated && foundUpdated {
@@ -182,7 +182,7 @@ func (i *item) Marshal() ([]byte, error) {
 	case Protobuf:
 		return proto.Marshal(i.val.(proto.Message))
 	}
-	return nil, errors.New("invalid encoding")
+	return nil, fmt.Errorf("%w: invalid encoding", gkvstore.ErrInvalidItem)
 }
 
 func (i *item) Unmarshal(buf []byte) error {
@@ -194,7 +194,7 @@ func (i *item) Unmarshal(buf []byte) error {
 	case Protobuf:
 		return proto.Unmarshal(buf, i.val.(proto.Message))
 	}
-	return errors.New("invalid encoding")
+	return fmt.Errorf("%w: invalid encoding", gkvstore.ErrInvalidItem)
 }
 
 func (i *itemWithTimeTracker) GetCreated() int64 {
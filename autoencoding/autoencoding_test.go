@@ -1,6 +1,7 @@
 package autoencoding_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -217,3 +218,101 @@ func TestEncoding(t *testing.T) {
 
 	})
 }
+
+func TestPatch(t *testing.T) {
+	t.Run("JSON", func(st *testing.T) {
+		type jsonItem struct {
+			ID      string            `json:"id"`
+			Val1    int               `json:"val1"`
+			Val2    string            `json:"val2"`
+			Created int64             `json:"created"`
+			Updated int64             `json:"updated"`
+			Labels  map[string]string `json:"labels,omitempty"`
+		}
+		ts := time.Now().UnixNano()
+		t1 := &jsonItem{ID: "1", Val1: 100, Val2: "test1", Created: ts, Labels: map[string]string{"a": "1"}}
+		ae1 := autoencoding.MustNew(t1)
+
+		err := ae1.(gkvstore.Patchable).ApplyPatch(gkvstore.Patch{
+			Merge: []byte(`{"val2":"patched","labels":{"a":null,"b":"2"}}`),
+		})
+		if err != nil {
+			st.Fatal(err)
+		}
+		if t1.ID != "1" || t1.Val1 != 100 || t1.Val2 != "patched" || t1.Created != ts ||
+			len(t1.Labels) != 1 || t1.Labels["b"] != "2" {
+			st.Fatalf("incorrect value after merge patch %v", t1)
+		}
+
+		err = ae1.(gkvstore.Patchable).ApplyPatch(gkvstore.Patch{
+			Fields: []string{"val1", "labels"},
+			Source: autoencoding.MustNew(&jsonItem{Val1: 200, Val2: "ignored"}),
+		})
+		if err != nil {
+			st.Fatal(err)
+		}
+		if t1.Val1 != 200 || t1.Val2 != "patched" || t1.Labels != nil {
+			st.Fatalf("incorrect value after field mask patch %v", t1)
+		}
+	})
+	t.Run("MsgPack", func(st *testing.T) {
+		type msgpackItem struct {
+			ID   string  `msgpack:"id"`
+			Val1 int     `msgpack:"val1"`
+			Val2 string  `msgpack:"val2"`
+			Val3 float64 `msgpack:"val3"`
+		}
+		t1 := &msgpackItem{ID: "1", Val1: 100, Val2: "test1", Val3: 1.5}
+		ae1 := autoencoding.MustNew(t1)
+
+		err := ae1.(gkvstore.Patchable).ApplyPatch(gkvstore.Patch{
+			Merge: []byte(`{"val1":150,"val3":2,"val2":null}`),
+		})
+		if err != nil {
+			st.Fatal(err)
+		}
+		if t1.ID != "1" || t1.Val1 != 150 || t1.Val2 != "" || t1.Val3 != 2 {
+			st.Fatalf("incorrect value after merge patch %v", t1)
+		}
+	})
+	t.Run("Protobuf", func(st *testing.T) {
+		ae1 := autoencoding.MustNew(&pbtest.TestItem{Id: "1"})
+		err := ae1.(gkvstore.Patchable).ApplyPatch(gkvstore.Patch{Merge: []byte(`{}`)})
+		if !errors.Is(err, gkvstore.ErrNotSupported) {
+			st.Fatal("expected not supported error for protobuf")
+		}
+	})
+	t.Run("incorrect source", func(st *testing.T) {
+		type struct1 struct {
+			ID  string
+			Val string
+		}
+		type struct2 struct {
+			ID  string
+			Val string
+		}
+		ae1 := autoencoding.MustNew(&struct1{ID: "1"})
+		err := ae1.(gkvstore.Patchable).ApplyPatch(gkvstore.Patch{
+			Fields: []string{"Val"},
+			Source: autoencoding.MustNew(&struct2{Val: "val"}),
+		})
+		if err == nil {
+			st.Fatal("expected error for incorrect source type")
+		}
+	})
+}
+
+func TestErrors(t *testing.T) {
+	type struct1 struct {
+		Namespace string
+		Val       string
+	}
+	_, err := autoencoding.New(&struct1{})
+	if !errors.Is(err, gkvstore.ErrInvalidItem) {
+		t.Fatal("expected invalid item error for no id", err)
+	}
+	_, err = autoencoding.New(struct1{})
+	if !errors.Is(err, gkvstore.ErrInvalidItem) {
+		t.Fatal("expected invalid item error for non pointer", err)
+	}
+}
@@ -0,0 +1,114 @@
+package autoencoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ApplyPatch applies the patch on the wrapped value. Patches are applied on the
+// encoded document, so field names are the ones used by the encoding. Protobuf
+// encoding is not supported
+func (i *item) ApplyPatch(p gkvstore.Patch) error {
+	if i.encoding != JSON && i.encoding != MsgPack {
+		return gkvstore.ErrNotSupported
+	}
+
+	doc, err := i.document(i.val)
+	if err != nil {
+		return err
+	}
+
+	if len(p.Fields) > 0 {
+		og, ok := p.Source.(ObjectGetter)
+		if !ok || reflect.TypeOf(og.Get()) != reflect.TypeOf(i.val) {
+			return fmt.Errorf("%w: incorrect source type for field mask", gkvstore.ErrInvalidItem)
+		}
+		src, err := i.document(og.Get())
+		if err != nil {
+			return err
+		}
+		doc = gkvstore.ApplyFieldMask(doc, src, p.Fields)
+	}
+
+	if len(p.Merge) > 0 {
+		var patch interface{}
+		dec := json.NewDecoder(bytes.NewReader(p.Merge))
+		dec.UseNumber()
+		if err := dec.Decode(&patch); err != nil {
+			return err
+		}
+		if i.encoding == MsgPack {
+			patch = fromJSON(patch)
+		}
+		doc = gkvstore.MergePatch(doc, patch)
+	}
+
+	var buf []byte
+	switch i.encoding {
+	case JSON:
+		buf, err = json.Marshal(doc)
+	case MsgPack:
+		buf, err = msgpack.Marshal(doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Fields removed by the patch should be reset
+	v := reflect.ValueOf(i.val).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return i.Unmarshal(buf)
+}
+
+// document returns the generic representation of the value in the encoding
+func (i *item) document(val interface{}) (interface{}, error) {
+	var doc interface{}
+	switch i.encoding {
+	case JSON:
+		buf, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	case MsgPack:
+		buf, err := msgpack.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		if err := msgpack.Unmarshal(buf, &doc); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// fromJSON converts the JSON numbers in the patch so they are encoded as
+// numbers by msgpack
+func fromJSON(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = fromJSON(e)
+		}
+	case []interface{}:
+		for idx, e := range v {
+			v[idx] = fromJSON(e)
+		}
+	}
+	return val
+}
@@ -0,0 +1,98 @@
+package autoencoding
+
+import (
+	"context"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// TypedResult is the result of a List operation on TypedStore
+type TypedResult[T any] struct {
+	Val    *T
+	Err    error
+	Cursor string
+}
+
+// TypedStore uses the autoencoding items for values of type T, so the callers
+// don't have to wrap the values or type assert the results
+type TypedStore[T any] struct {
+	st gkvstore.Store
+}
+
+// NewTypedStore returns a TypedStore for T on the store. T should be a struct
+// which can be used with New
+func NewTypedStore[T any](st gkvstore.Store) (*TypedStore[T], error) {
+	if _, err := newItem(new(T)); err != nil {
+		return nil, err
+	}
+	return &TypedStore[T]{st: st}, nil
+}
+
+func (t *TypedStore[T]) item(val *T) gkvstore.Item {
+	// Type is validated on creating the store
+	return MustNew(val)
+}
+
+func (t *TypedStore[T]) factory() gkvstore.Item {
+	return t.item(new(T))
+}
+
+// Store returns the underlying store, which can be used with the optional
+// interfaces
+func (t *TypedStore[T]) Store() gkvstore.Store {
+	return t.st
+}
+
+// Create stores the value. The ID field is set if it is empty
+func (t *TypedStore[T]) Create(ctx context.Context, val *T) error {
+	return t.st.Create(ctx, t.item(val))
+}
+
+// Read returns the value with the ID
+func (t *TypedStore[T]) Read(ctx context.Context, id string) (*T, error) {
+	val := new(T)
+	it := t.item(val)
+	it.(gkvstore.IDSetter).SetID(id)
+	if err := t.st.Read(ctx, it); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// Update replaces the stored value with the same ID
+func (t *TypedStore[T]) Update(ctx context.Context, val *T) error {
+	return t.st.Update(ctx, t.item(val))
+}
+
+// Delete removes the value with the ID
+func (t *TypedStore[T]) Delete(ctx context.Context, id string) error {
+	it := t.item(new(T))
+	it.(gkvstore.IDSetter).SetID(id)
+	return t.st.Delete(ctx, it)
+}
+
+// List returns the values matching the options
+func (t *TypedStore[T]) List(ctx context.Context, opts gkvstore.ListOpt) (<-chan *TypedResult[T], error) {
+	res, err := t.st.List(ctx, t.factory, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make(chan *TypedResult[T])
+	go func() {
+		defer close(typed)
+
+		for r := range res {
+			tr := &TypedResult[T]{Err: r.Err, Cursor: r.Cursor}
+			if r.Val != nil {
+				tr.Val = r.Val.(ObjectGetter).Get().(*T)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case typed <- tr:
+			}
+		}
+	}()
+	return typed, nil
+}
@@ -0,0 +1,80 @@
+package autoencoding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/inmem"
+)
+
+type account struct {
+	ID      string `json:"id"`
+	Owner   string `json:"owner"`
+	Balance int64  `json:"balance"`
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"`
+}
+
+func TestTypedStore(t *testing.T) {
+	t.Run("invalid type", func(st *testing.T) {
+		_, err := autoencoding.NewTypedStore[struct{ Val string }](inmem.New())
+		if !errors.Is(err, gkvstore.ErrInvalidItem) {
+			st.Fatal("expected invalid item error", err)
+		}
+	})
+
+	ts, err := autoencoding.NewTypedStore[account](inmem.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Store().Close()
+
+	for _, owner := range []string{"alice", "bob", "carol"} {
+		err := ts.Create(context.TODO(), &account{ID: owner, Owner: owner, Balance: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	acc, err := ts.Read(context.TODO(), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Owner != "bob" || acc.Balance != 100 || acc.Created == 0 {
+		t.Fatal("incorrect value read", acc)
+	}
+
+	acc.Balance = 50
+	err = ts.Update(context.TODO(), acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ts.Delete(context.TODO(), "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ts.Read(context.TODO(), "carol")
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error after delete", err)
+	}
+
+	res, err := ts.List(context.TODO(), gkvstore.ListOpt{Sort: gkvstore.SortUpdatedDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := []*account{}
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		accounts = append(accounts, r.Val)
+	}
+	if len(accounts) != 2 || accounts[0].Owner != "bob" || accounts[0].Balance != 50 ||
+		accounts[1].Owner != "alice" {
+		t.Fatal("incorrect list results", accounts)
+	}
+}
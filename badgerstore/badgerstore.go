@@ -0,0 +1,385 @@
+// Package badgerstore provides a store on Badger. Badger can run on a
+// directory or fully in memory, which is configured using the badger.Options
+// passed to New.
+//
+// Items are stored with keys of the form /namespace NUL id and the created and
+// updated timestamps and the secondary indexes are maintained as separate
+// keys written in the same Badger transaction as the item. Transactions of
+// the store are Badger transactions, so conflicting writes are detected on
+// Commit. Expiry of the items is set as the TTL of the keys, so Badger
+// removes them and no reaper is required. Namespaces cannot contain the NUL
+// character.
+package badgerstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+)
+
+const (
+	// seqBandwidth is the no of IDs leased at once from the sequence. Unused
+	// IDs of the lease are skipped if the store is not closed
+	seqBandwidth = 100
+
+	// maxRetries is the no of times an operation is retried if it conflicts
+	// with a concurrent transaction
+	maxRetries = 10
+)
+
+// expiresAt is the TTL of the keys of the item. Badger uses seconds, so it
+// is rounded up and the expiry is checked again on reads
+func expiresAt(m *kv.Meta) uint64 {
+	if m.Expiry == 0 {
+		return 0
+	}
+	return uint64((m.Expiry + int64(time.Second) - 1) / int64(time.Second))
+}
+
+type badgerStore struct {
+	// mu is held for reading by the operations, so the database is not
+	// closed while they are using it
+	mu     sync.RWMutex
+	db     *badger.DB
+	seq    *badger.Sequence
+	closed bool
+}
+
+// New opens the database with the options. Use
+// badger.DefaultOptions("").WithInMemory(true) for an in-memory store. The
+// store is not usable after Close
+func New(opts badger.Options) (gkvstore.Store, error) {
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("badgerstore: failed opening: %w", err)
+	}
+	seq, err := db.GetSequence(kv.NonceKey, seqBandwidth)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("badgerstore: failed reading sequence: %w", err)
+	}
+	return &badgerStore{db: db, seq: seq}, nil
+}
+
+// lookup returns the record of the item. Items which are expired but not yet
+// removed by Badger are returned as well
+func lookup(txn *badger.Txn, ns, id string) (*kv.Meta, []byte, bool, error) {
+	it, err := txn.Get(kv.DataKey(ns, id))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	buf, err := it.ValueCopy(nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	m, item, err := kv.DecodeRecord(buf)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// live returns the record if the item exists and is not expired
+func live(txn *badger.Txn, ns, id string) (*kv.Meta, []byte, bool, error) {
+	m, item, exists, err := lookup(txn, ns, id)
+	if err != nil || !exists || m.Expired(time.Now().UnixNano()) {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// indexKeys returns the index keys of the item. The values are the header
+// followed by the ID, so the listing can skip the entries without reading
+// the item
+func indexKeys(ns, id string, m *kv.Meta) map[string][]byte {
+	val := append(m.Header().Append(nil), id...)
+	keys := make(map[string][]byte)
+	if m.TimeTrack {
+		keys[string(kv.TimeKey(kv.CreatedPrefix, ns, m.Created, id))] = val
+		keys[string(kv.TimeKey(kv.UpdatedPrefix, ns, m.Updated, id))] = val
+	}
+	for name, v := range m.Indexes {
+		keys[string(kv.ValueKey(ns, name, v, id))] = val
+	}
+	return keys
+}
+
+// write stores the item and its index keys in the transaction with the TTL
+// of the item. All the index keys are written again as the version in their
+// values changes
+func write(txn *badger.Txn, ns, id string, old, m *kv.Meta, item []byte) error {
+	newKeys := indexKeys(ns, id, m)
+	if old != nil {
+		for k := range indexKeys(ns, id, old) {
+			if _, found := newKeys[k]; found {
+				continue
+			}
+			if err := txn.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+	}
+	expiresAt := expiresAt(m)
+	for k, v := range newKeys {
+		e := badger.NewEntry([]byte(k), v)
+		e.ExpiresAt = expiresAt
+		if err := txn.SetEntry(e); err != nil {
+			return err
+		}
+	}
+	rec, err := kv.EncodeRecord(m, item)
+	if err != nil {
+		return err
+	}
+	e := badger.NewEntry(kv.DataKey(ns, id), rec)
+	e.ExpiresAt = expiresAt
+	return txn.SetEntry(e)
+}
+
+// remove deletes the item and its index keys in the transaction
+func remove(txn *badger.Txn, ns, id string, m *kv.Meta) error {
+	for k := range indexKeys(ns, id, m) {
+		if err := txn.Delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+	return txn.Delete(kv.DataKey(ns, id))
+}
+
+// create, read, update and remove are the operations on a Badger transaction
+// used by the store and its transactions
+
+func (b *badgerStore) create(txn *badger.Txn, item gkvstore.Item) error {
+	if ids, ok := item.(gkvstore.IDSetter); ok {
+		n, err := b.seq.Next()
+		if err != nil {
+			return err
+		}
+		// Sequence starts from 0 while the other stores start from 1
+		ids.SetID(fmt.Sprintf("%d", n+1))
+	}
+	if err := kv.Validate(item); err != nil {
+		return err
+	}
+
+	ns, id := item.GetNamespace(), item.GetID()
+	old, _, exists, err := lookup(txn, ns, id)
+	if err != nil {
+		return err
+	}
+	if exists && !old.Expired(time.Now().UnixNano()) {
+		return gkvstore.ErrRecordAlreadyExists
+	}
+
+	m := &kv.Meta{
+		Version: 1,
+		Expiry:  gkvstore.ItemExpiry(item),
+		Indexes: gkvstore.ItemIndexes(item),
+	}
+
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		tt.SetCreated(timestamp)
+		tt.SetUpdated(timestamp)
+		m.TimeTrack = true
+		m.Created = timestamp
+		m.Updated = timestamp
+	}
+
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(1)
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return err
+	}
+	// Expired item which is not yet removed is replaced
+	return write(txn, ns, id, old, m, itemBuf)
+}
+
+func (b *badgerStore) read(txn *badger.Txn, item gkvstore.Item) error {
+	_, buf, exists, err := live(txn, item.GetNamespace(), item.GetID())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return gkvstore.ErrRecordNotFound
+	}
+	return item.Unmarshal(buf)
+}
+
+func (b *badgerStore) update(txn *badger.Txn, item gkvstore.Item) error {
+	if err := kv.Validate(item); err != nil {
+		return err
+	}
+
+	ns, id := item.GetNamespace(), item.GetID()
+	old, _, exists, err := lookup(txn, ns, id)
+	if err != nil {
+		return err
+	}
+	prev := old
+	if exists && old.Expired(time.Now().UnixNano()) {
+		exists = false
+	}
+
+	var version int64
+	if exists {
+		version = old.Version
+	}
+	v, versioned := item.(gkvstore.Versioned)
+	if versioned && v.GetVersion() != version {
+		return gkvstore.ErrVersionConflict
+	}
+
+	m := &kv.Meta{
+		Version: version + 1,
+		Expiry:  gkvstore.ItemExpiry(item),
+		Indexes: gkvstore.ItemIndexes(item),
+	}
+
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		if exists && old.TimeTrack {
+			tt.SetCreated(old.Created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
+		tt.SetUpdated(timestamp)
+		m.TimeTrack = true
+		m.Created = tt.GetCreated()
+		m.Updated = timestamp
+	}
+
+	if versioned {
+		v.SetVersion(version + 1)
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return err
+	}
+	return write(txn, ns, id, prev, m, itemBuf)
+}
+
+func (b *badgerStore) delete(txn *badger.Txn, item gkvstore.Item) error {
+	ns, id := item.GetNamespace(), item.GetID()
+	m, _, exists, err := lookup(txn, ns, id)
+	if err != nil || !exists {
+		return err
+	}
+	return remove(txn, ns, id, m)
+}
+
+// itemState is the part of the item changed by update
+type itemState struct {
+	version          int64
+	created, updated int64
+}
+
+func saveState(item gkvstore.Item) itemState {
+	var st itemState
+	if v, ok := item.(gkvstore.Versioned); ok {
+		st.version = v.GetVersion()
+	}
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		st.created, st.updated = tt.GetCreated(), tt.GetUpdated()
+	}
+	return st
+}
+
+func (st itemState) restore(item gkvstore.Item) {
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(st.version)
+	}
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		tt.SetCreated(st.created)
+		tt.SetUpdated(st.updated)
+	}
+}
+
+// run executes the function in a read-write transaction. Conflicts with the
+// concurrent transactions are retried as the checks are done again
+func (b *badgerStore) run(fn func(*badger.Txn) error) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return gkvstore.ErrStoreClosed
+	}
+
+	var err error
+	for i := 0; i < maxRetries; i++ {
+		err = b.db.Update(fn)
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+	return gkvstore.ErrVersionConflict
+}
+
+func (b *badgerStore) Create(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Create", item, b.run(func(txn *badger.Txn) error {
+		return b.create(txn, item)
+	}))
+}
+
+func (b *badgerStore) Read(ctx context.Context, item gkvstore.Item) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrStoreClosed)
+	}
+
+	return gkvstore.WrapError("Read", item, b.db.View(func(txn *badger.Txn) error {
+		return b.read(txn, item)
+	}))
+}
+
+// Update restores the version and the timestamps of the item before each
+// attempt. Otherwise a retry would check the version set by the conflicting
+// attempt, which can match the version written by the concurrent update
+func (b *badgerStore) Update(ctx context.Context, item gkvstore.Item) error {
+	state := saveState(item)
+	err := b.run(func(txn *badger.Txn) error {
+		state.restore(item)
+		return b.update(txn, item)
+	})
+	if err != nil {
+		state.restore(item)
+	}
+	return gkvstore.WrapError("Update", item, err)
+}
+
+func (b *badgerStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Delete", item, b.run(func(txn *badger.Txn) error {
+		return b.delete(txn, item)
+	}))
+}
+
+// Close releases the unused IDs of the sequence and closes the database
+func (b *badgerStore) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if err := b.seq.Release(); err != nil {
+		b.db.Close()
+		return err
+	}
+	return b.db.Close()
+}
@@ -0,0 +1,192 @@
+package badgerstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/badgerstore"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func newStore(tb testing.TB) gkvstore.Store {
+	tb.Helper()
+
+	st, err := badgerstore.New(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return st
+}
+
+func TestSuite(t *testing.T) {
+	testsuite.RunTestsuite(t, newStore(t), testsuite.Advanced)
+}
+
+func BenchmarkSuite(b *testing.B) {
+	st := newStore(b)
+	defer st.Close()
+
+	testsuite.BenchmarkSuite(b, st)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+type session struct {
+	Id     string
+	Expiry int64
+}
+
+func (s *session) GetNamespace() string { return "session" }
+
+func (s *session) GetID() string { return s.Id }
+
+func (s *session) Marshal() ([]byte, error) { return json.Marshal(s) }
+
+func (s *session) Unmarshal(buf []byte) error { return json.Unmarshal(buf, s) }
+
+func (s *session) GetExpiry() int64 { return s.Expiry }
+
+func TestTransactionConflict(t *testing.T) {
+	st := newStore(t)
+	defer st.Close()
+
+	doc := &document{Id: "1", Text: "created"}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := st.(gkvstore.Transactional).NewTransaction(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Discard(context.TODO())
+
+	rd := &document{Id: "1"}
+	if err := txn.Read(context.TODO(), autoencoding.MustNew(rd)); err != nil {
+		t.Fatal(err)
+	}
+	rd.Text = "updated in transaction"
+	if err := txn.Update(context.TODO(), autoencoding.MustNew(rd)); err != nil {
+		t.Fatal(err)
+	}
+
+	doc.Text = "updated"
+	if err := st.Update(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = txn.Commit(context.TODO())
+	if !errors.Is(err, gkvstore.ErrVersionConflict) {
+		t.Fatal("expected version conflict", err)
+	}
+
+	rd = &document{Id: "1"}
+	if err := st.Read(context.TODO(), autoencoding.MustNew(rd)); err != nil {
+		t.Fatal(err)
+	}
+	if rd.Text != "updated" || rd.Created == 0 || rd.Updated <= rd.Created {
+		t.Fatal("incorrect document", rd.Text)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	st := newStore(t)
+	defer st.Close()
+
+	err := st.Create(context.TODO(), &session{
+		Id:     "1",
+		Expiry: time.Now().Add(100 * time.Millisecond).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Create(context.TODO(), &session{Id: "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expiry is checked before the TTL of the keys in seconds is reached
+	time.Sleep(200 * time.Millisecond)
+	if err := st.Read(context.TODO(), &session{Id: "1"}); !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected expired session", err)
+	}
+
+	// Expired item can be created again
+	err = st.Create(context.TODO(), &session{
+		Id:     "1",
+		Expiry: time.Now().Add(time.Hour).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := gkvstore.Count(context.TODO(), st, func() gkvstore.Item { return &session{} }, gkvstore.ListOpt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatal("incorrect count", count)
+	}
+}
+
+// TestBatches lists more items than a single Badger transaction reads
+func TestBatches(t *testing.T) {
+	st := newStore(t)
+	defer st.Close()
+
+	count := 250
+	for i := 0; i < count; i++ {
+		doc := &document{Id: fmt.Sprintf("%03d", i)}
+		if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(opts gkvstore.ListOpt) ([]string, string) {
+		t.Helper()
+
+		res, err := st.List(context.TODO(), func() gkvstore.Item {
+			return autoencoding.MustNew(&document{})
+		}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			ids    []string
+			cursor string
+		)
+		for r := range res {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			ids = append(ids, r.Val.GetID())
+			cursor = r.Cursor
+		}
+		return ids, cursor
+	}
+
+	ids, _ := list(gkvstore.ListOpt{Sort: gkvstore.SortCreatedDesc})
+	if len(ids) != count || ids[0] != "249" || ids[count-1] != "000" {
+		t.Fatal("unexpected items", len(ids))
+	}
+
+	ids, cursor := list(gkvstore.ListOpt{Sort: gkvstore.SortIDDesc, Page: 1, Limit: 120})
+	if len(ids) != 120 || ids[0] != "129" || ids[119] != "010" {
+		t.Fatal("unexpected page", len(ids))
+	}
+	ids, _ = list(gkvstore.ListOpt{Sort: gkvstore.SortIDDesc, Limit: 120, Cursor: cursor})
+	if len(ids) != 10 || ids[0] != "009" {
+		t.Fatal("unexpected page after cursor", len(ids))
+	}
+}
@@ -0,0 +1,444 @@
+package badgerstore
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+)
+
+// batchSize is the no of entries read in a Badger transaction. The store
+// lock is not held while the results are consumed, the next batch is read
+// after the last key instead
+const batchSize = 100
+
+// iterator walks the keys with the prefix between start (inclusive) and end
+// (exclusive). Each batch is read in a new transaction starting after the
+// last position
+type iterator struct {
+	prefix []byte
+	start  []byte
+	end    []byte
+	desc   bool
+	pos    []byte
+	// items is set if the iteration is over the item keys, else the values
+	// are the IDs of the items
+	items bool
+	// values is set if the iteration is over the secondary index keys
+	values bool
+}
+
+// newIterator returns the iterator for the listing order of the options
+func newIterator(ns string, opts gkvstore.ListOpt) (*iterator, error) {
+	it := &iterator{}
+	switch {
+	// Natural order with index query is the order of the index values
+	case opts.Index.Name != "" && opts.Sort == gkvstore.SortNatural:
+		it.prefix, it.values = kv.ValuePrefix(ns, opts.Index.Name), true
+		if opts.Index.Value != "" {
+			it.start = append(kv.Concat(it.prefix, opts.Index.Value), 0)
+			it.end = gkvstore.PrefixEnd(it.start)
+			break
+		}
+		it.start = kv.Concat(it.prefix, opts.Index.Start)
+		if opts.Index.End != "" {
+			it.end = kv.Concat(it.prefix, opts.Index.End)
+		}
+	// Natural order is the order of the IDs
+	case opts.Sort == gkvstore.SortNatural || opts.Sort == gkvstore.SortIDAsc || opts.Sort == gkvstore.SortIDDesc:
+		it.prefix, it.items = kv.DataKey(ns, ""), true
+		start := opts.StartID
+		if opts.IDPrefix > start {
+			start = opts.IDPrefix
+		}
+		it.start = kv.Concat(it.prefix, start)
+		if opts.EndID != "" {
+			it.end = kv.Concat(it.prefix, opts.EndID)
+		}
+		if opts.IDPrefix != "" {
+			end := gkvstore.PrefixEnd(kv.Concat(it.prefix, opts.IDPrefix))
+			if it.end == nil || (end != nil && bytes.Compare(end, it.end) < 0) {
+				it.end = end
+			}
+		}
+		it.desc = opts.Sort == gkvstore.SortIDDesc
+	case opts.Sort == gkvstore.SortCreatedAsc || opts.Sort == gkvstore.SortCreatedDesc:
+		it.prefix = kv.TimePrefix(kv.CreatedPrefix, ns)
+		it.start = it.prefix
+		it.desc = opts.Sort == gkvstore.SortCreatedDesc
+	case opts.Sort == gkvstore.SortUpdatedAsc || opts.Sort == gkvstore.SortUpdatedDesc:
+		it.prefix = kv.TimePrefix(kv.UpdatedPrefix, ns)
+		it.start = it.prefix
+		it.desc = opts.Sort == gkvstore.SortUpdatedDesc
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+	if it.end == nil {
+		it.end = gkvstore.PrefixEnd(it.prefix)
+	}
+
+	if opts.Cursor != "" {
+		c, err := gkvstore.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		k := c.Key
+		if !bytes.HasPrefix(k, it.prefix) {
+			return nil, gkvstore.ErrInvalidCursor
+		}
+		it.pos = k
+	}
+	return it, nil
+}
+
+// entry is a key of the iteration which matches the list options
+type entry struct {
+	key  []byte
+	id   string
+	item []byte
+	err  error
+}
+
+// match checks the key and the header in its value against the options.
+// Index values are only read from the records if the iteration is not over
+// the secondary index keys. The item is returned if required
+func (it *iterator) match(
+	txn *badger.Txn,
+	ns string,
+	opts gkvstore.ListOpt,
+	k, val []byte,
+	withItem bool,
+) (entry, bool) {
+
+	e := entry{key: k}
+	h, rest, err := kv.DecodeHeader(val)
+	if err != nil {
+		e.err = err
+		return e, true
+	}
+	if it.items {
+		e.id = string(k[len(it.prefix):])
+		if withItem && opts.Index.Name == "" {
+			e.item, e.err = kv.RecordItem(rest)
+			if e.err != nil {
+				return e, true
+			}
+		}
+	} else {
+		e.id = string(rest)
+	}
+
+	if h.Expired(time.Now().UnixNano()) || h.Version < opts.Version || !opts.MatchID(e.id) {
+		return e, false
+	}
+	if it.values {
+		v := k[len(it.prefix):]
+		v = v[:bytes.IndexByte(v, 0)]
+		if !opts.Index.Match(string(v)) {
+			return e, false
+		}
+	}
+	// Index values have to be read from the record unless the iteration is
+	// over the secondary index keys
+	checkIndex := opts.Index.Name != "" && !it.values
+	if !checkIndex && (it.items || !withItem) {
+		return e, true
+	}
+
+	var (
+		m     *kv.Meta
+		item  []byte
+		found = true
+	)
+	if it.items {
+		m, item, err = kv.DecodeRecord(val)
+	} else {
+		m, item, found, err = lookup(txn, ns, e.id)
+	}
+	if err != nil {
+		e.err = err
+		return e, true
+	}
+	if !found {
+		return e, false
+	}
+	if checkIndex {
+		v, found := m.Indexes[opts.Index.Name]
+		if !found || !opts.Index.Match(v) {
+			return e, false
+		}
+	}
+	if withItem {
+		e.item = item
+	}
+	return e, true
+}
+
+// batch reads the next entries matching the options. Entries are skipped
+// while skip is positive, without reading the items
+func (b *badgerStore) batch(
+	ns string,
+	it *iterator,
+	opts gkvstore.ListOpt,
+	withItem bool,
+	skip *int64,
+) ([]entry, bool, error) {
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return nil, false, gkvstore.ErrStoreClosed
+	}
+
+	txn := b.db.NewTransaction(false)
+	defer txn.Discard()
+
+	iopts := badger.DefaultIteratorOptions
+	iopts.PrefetchValues = false
+	iopts.Reverse = it.desc
+	// Reverse seek starts from the end, which doesn't have the prefix
+	if !it.desc {
+		iopts.Prefix = it.prefix
+	}
+	iter := txn.NewIterator(iopts)
+	defer iter.Close()
+
+	switch {
+	case !it.desc && it.pos != nil:
+		// Smallest key after the position
+		iter.Seek(append(kv.Concat(it.pos), 0))
+	case !it.desc:
+		iter.Seek(it.start)
+	case it.pos != nil:
+		iter.Seek(it.pos)
+	default:
+		iter.Seek(it.end)
+	}
+
+	var entries []entry
+	for ; iter.Valid(); iter.Next() {
+		item := iter.Item()
+		k := item.KeyCopy(nil)
+		if !it.desc && it.end != nil && bytes.Compare(k, it.end) >= 0 {
+			return entries, true, nil
+		}
+		if it.desc {
+			if bytes.Compare(k, it.start) < 0 {
+				return entries, true, nil
+			}
+			// Seek in reverse includes the key itself
+			if (it.pos != nil && bytes.Equal(k, it.pos)) || (it.end != nil && bytes.Compare(k, it.end) >= 0) {
+				continue
+			}
+		}
+		if len(entries) == batchSize {
+			return entries, false, nil
+		}
+		it.pos = k
+
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, false, err
+		}
+		e, found := it.match(txn, ns, opts, k, val, withItem && *skip == 0)
+		if !found {
+			continue
+		}
+		if *skip > 0 && e.err == nil {
+			*skip--
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, true, nil
+}
+
+// scan calls the function for the entries matching the options till it
+// returns false. Entries skipped by the Page are not read unless they have to
+// be filtered. The item is decoded only if required or a Filter is used
+func (b *badgerStore) scan(
+	ctx context.Context,
+	ns string,
+	it *iterator,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+	withItem bool,
+	fn func(entry, gkvstore.Item) bool,
+) error {
+
+	var skip, fskip int64
+	if opts.Cursor == "" {
+		skip = opts.Page * opts.Limit
+	}
+	// Filtered items can only be skipped after decoding
+	if opts.Filter != nil {
+		skip, fskip = 0, skip
+	}
+
+	for {
+		entries, done, err := b.batch(ns, it, opts, withItem || opts.Filter != nil, &skip)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var item gkvstore.Item
+			if e.err == nil && e.item != nil {
+				item = factory()
+				e.err = item.Unmarshal(e.item)
+				if opts.Filter != nil && e.err == nil && !opts.Filter.Compare(item) {
+					continue
+				}
+			}
+			if fskip > 0 {
+				fskip--
+				continue
+			}
+			if !fn(e, item) {
+				return nil
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+func (b *badgerStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	iter, err := newIterator(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return nil, gkvstore.WrapNamespaceError("List", ns, gkvstore.ErrStoreClosed)
+	}
+
+	res := make(chan *gkvstore.Result)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := b.scan(ctx, ns, iter, factory, opts, true, func(e entry, it gkvstore.Item) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- &gkvstore.Result{Val: it, Err: e.err, Cursor: gkvstore.Cursor{Sort: opts.Sort, Key: e.key}.Encode()}:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.Result{Err: gkvstore.WrapNamespaceError("List", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+func (b *badgerStore) ListKeys(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.KeyResult, error) {
+
+	ns := factory().GetNamespace()
+	iter, err := newIterator(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+	}
+
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, gkvstore.ErrStoreClosed)
+	}
+
+	res := make(chan *gkvstore.KeyResult)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := b.scan(ctx, ns, iter, factory, opts, false, func(e entry, _ gkvstore.Item) bool {
+			kr := &gkvstore.KeyResult{
+				Key:    gkvstore.Key{Namespace: ns, ID: e.id},
+				Err:    e.err,
+				Cursor: gkvstore.Cursor{Sort: opts.Sort, Key: e.key}.Encode(),
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- kr:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.KeyResult{Err: gkvstore.WrapNamespaceError("ListKeys", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+// Count iterates over the keys. Items are read only if a Filter is provided
+func (b *badgerStore) Count(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (int64, error) {
+
+	ns := factory().GetNamespace()
+	opts.Sort, opts.Page, opts.Limit, opts.Cursor = gkvstore.SortNatural, 0, 0, ""
+	iter, err := newIterator(ns, opts)
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+
+	var (
+		count int64
+		ferr  error
+	)
+	err = b.scan(ctx, ns, iter, factory, opts, false, func(e entry, _ gkvstore.Item) bool {
+		if e.err != nil {
+			ferr = e.err
+			return false
+		}
+		count++
+		return true
+	})
+	if err == nil {
+		err = ferr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+	return count, nil
+}
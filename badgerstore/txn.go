@@ -0,0 +1,132 @@
+package badgerstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/plexsysio/gkvstore"
+)
+
+// badgerTxn is a Badger read-write transaction. Badger detects the conflicts
+// with the transactions committed after this one started on Commit
+type badgerTxn struct {
+	store *badgerStore
+	txn   *badger.Txn
+	// creates are checked again to return the cause of a conflict
+	creates []gkvstore.Item
+	done    bool
+}
+
+func (b *badgerStore) NewTransaction(_ context.Context) (gkvstore.Txn, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+	return &badgerTxn{store: b, txn: b.db.NewTransaction(true)}, nil
+}
+
+// run executes the operation if the transaction and the store are open
+func (t *badgerTxn) run(fn func(*badger.Txn) error) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	if t.store.closed {
+		return gkvstore.ErrStoreClosed
+	}
+	return fn(t.txn)
+}
+
+func (t *badgerTxn) Create(_ context.Context, item gkvstore.Item) error {
+	err := t.run(func(txn *badger.Txn) error {
+		return t.store.create(txn, item)
+	})
+	if err == nil {
+		t.creates = append(t.creates, item)
+	}
+	if errors.Is(err, gkvstore.ErrTxnClosed) {
+		return err
+	}
+	return gkvstore.WrapError("Create", item, err)
+}
+
+func (t *badgerTxn) Read(_ context.Context, item gkvstore.Item) error {
+	err := t.run(func(txn *badger.Txn) error {
+		return t.store.read(txn, item)
+	})
+	if errors.Is(err, gkvstore.ErrTxnClosed) {
+		return err
+	}
+	return gkvstore.WrapError("Read", item, err)
+}
+
+func (t *badgerTxn) Update(_ context.Context, item gkvstore.Item) error {
+	err := t.run(func(txn *badger.Txn) error {
+		return t.store.update(txn, item)
+	})
+	if errors.Is(err, gkvstore.ErrTxnClosed) {
+		return err
+	}
+	return gkvstore.WrapError("Update", item, err)
+}
+
+func (t *badgerTxn) Delete(_ context.Context, item gkvstore.Item) error {
+	err := t.run(func(txn *badger.Txn) error {
+		return t.store.delete(txn, item)
+	})
+	if errors.Is(err, gkvstore.ErrTxnClosed) {
+		return err
+	}
+	return gkvstore.WrapError("Delete", item, err)
+}
+
+// Commit returns ErrRecordAlreadyExists if an item created in the
+// transaction was created concurrently, else ErrVersionConflict if any of the
+// items read in the transaction was modified
+func (t *badgerTxn) Commit(_ context.Context) error {
+	err := t.run(func(txn *badger.Txn) error {
+		return txn.Commit()
+	})
+	if errors.Is(err, gkvstore.ErrTxnClosed) {
+		return err
+	}
+	creates := t.creates
+	t.Discard(context.Background())
+	if !errors.Is(err, badger.ErrConflict) {
+		return err
+	}
+
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	if t.store.closed {
+		return gkvstore.ErrStoreClosed
+	}
+	return t.store.db.View(func(txn *badger.Txn) error {
+		for _, item := range creates {
+			_, _, exists, err := live(txn, item.GetNamespace(), item.GetID())
+			if err != nil {
+				return err
+			}
+			if exists {
+				return gkvstore.WrapError("Create", item, gkvstore.ErrRecordAlreadyExists)
+			}
+		}
+		return gkvstore.ErrVersionConflict
+	})
+}
+
+func (t *badgerTxn) Discard(_ context.Context) {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.txn.Discard()
+	t.creates = nil
+}
@@ -0,0 +1,75 @@
+package gkvstore
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/multierr"
+)
+
+type (
+	// Batcher queues writes which are applied together on Commit. Put creates
+	// the Item if it doesn't exist or updates it otherwise. Batches are not
+	// atomic, all the operations are attempted and the errors are combined.
+	// Use Transactional stores for all-or-nothing semantics
+	Batcher interface {
+		Put(context.Context, Item) error
+		Delete(context.Context, Item) error
+		Commit(context.Context) error
+	}
+
+	// Batching interface can be implemented by stores which can apply batches
+	// more efficiently than individual operations
+	Batching interface {
+		NewBatch(context.Context) (Batcher, error)
+	}
+)
+
+// NewBatch returns the native batch implementation if the store supports it
+// else a generic one which uses the Store methods on Commit
+func NewBatch(ctx context.Context, st Store) (Batcher, error) {
+	if bs, ok := st.(Batching); ok {
+		b, err := bs.NewBatch(ctx)
+		if !errors.Is(err, ErrNotSupported) {
+			return b, err
+		}
+	}
+	return &batch{st: st}, nil
+}
+
+type batchOp struct {
+	item   Item
+	delete bool
+}
+
+type batch struct {
+	st  Store
+	ops []batchOp
+}
+
+func (b *batch) Put(_ context.Context, item Item) error {
+	b.ops = append(b.ops, batchOp{item: item})
+	return nil
+}
+
+func (b *batch) Delete(_ context.Context, item Item) error {
+	b.ops = append(b.ops, batchOp{item: item, delete: true})
+	return nil
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	var err error
+	for _, op := range b.ops {
+		if op.delete {
+			multierr.AppendInto(&err, b.st.Delete(ctx, op.item))
+			continue
+		}
+		cErr := b.st.Create(ctx, op.item)
+		if errors.Is(cErr, ErrRecordAlreadyExists) {
+			cErr = b.st.Update(ctx, op.item)
+		}
+		multierr.AppendInto(&err, cErr)
+	}
+	b.ops = nil
+	return err
+}
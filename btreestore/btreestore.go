@@ -0,0 +1,419 @@
+// Package btreestore provides a persistent store on a single file B+tree.
+// The file is divided into fixed size pages which are only loaded when
+// accessed, so the data doesn't have to fit in memory. Writes are
+// copy-on-write and a commit is made visible by writing the meta page, so
+// the file is always consistent even if the process crashes midway.
+//
+// Items are stored with keys of the form /namespace NUL id, so listing in the
+// natural order is an iteration over the tree. The created and updated
+// timestamps, the secondary indexes and the expiry are maintained as
+// separate keys in the same tree and updated in the same commit as the item.
+// Namespaces and index names cannot contain the NUL character.
+package btreestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+	"go.uber.org/atomic"
+)
+
+// reapInterval is the interval of the reaper, which removes the items found
+// in the expiry index
+const reapInterval = time.Second
+
+// Options configure the store
+type Options struct {
+	// NoSync skips syncing the file on commit. Recent writes can be lost and
+	// the file can be corrupted on a machine crash
+	NoSync bool
+	// CacheSize is the no of decoded pages kept in memory. Default is 4096
+	CacheSize int
+}
+
+type btreeStore struct {
+	mu     sync.RWMutex
+	nonce  atomic.Int64
+	db     *db
+	closed bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New opens the store in the file, creating it if required. A background
+// routine removes the expired items, which is stopped on Close. The store is
+// not usable after Close
+func New(path string, opts Options) (gkvstore.Store, error) {
+	d, err := openDB(path, opts.NoSync, opts.CacheSize)
+	if err != nil {
+		return nil, fmt.Errorf("btreestore: failed opening %s: %w", path, err)
+	}
+	st := &btreeStore{db: d, stop: make(chan struct{})}
+
+	buf, found, err := get(d, kv.NonceKey)
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("btreestore: failed reading %s: %w", path, err)
+	}
+	if found && len(buf) == 8 {
+		st.nonce.Store(int64(binary.BigEndian.Uint64(buf)))
+	}
+
+	st.wg.Add(1)
+	go st.reaper()
+	return st, nil
+}
+
+// validate also checks the size of the item key, as the keys have to fit
+// in a page
+func validate(item gkvstore.Item) error {
+	if err := kv.Validate(item); err != nil {
+		return err
+	}
+	if len(kv.DataKey(item.GetNamespace(), item.GetID())) > maxKeySize {
+		return fmt.Errorf("%w: key longer than %d bytes", gkvstore.ErrInvalidItem, maxKeySize)
+	}
+	return nil
+}
+
+// lookup returns the record of the item. Expired items which are not yet
+// removed are returned as well
+func lookup(v view, ns, id string) (*kv.Meta, []byte, bool, error) {
+	buf, found, err := get(v, kv.DataKey(ns, id))
+	if err != nil || !found {
+		return nil, nil, false, err
+	}
+	m, item, err := kv.DecodeRecord(buf)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// live returns the record if the item exists and is not expired. Expired
+// items are removed by the reaper, till then they are treated as
+// non-existent
+func live(v view, ns, id string) (*kv.Meta, []byte, bool, error) {
+	m, item, exists, err := lookup(v, ns, id)
+	if err != nil || !exists || m.Expired(time.Now().UnixNano()) {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// indexKeys returns the index keys of the item along with the value stored
+func indexKeys(ns, id string, m *kv.Meta) map[string][]byte {
+	keys := make(map[string][]byte)
+	if m.TimeTrack {
+		keys[string(kv.TimeKey(kv.CreatedPrefix, ns, m.Created, id))] = []byte(id)
+		keys[string(kv.TimeKey(kv.UpdatedPrefix, ns, m.Updated, id))] = []byte(id)
+	}
+	for name, val := range m.Indexes {
+		keys[string(kv.ValueKey(ns, name, val, id))] = []byte(id)
+	}
+	if m.Expiry != 0 {
+		keys[string(kv.ExpiryKey(m.Expiry, ns, id))] = nil
+	}
+	return keys
+}
+
+// write stores the item and updates its index keys in the transaction
+func write(t *tx, ns, id string, old, m *kv.Meta, item []byte) error {
+	var oldKeys map[string][]byte
+	if old != nil {
+		oldKeys = indexKeys(ns, id, old)
+	}
+	newKeys := indexKeys(ns, id, m)
+	for k := range newKeys {
+		if len(k) > maxKeySize {
+			return fmt.Errorf("%w: index key longer than %d bytes", gkvstore.ErrInvalidItem, maxKeySize)
+		}
+	}
+	for k := range oldKeys {
+		if _, found := newKeys[k]; found {
+			continue
+		}
+		if _, err := t.delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+	for k, v := range newKeys {
+		if _, found := oldKeys[k]; found {
+			continue
+		}
+		if err := t.put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	rec, err := kv.EncodeRecord(m, item)
+	if err != nil {
+		return err
+	}
+	return t.put(kv.DataKey(ns, id), rec)
+}
+
+// remove deletes the item and its index keys in the transaction
+func remove(t *tx, ns, id string, m *kv.Meta) error {
+	for k := range indexKeys(ns, id, m) {
+		if _, err := t.delete([]byte(k)); err != nil {
+			return err
+		}
+	}
+	_, err := t.delete(kv.DataKey(ns, id))
+	return err
+}
+
+// update runs the function in a write transaction which is committed if it
+// succeeds. It has to be called with the lock held
+func (b *btreeStore) update(fn func(*tx) error) error {
+	t := b.db.begin()
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+func (b *btreeStore) Create(ctx context.Context, item gkvstore.Item) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrStoreClosed)
+	}
+
+	return gkvstore.WrapError("Create", item, b.update(func(t *tx) error {
+		if ids, ok := item.(gkvstore.IDSetter); ok {
+			n := b.nonce.Inc()
+			ids.SetID(fmt.Sprintf("%d", n))
+			if err := t.put(kv.NonceKey, kv.AppendUint64(nil, uint64(n))); err != nil {
+				return err
+			}
+		}
+		if err := validate(item); err != nil {
+			return err
+		}
+
+		ns, id := item.GetNamespace(), item.GetID()
+		old, _, exists, err := lookup(t, ns, id)
+		if err != nil {
+			return err
+		}
+		if exists && !old.Expired(time.Now().UnixNano()) {
+			return gkvstore.ErrRecordAlreadyExists
+		}
+
+		m := &kv.Meta{
+			Version: 1,
+			Expiry:  gkvstore.ItemExpiry(item),
+			Indexes: gkvstore.ItemIndexes(item),
+		}
+
+		if tt, ok := item.(gkvstore.TimeTracker); ok {
+			timestamp := time.Now().UnixNano()
+			tt.SetCreated(timestamp)
+			tt.SetUpdated(timestamp)
+			m.TimeTrack = true
+			m.Created = timestamp
+			m.Updated = timestamp
+		}
+
+		if v, ok := item.(gkvstore.Versioned); ok {
+			v.SetVersion(1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+		// Expired item which is not yet reaped is replaced
+		return write(t, ns, id, old, m, itemBuf)
+	}))
+}
+
+func (b *btreeStore) Read(ctx context.Context, item gkvstore.Item) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrStoreClosed)
+	}
+
+	_, buf, exists, err := live(b.db, item.GetNamespace(), item.GetID())
+	if err != nil {
+		return gkvstore.WrapError("Read", item, err)
+	}
+	if !exists {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+	}
+	return gkvstore.WrapError("Read", item, item.Unmarshal(buf))
+}
+
+func (b *btreeStore) Update(ctx context.Context, item gkvstore.Item) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrStoreClosed)
+	}
+
+	return gkvstore.WrapError("Update", item, b.update(func(t *tx) error {
+		if err := validate(item); err != nil {
+			return err
+		}
+
+		ns, id := item.GetNamespace(), item.GetID()
+		old, _, exists, err := lookup(t, ns, id)
+		if err != nil {
+			return err
+		}
+		prev := old
+		if exists && old.Expired(time.Now().UnixNano()) {
+			exists = false
+		}
+
+		var version int64
+		if exists {
+			version = old.Version
+		}
+		v, versioned := item.(gkvstore.Versioned)
+		if versioned && v.GetVersion() != version {
+			return gkvstore.ErrVersionConflict
+		}
+
+		m := &kv.Meta{
+			Version: version + 1,
+			Expiry:  gkvstore.ItemExpiry(item),
+			Indexes: gkvstore.ItemIndexes(item),
+		}
+
+		if tt, ok := item.(gkvstore.TimeTracker); ok {
+			timestamp := time.Now().UnixNano()
+			if exists && old.TimeTrack {
+				tt.SetCreated(old.Created)
+			} else {
+				tt.SetCreated(timestamp)
+			}
+			tt.SetUpdated(timestamp)
+			m.TimeTrack = true
+			m.Created = tt.GetCreated()
+			m.Updated = timestamp
+		}
+
+		if versioned {
+			v.SetVersion(version + 1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+		return write(t, ns, id, prev, m, itemBuf)
+	}))
+}
+
+func (b *btreeStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return gkvstore.WrapError("Delete", item, gkvstore.ErrStoreClosed)
+	}
+
+	ns, id := item.GetNamespace(), item.GetID()
+	m, _, exists, err := lookup(b.db, ns, id)
+	if err != nil || !exists {
+		return gkvstore.WrapError("Delete", item, err)
+	}
+	return gkvstore.WrapError("Delete", item, b.update(func(t *tx) error {
+		return remove(t, ns, id, m)
+	}))
+}
+
+func (b *btreeStore) reaper() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			// Failed removals are retried on the next run
+			_ = b.reap()
+		}
+	}
+}
+
+// reap removes the expired items in a single transaction
+func (b *btreeStore) reap() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	var expired [][]byte
+	for k := []byte{kv.ExpiryPrefix}; ; k = append(k, 0) {
+		key, _, exists, err := seek(b.db, k)
+		if err != nil {
+			return err
+		}
+		if !exists || key[0] != kv.ExpiryPrefix || int64(binary.BigEndian.Uint64(key[1:])) > now {
+			break
+		}
+		expired = append(expired, key)
+		k = append([]byte(nil), key...)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	return b.update(func(t *tx) error {
+		for _, k := range expired {
+			sep := bytes.IndexByte(k[9:], 0)
+			ns, id := string(k[9:9+sep]), string(k[10+sep:])
+			m, _, exists, err := lookup(t, ns, id)
+			if err != nil {
+				return err
+			}
+			if !exists || !m.Expired(now) {
+				// Stale expiry key
+				if _, err := t.delete(k); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := remove(t, ns, id, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close stops the reaper and closes the file
+func (b *btreeStore) Close() error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.db.close()
+}
@@ -0,0 +1,239 @@
+package btreestore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/btreestore"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func TestSuite(t *testing.T) {
+	st, err := btreestore.New(filepath.Join(t.TempDir(), "store.db"), btreestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testsuite.RunTestsuite(t, st, testsuite.Advanced)
+}
+
+func BenchmarkSuite(b *testing.B) {
+	st, err := btreestore.New(filepath.Join(b.TempDir(), "store.db"), btreestore.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer st.Close()
+
+	testsuite.BenchmarkSuite(b, st)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Data    []byte
+	Created int64
+	Updated int64
+}
+
+func docID(i int) string {
+	return fmt.Sprintf("%04d", i)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+
+	st, err := btreestore.New(path, btreestore.Options{CacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough items for a multi level tree and values using overflow pages
+	for i := 0; i < 2000; i++ {
+		doc := &document{Id: docID(i), Text: "created"}
+		if i%100 == 1 {
+			doc.Data = bytes.Repeat([]byte{byte(i)}, 10000)
+		}
+		if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2000; i += 2 {
+		if err := st.Delete(context.TODO(), autoencoding.MustNew(&document{Id: docID(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), autoencoding.MustNew(&document{Id: docID(1)})); !errors.Is(err, gkvstore.ErrStoreClosed) {
+		t.Fatal("expected store closed error", err)
+	}
+
+	st, err = btreestore.New(path, btreestore.Options{CacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for i := 0; i < 2000; i++ {
+		doc := &document{Id: docID(i)}
+		err := st.Read(context.TODO(), autoencoding.MustNew(doc))
+		if i%2 == 0 {
+			if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+				t.Fatal("expected deleted document", doc.Id, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Text != "created" || (i%100 == 1) != (len(doc.Data) == 10000) {
+			t.Fatal("incorrect document", doc.Id)
+		}
+	}
+
+	res, err := st.List(
+		context.TODO(),
+		func() gkvstore.Item { return autoencoding.MustNew(&document{}) },
+		gkvstore.ListOpt{Sort: gkvstore.SortIDDesc},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := 1999
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Val.GetID() != docID(next) {
+			t.Fatal("incorrect order", r.Val.GetID(), docID(next))
+		}
+		next -= 2
+	}
+	if next != -1 {
+		t.Fatal("incorrect no of documents", next)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	st, err := btreestore.New(filepath.Join(t.TempDir(), "store.db"), btreestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	doc := &document{Id: "large", Data: bytes.Repeat([]byte("a"), 20000)}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+	doc.Data = bytes.Repeat([]byte("b"), 9000)
+	if err := st.Update(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &document{Id: "large"}
+	if err := st.Read(context.TODO(), autoencoding.MustNew(rd)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rd.Data, doc.Data) || rd.Created == 0 || rd.Updated < rd.Created {
+		t.Fatal("incorrect document", len(rd.Data))
+	}
+
+	long := &document{Id: string(bytes.Repeat([]byte("k"), 600))}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(long)); !errors.Is(err, gkvstore.ErrInvalidItem) {
+		t.Fatal("expected invalid item error", err)
+	}
+}
+
+func TestTornMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+
+	st, err := btreestore.New(path, btreestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := st.Create(context.TODO(), autoencoding.MustNew(&document{Id: docID(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both the meta pages are written once on creation, so the second commit
+	// is in the second meta page. Corrupting it has to fall back to the
+	// first commit
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xff}, 4096+20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	st, err = btreestore.New(path, btreestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	if err := st.Read(context.TODO(), autoencoding.MustNew(&document{Id: docID(0)})); err != nil {
+		t.Fatal(err)
+	}
+	err = st.Read(context.TODO(), autoencoding.MustNew(&document{Id: docID(1)}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected last commit to be discarded", err)
+	}
+}
+
+type indexedItem struct {
+	Id      string
+	Expiry  int64
+	Indexed map[string]string
+}
+
+func (i *indexedItem) GetNamespace() string { return "indexed" }
+
+func (i *indexedItem) GetID() string { return i.Id }
+
+func (i *indexedItem) Marshal() ([]byte, error) { return json.Marshal(i) }
+
+func (i *indexedItem) Unmarshal(buf []byte) error { return json.Unmarshal(buf, i) }
+
+func (i *indexedItem) GetExpiry() int64 { return i.Expiry }
+
+func (i *indexedItem) Indexes() map[string]string { return i.Indexed }
+
+func TestInvalidItem(t *testing.T) {
+	st, err := btreestore.New(filepath.Join(t.TempDir(), "store.db"), btreestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for _, it := range []*indexedItem{
+		{Id: "1", Indexed: map[string]string{"a\x00b": "c"}},
+		{Id: "2", Expiry: -1},
+	} {
+		if err := st.Create(context.TODO(), it); !errors.Is(err, gkvstore.ErrInvalidItem) {
+			t.Fatal("expected invalid item error", it.Id, err)
+		}
+	}
+
+	it := &indexedItem{Id: "3"}
+	if err := st.Create(context.TODO(), it); err != nil {
+		t.Fatal(err)
+	}
+	it.Expiry = -1
+	if err := st.Update(context.TODO(), it); !errors.Is(err, gkvstore.ErrInvalidItem) {
+		t.Fatal("expected invalid item error", err)
+	}
+}
@@ -0,0 +1,418 @@
+package btreestore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+const defaultCacheSize = 4096
+
+// view provides read access to a version of the tree. The db is the last
+// committed version and a tx includes the changes which are not yet committed
+type view interface {
+	root() pgid
+	node(pgid) (*node, error)
+	page(pgid) ([]byte, error)
+}
+
+// db manages the pages of the file. Committed pages are never modified, so
+// the writes are copy-on-write and a commit only becomes visible once the
+// meta page is written. Readers and the writer have to be synchronized by
+// the caller
+type db struct {
+	f      *os.File
+	noSync bool
+	meta   meta
+	// free pages in the last commit and the pages holding the freelist
+	free    []pgid
+	flPages []pgid
+
+	cacheMu   sync.Mutex
+	cache     map[pgid]*node
+	cacheSize int
+}
+
+func openDB(path string, noSync bool, cacheSize int) (*db, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if cacheSize <= 0 {
+		cacheSize = defaultCacheSize
+	}
+	d := &db{
+		f:         f,
+		noSync:    noSync,
+		cache:     make(map[pgid]*node),
+		cacheSize: cacheSize,
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		err = d.init()
+	} else {
+		err = d.load()
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// init writes both the meta pages and an empty root leaf
+func (d *db) init() error {
+	buf := make([]byte, 3*pageSize)
+	m := meta{root: 2, npages: 3}
+	m.encode(buf)
+	m.txid = 1
+	m.encode(buf[pageSize:])
+	(&node{leaf: true}).encode(buf[2*pageSize:])
+	if _, err := d.f.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	if err := d.f.Sync(); err != nil {
+		return err
+	}
+	d.meta = m
+	return nil
+}
+
+// load uses the valid meta page with the latest commit and reads the
+// freelist
+func (d *db) load() error {
+	var (
+		latest meta
+		found  bool
+		merr   error
+	)
+	buf := make([]byte, pageSize)
+	for id := pgid(0); id < 2; id++ {
+		if _, err := d.f.ReadAt(buf, int64(id)*pageSize); err != nil {
+			merr = err
+			continue
+		}
+		m, err := decodeMeta(buf)
+		if err != nil {
+			merr = err
+			continue
+		}
+		if !found || m.txid > latest.txid {
+			latest, found = m, true
+		}
+	}
+	if !found {
+		return fmt.Errorf("no valid meta page: %w", merr)
+	}
+	d.meta = latest
+
+	for id := latest.freelist; id != 0; {
+		buf, err := d.page(id)
+		if err != nil {
+			return err
+		}
+		next, count, err := decodeChain(buf, freelistPage)
+		if err != nil {
+			return err
+		}
+		d.flPages = append(d.flPages, id)
+		for i := 0; i < count; i++ {
+			d.free = append(d.free, pgid(binary.BigEndian.Uint64(buf[chainHeaderSize+8*i:])))
+		}
+		id = next
+	}
+	return nil
+}
+
+func (d *db) root() pgid {
+	return d.meta.root
+}
+
+func (d *db) page(id pgid) ([]byte, error) {
+	buf := make([]byte, pageSize)
+	if _, err := d.f.ReadAt(buf, int64(id)*pageSize); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// node returns the decoded page. Nodes are cached as committed pages are not
+// modified till they are freed
+func (d *db) node(id pgid) (*node, error) {
+	d.cacheMu.Lock()
+	n, found := d.cache[id]
+	d.cacheMu.Unlock()
+	if found {
+		return n, nil
+	}
+
+	buf, err := d.page(id)
+	if err != nil {
+		return nil, err
+	}
+	n, err = decodeNode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", id, err)
+	}
+	d.cacheNode(id, n)
+	return n, nil
+}
+
+func (d *db) cacheNode(id pgid, n *node) {
+	d.cacheMu.Lock()
+	defer d.cacheMu.Unlock()
+
+	if len(d.cache) >= d.cacheSize {
+		// Random eviction is good enough as the upper levels of the tree are
+		// loaded again on the next access
+		for k := range d.cache {
+			delete(d.cache, k)
+			if len(d.cache) < d.cacheSize*3/4 {
+				break
+			}
+		}
+	}
+	d.cache[id] = n
+}
+
+func (d *db) close() error {
+	return d.f.Close()
+}
+
+// begin starts a write transaction. Only one transaction can be active
+func (d *db) begin() *tx {
+	return &tx{
+		db:    d,
+		meta:  d.meta,
+		free:  append([]pgid(nil), d.free...),
+		nodes: make(map[pgid]*node),
+		pages: make(map[pgid][]byte),
+	}
+}
+
+// tx collects the changes of a write transaction. Pages freed in the
+// transaction are only reused after it is committed, so the last commit stays
+// intact till the meta is written
+type tx struct {
+	db      *db
+	meta    meta
+	free    []pgid
+	pending []pgid
+	nodes   map[pgid]*node
+	pages   map[pgid][]byte
+}
+
+func (t *tx) root() pgid {
+	return t.meta.root
+}
+
+func (t *tx) node(id pgid) (*node, error) {
+	if n, found := t.nodes[id]; found {
+		return n, nil
+	}
+	return t.db.node(id)
+}
+
+func (t *tx) page(id pgid) ([]byte, error) {
+	if buf, found := t.pages[id]; found {
+		return buf, nil
+	}
+	return t.db.page(id)
+}
+
+func (t *tx) allocate() pgid {
+	if l := len(t.free); l > 0 {
+		id := t.free[l-1]
+		t.free = t.free[:l-1]
+		return id
+	}
+	id := t.meta.npages
+	t.meta.npages++
+	return id
+}
+
+func (t *tx) release(id pgid) {
+	delete(t.nodes, id)
+	delete(t.pages, id)
+	t.pending = append(t.pending, id)
+}
+
+// writable returns a copy of the node which can be modified in the
+// transaction along with its new page
+func (t *tx) writable(id pgid) (*node, pgid, error) {
+	if n, found := t.nodes[id]; found {
+		return n, id, nil
+	}
+	n, err := t.db.node(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	t.release(id)
+	c := n.clone()
+	nid := t.allocate()
+	t.nodes[nid] = c
+	return c, nid, nil
+}
+
+func (t *tx) allocNode(n *node) pgid {
+	id := t.allocate()
+	t.nodes[id] = n
+	return id
+}
+
+// newValue stores the data inline or in a new chain of overflow pages
+func (t *tx) newValue(data []byte) value {
+	if len(data) <= maxInlineSize {
+		return value{inline: data, size: uint32(len(data))}
+	}
+	var head, prev pgid
+	for off := 0; off < len(data); off += chainDataSize {
+		end := off + chainDataSize
+		if end > len(data) {
+			end = len(data)
+		}
+		id := t.allocate()
+		buf := make([]byte, pageSize)
+		encodeChain(buf, overflowPage, 0, end-off)
+		copy(buf[chainHeaderSize:], data[off:end])
+		t.pages[id] = buf
+		if prev == 0 {
+			head = id
+		} else {
+			binary.BigEndian.PutUint64(t.pages[prev][1:], uint64(id))
+		}
+		prev = id
+	}
+	return value{overflow: head, size: uint32(len(data))}
+}
+
+// freeValue releases the overflow pages of the value
+func (t *tx) freeValue(v value) error {
+	for id := v.overflow; id != 0; {
+		buf, err := t.page(id)
+		if err != nil {
+			return err
+		}
+		next, _, err := decodeChain(buf, overflowPage)
+		if err != nil {
+			return err
+		}
+		t.release(id)
+		id = next
+	}
+	return nil
+}
+
+// readValue returns a copy of the data of the value from the view, so the
+// cached pages are not modified by the callers
+func readValue(v view, val value) ([]byte, error) {
+	if val.overflow == 0 {
+		return append([]byte(nil), val.inline...), nil
+	}
+	data := make([]byte, 0, val.size)
+	for id := val.overflow; id != 0; {
+		buf, err := v.page(id)
+		if err != nil {
+			return nil, err
+		}
+		next, length, err := decodeChain(buf, overflowPage)
+		if err != nil || length > chainDataSize {
+			return nil, fmt.Errorf("overflow page %d: %w", id, errInvalidPage)
+		}
+		data = append(data, buf[chainHeaderSize:chainHeaderSize+length]...)
+		id = next
+	}
+	if len(data) != int(val.size) {
+		return nil, errors.New("incomplete overflow chain")
+	}
+	return data, nil
+}
+
+// commit writes the changed pages and the new freelist, followed by the meta
+// page of the new version
+func (t *tx) commit() error {
+	d := t.db
+	perPage := chainDataSize / 8
+
+	// Freelist pages are allocated first, which can only reduce the no of
+	// free pages to be written
+	count := len(t.free) + len(t.pending) + len(d.flPages)
+	flPages := make([]pgid, (count+perPage-1)/perPage)
+	for i := range flPages {
+		flPages[i] = t.allocate()
+	}
+	free := make([]pgid, 0, count)
+	free = append(free, t.free...)
+	free = append(free, t.pending...)
+	free = append(free, d.flPages...)
+	sort.Slice(free, func(i, j int) bool { return free[i] < free[j] })
+
+	for i, id := range flPages {
+		ids := free[i*perPage:]
+		if len(ids) > perPage {
+			ids = ids[:perPage]
+		}
+		var next pgid
+		if i+1 < len(flPages) {
+			next = flPages[i+1]
+		}
+		buf := make([]byte, pageSize)
+		encodeChain(buf, freelistPage, next, len(ids))
+		for j, fid := range ids {
+			binary.BigEndian.PutUint64(buf[chainHeaderSize+8*j:], uint64(fid))
+		}
+		t.pages[id] = buf
+	}
+	t.meta.freelist = 0
+	if len(flPages) > 0 {
+		t.meta.freelist = flPages[0]
+	}
+
+	for id, n := range t.nodes {
+		buf := make([]byte, pageSize)
+		n.encode(buf)
+		t.pages[id] = buf
+	}
+	for id, buf := range t.pages {
+		if _, err := d.f.WriteAt(buf, int64(id)*pageSize); err != nil {
+			return err
+		}
+	}
+	if !d.noSync {
+		if err := d.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	t.meta.txid++
+	buf := make([]byte, pageSize)
+	t.meta.encode(buf)
+	if _, err := d.f.WriteAt(buf, int64(t.meta.txid%2)*pageSize); err != nil {
+		return err
+	}
+	if !d.noSync {
+		if err := d.f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	d.meta = t.meta
+	d.free = free
+	d.flPages = flPages
+	d.cacheMu.Lock()
+	for _, id := range t.pending {
+		delete(d.cache, id)
+	}
+	d.cacheMu.Unlock()
+	for id, n := range t.nodes {
+		d.cacheNode(id, n)
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package btreestore
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+)
+
+// iterator walks the keys with the prefix between start (inclusive) and end
+// (exclusive). Every step seeks from the last position, so the iteration can
+// continue after the tree is modified
+type iterator struct {
+	prefix []byte
+	start  []byte
+	end    []byte
+	desc   bool
+	pos    []byte
+	// items is set if the iteration is over the item keys, else the values
+	// are the IDs of the items
+	items bool
+}
+
+// newIterator returns the iterator for the listing order of the options
+func newIterator(ns string, opts gkvstore.ListOpt) (*iterator, error) {
+	it := &iterator{}
+	switch {
+	// Natural order with index query is the order of the index values
+	case opts.Index.Name != "" && opts.Sort == gkvstore.SortNatural:
+		it.prefix = kv.ValuePrefix(ns, opts.Index.Name)
+		if opts.Index.Value != "" {
+			it.prefix = append(kv.Concat(it.prefix, opts.Index.Value), 0)
+			it.start = it.prefix
+			break
+		}
+		it.start = kv.Concat(it.prefix, opts.Index.Start)
+		if opts.Index.End != "" {
+			it.end = kv.Concat(it.prefix, opts.Index.End)
+		}
+	// Natural order is the order of the IDs
+	case opts.Sort == gkvstore.SortNatural || opts.Sort == gkvstore.SortIDAsc || opts.Sort == gkvstore.SortIDDesc:
+		it.prefix, it.items = kv.DataKey(ns, ""), true
+		start := opts.StartID
+		if opts.IDPrefix > start {
+			start = opts.IDPrefix
+		}
+		it.start = kv.Concat(it.prefix, start)
+		if opts.EndID != "" {
+			it.end = kv.Concat(it.prefix, opts.EndID)
+		}
+		if opts.IDPrefix != "" {
+			end := gkvstore.PrefixEnd(kv.Concat(it.prefix, opts.IDPrefix))
+			if it.end == nil || bytes.Compare(end, it.end) < 0 {
+				it.end = end
+			}
+		}
+		it.desc = opts.Sort == gkvstore.SortIDDesc
+	case opts.Sort == gkvstore.SortCreatedAsc || opts.Sort == gkvstore.SortCreatedDesc:
+		it.prefix = kv.TimePrefix(kv.CreatedPrefix, ns)
+		it.start = it.prefix
+		it.desc = opts.Sort == gkvstore.SortCreatedDesc
+	case opts.Sort == gkvstore.SortUpdatedAsc || opts.Sort == gkvstore.SortUpdatedDesc:
+		it.prefix = kv.TimePrefix(kv.UpdatedPrefix, ns)
+		it.start = it.prefix
+		it.desc = opts.Sort == gkvstore.SortUpdatedDesc
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+	if it.desc && it.end == nil {
+		it.end = gkvstore.PrefixEnd(it.prefix)
+	}
+
+	if opts.Cursor != "" {
+		c, err := gkvstore.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		k := c.Key
+		if !bytes.HasPrefix(k, it.prefix) {
+			return nil, gkvstore.ErrInvalidCursor
+		}
+		it.pos = k
+	}
+	return it, nil
+}
+
+func (it *iterator) next(v view) ([]byte, []byte, bool, error) {
+	var (
+		k, val []byte
+		found  bool
+		err    error
+	)
+	if !it.desc {
+		from := it.start
+		if it.pos != nil {
+			// Smallest key after the position
+			from = append(kv.Concat(it.pos), 0)
+		}
+		k, val, found, err = seek(v, from)
+		if err != nil || !found {
+			return nil, nil, false, err
+		}
+		if !bytes.HasPrefix(k, it.prefix) || (it.end != nil && bytes.Compare(k, it.end) >= 0) {
+			return nil, nil, false, nil
+		}
+	} else {
+		before := it.end
+		if it.pos != nil {
+			before = it.pos
+		}
+		k, val, found, err = seekBefore(v, before)
+		if err != nil || !found {
+			return nil, nil, false, err
+		}
+		if !bytes.HasPrefix(k, it.prefix) || bytes.Compare(k, it.start) < 0 {
+			return nil, nil, false, nil
+		}
+	}
+	it.pos = k
+	return k, val, true, nil
+}
+
+// nextItem returns the next item matching the options along with the key of
+// the iteration. Each call takes the lock, so the writes can proceed while
+// the results are consumed
+func (b *btreeStore) nextItem(ns string, it *iterator, opts gkvstore.ListOpt) ([]byte, []byte, bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return nil, nil, false, gkvstore.ErrStoreClosed
+	}
+
+	now := time.Now().UnixNano()
+	for {
+		k, val, found, err := it.next(b.db)
+		if err != nil || !found {
+			return nil, nil, false, err
+		}
+
+		var (
+			m    *kv.Meta
+			item []byte
+			id   string
+		)
+		if it.items {
+			m, item, err = kv.DecodeRecord(val)
+			if err != nil {
+				return k, nil, true, err
+			}
+			id = string(k[len(it.prefix):])
+		} else {
+			id = string(val)
+			m, item, found, err = lookup(b.db, ns, id)
+			if err != nil {
+				return k, nil, true, err
+			}
+			if !found {
+				continue
+			}
+		}
+
+		if m.Expired(now) || m.Version < opts.Version || !opts.MatchID(id) {
+			continue
+		}
+		if opts.Index.Name != "" {
+			val, found := m.Indexes[opts.Index.Name]
+			if !found || !opts.Index.Match(val) {
+				continue
+			}
+		}
+		return k, item, true, nil
+	}
+}
+
+func (b *btreeStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	iter, err := newIterator(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return nil, gkvstore.WrapNamespaceError("List", ns, gkvstore.ErrStoreClosed)
+	}
+
+	skip := opts.Page * opts.Limit
+	if opts.Cursor != "" {
+		skip = 0
+	}
+	res := make(chan *gkvstore.Result)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		for {
+			k, buf, found, err := b.nextItem(ns, iter, opts)
+			if !found {
+				if err != nil {
+					select {
+					case <-ctx.Done():
+					case res <- &gkvstore.Result{Err: gkvstore.WrapNamespaceError("List", ns, err)}:
+					}
+				}
+				return
+			}
+			// Skipped items are not decoded unless they have to be filtered
+			if skip > 0 && opts.Filter == nil {
+				skip--
+				continue
+			}
+			it := factory()
+			if err == nil {
+				err = it.Unmarshal(buf)
+			}
+			if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case res <- &gkvstore.Result{Val: it, Err: err, Cursor: gkvstore.Cursor{Sort: opts.Sort, Key: k}.Encode()}:
+				count++
+			}
+			if int64(count) == opts.Limit {
+				return
+			}
+		}
+	}()
+
+	return res, nil
+}
@@ -0,0 +1,283 @@
+package btreestore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+type pgid uint64
+
+// The file is a sequence of fixed size pages. Pages 0 and 1 hold the meta,
+// which are written alternately on every commit, so a torn meta write falls
+// back to the previous commit. All the other pages are nodes of the tree,
+// overflow pages holding large values or the freelist.
+const (
+	pageSize = 4096
+
+	// maxKeySize and maxInlineSize ensure that a page can hold at least three
+	// entries, so a split always produces pages within the page size
+	maxKeySize    = 512
+	maxInlineSize = 512
+
+	metaPage     byte = 1
+	leafPage     byte = 2
+	branchPage   byte = 3
+	overflowPage byte = 4
+	freelistPage byte = 5
+
+	// node pages have the type and the no of keys
+	nodeHeaderSize = 3
+	// overflow and freelist pages have the type, the next page in the chain
+	// and the length of the data
+	chainHeaderSize = 13
+	chainDataSize   = pageSize - chainHeaderSize
+
+	magic         uint32 = 0x676b7662
+	formatVersion uint32 = 1
+)
+
+var errInvalidPage = errors.New("invalid page")
+
+// value is stored inline in the leaf if it is small, else in a chain of
+// overflow pages
+type value struct {
+	inline   []byte
+	overflow pgid
+	size     uint32
+}
+
+// node is a decoded page of the tree. Branch nodes have one more child than
+// keys. keys[i] is the smallest key in children[i+1]
+type node struct {
+	leaf     bool
+	keys     [][]byte
+	vals     []value
+	children []pgid
+}
+
+func (n *node) size() int {
+	sz := nodeHeaderSize
+	if !n.leaf {
+		sz += 8
+	}
+	for i := range n.keys {
+		sz += n.entrySize(i)
+	}
+	return sz
+}
+
+func (n *node) entrySize(i int) int {
+	sz := 2 + len(n.keys[i])
+	if !n.leaf {
+		return sz + 8
+	}
+	sz += 1 + 4
+	if n.vals[i].overflow != 0 {
+		return sz + 8
+	}
+	return sz + len(n.vals[i].inline)
+}
+
+func (n *node) clone() *node {
+	c := &node{leaf: n.leaf}
+	c.keys = append([][]byte(nil), n.keys...)
+	if n.leaf {
+		c.vals = append([]value(nil), n.vals...)
+	} else {
+		c.children = append([]pgid(nil), n.children...)
+	}
+	return c
+}
+
+// split divides the node in two halves of roughly equal size. For branch
+// nodes the separator key moves up to the parent
+func (n *node) split() (*node, *node, []byte) {
+	half, sz, mid := n.size()/2, nodeHeaderSize, 0
+	for mid < len(n.keys)-1 && sz+n.entrySize(mid) <= half {
+		sz += n.entrySize(mid)
+		mid++
+	}
+	if mid == 0 {
+		mid = 1
+	}
+	if n.leaf {
+		left := &node{leaf: true, keys: n.keys[:mid:mid], vals: n.vals[:mid:mid]}
+		right := &node{
+			leaf: true,
+			keys: append([][]byte(nil), n.keys[mid:]...),
+			vals: append([]value(nil), n.vals[mid:]...),
+		}
+		return left, right, right.keys[0]
+	}
+	if mid >= len(n.keys)-1 {
+		mid = len(n.keys) - 2
+	}
+	left := &node{keys: n.keys[:mid:mid], children: n.children[: mid+1 : mid+1]}
+	right := &node{
+		keys:     append([][]byte(nil), n.keys[mid+1:]...),
+		children: append([]pgid(nil), n.children[mid+1:]...),
+	}
+	return left, right, n.keys[mid]
+}
+
+func (n *node) encode(buf []byte) {
+	if n.leaf {
+		buf[0] = leafPage
+	} else {
+		buf[0] = branchPage
+	}
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(n.keys)))
+	off := nodeHeaderSize
+	if !n.leaf {
+		binary.BigEndian.PutUint64(buf[off:], uint64(n.children[0]))
+		off += 8
+	}
+	for i, k := range n.keys {
+		binary.BigEndian.PutUint16(buf[off:], uint16(len(k)))
+		off += 2
+		off += copy(buf[off:], k)
+		if !n.leaf {
+			binary.BigEndian.PutUint64(buf[off:], uint64(n.children[i+1]))
+			off += 8
+			continue
+		}
+		v := n.vals[i]
+		binary.BigEndian.PutUint32(buf[off+1:], v.size)
+		if v.overflow != 0 {
+			buf[off] = 1
+			binary.BigEndian.PutUint64(buf[off+5:], uint64(v.overflow))
+			off += 5 + 8
+		} else {
+			buf[off] = 0
+			off += 5
+			off += copy(buf[off:], v.inline)
+		}
+	}
+}
+
+func decodeNode(buf []byte) (*node, error) {
+	if len(buf) != pageSize || (buf[0] != leafPage && buf[0] != branchPage) {
+		return nil, errInvalidPage
+	}
+	n := &node{leaf: buf[0] == leafPage}
+	count := int(binary.BigEndian.Uint16(buf[1:]))
+	n.keys = make([][]byte, count)
+	if n.leaf {
+		n.vals = make([]value, count)
+	} else {
+		n.children = make([]pgid, count+1)
+	}
+
+	off := nodeHeaderSize
+	// need checks if the next l bytes are in the page
+	need := func(l int) bool { return off+l <= len(buf) }
+	if !n.leaf {
+		if !need(8) {
+			return nil, errInvalidPage
+		}
+		n.children[0] = pgid(binary.BigEndian.Uint64(buf[off:]))
+		off += 8
+	}
+	for i := 0; i < count; i++ {
+		if !need(2) {
+			return nil, errInvalidPage
+		}
+		kl := int(binary.BigEndian.Uint16(buf[off:]))
+		off += 2
+		if !need(kl) {
+			return nil, errInvalidPage
+		}
+		n.keys[i] = buf[off : off+kl]
+		off += kl
+		if !n.leaf {
+			if !need(8) {
+				return nil, errInvalidPage
+			}
+			n.children[i+1] = pgid(binary.BigEndian.Uint64(buf[off:]))
+			off += 8
+			continue
+		}
+		if !need(5) {
+			return nil, errInvalidPage
+		}
+		overflow := buf[off] == 1
+		size := binary.BigEndian.Uint32(buf[off+1:])
+		off += 5
+		if overflow {
+			if !need(8) {
+				return nil, errInvalidPage
+			}
+			n.vals[i] = value{overflow: pgid(binary.BigEndian.Uint64(buf[off:])), size: size}
+			off += 8
+			continue
+		}
+		if !need(int(size)) {
+			return nil, errInvalidPage
+		}
+		n.vals[i] = value{inline: buf[off : off+int(size)], size: size}
+		off += int(size)
+	}
+	return n, nil
+}
+
+// encodeChain writes the header of an overflow or freelist page
+func encodeChain(buf []byte, typ byte, next pgid, length int) {
+	buf[0] = typ
+	binary.BigEndian.PutUint64(buf[1:], uint64(next))
+	binary.BigEndian.PutUint32(buf[9:], uint32(length))
+}
+
+func decodeChain(buf []byte, typ byte) (pgid, int, error) {
+	if len(buf) != pageSize || buf[0] != typ {
+		return 0, 0, errInvalidPage
+	}
+	return pgid(binary.BigEndian.Uint64(buf[1:])), int(binary.BigEndian.Uint32(buf[9:])), nil
+}
+
+type meta struct {
+	txid     uint64
+	root     pgid
+	freelist pgid
+	npages   pgid
+}
+
+const metaSize = 53
+
+func (m meta) encode(buf []byte) {
+	buf[0] = metaPage
+	binary.BigEndian.PutUint32(buf[1:], magic)
+	binary.BigEndian.PutUint32(buf[5:], formatVersion)
+	binary.BigEndian.PutUint64(buf[9:], m.txid)
+	binary.BigEndian.PutUint64(buf[17:], uint64(m.root))
+	binary.BigEndian.PutUint64(buf[25:], uint64(m.freelist))
+	binary.BigEndian.PutUint64(buf[33:], uint64(m.npages))
+	binary.BigEndian.PutUint32(buf[41:], pageSize)
+	h := fnv.New64a()
+	_, _ = h.Write(buf[:45])
+	binary.BigEndian.PutUint64(buf[45:], h.Sum64())
+}
+
+func decodeMeta(buf []byte) (meta, error) {
+	if len(buf) < metaSize || buf[0] != metaPage || binary.BigEndian.Uint32(buf[1:]) != magic {
+		return meta{}, errInvalidPage
+	}
+	h := fnv.New64a()
+	_, _ = h.Write(buf[:45])
+	if h.Sum64() != binary.BigEndian.Uint64(buf[45:]) {
+		return meta{}, errInvalidPage
+	}
+	if v := binary.BigEndian.Uint32(buf[5:]); v != formatVersion {
+		return meta{}, fmt.Errorf("unsupported format version %d", v)
+	}
+	if ps := binary.BigEndian.Uint32(buf[41:]); ps != pageSize {
+		return meta{}, fmt.Errorf("unsupported page size %d", ps)
+	}
+	return meta{
+		txid:     binary.BigEndian.Uint64(buf[9:]),
+		root:     pgid(binary.BigEndian.Uint64(buf[17:])),
+		freelist: pgid(binary.BigEndian.Uint64(buf[25:])),
+		npages:   pgid(binary.BigEndian.Uint64(buf[33:])),
+	}, nil
+}
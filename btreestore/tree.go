@@ -0,0 +1,239 @@
+package btreestore
+
+import (
+	"bytes"
+	"sort"
+)
+
+// lowerBound returns the index of the first key which is not less than key
+func (n *node) lowerBound(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+}
+
+// child returns the index of the child which can have the key
+func (n *node) child(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) > 0
+	})
+}
+
+// get returns the value of the key
+func get(v view, key []byte) ([]byte, bool, error) {
+	id := v.root()
+	for {
+		n, err := v.node(id)
+		if err != nil {
+			return nil, false, err
+		}
+		if !n.leaf {
+			id = n.children[n.child(key)]
+			continue
+		}
+		i := n.lowerBound(key)
+		if i == len(n.keys) || !bytes.Equal(n.keys[i], key) {
+			return nil, false, nil
+		}
+		val, err := readValue(v, n.vals[i])
+		return val, err == nil, err
+	}
+}
+
+// seek returns the first key which is not less than the key along with its
+// value
+func seek(v view, key []byte) ([]byte, []byte, bool, error) {
+	return seekNode(v, v.root(), key)
+}
+
+func seekNode(v view, id pgid, key []byte) ([]byte, []byte, bool, error) {
+	n, err := v.node(id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if n.leaf {
+		i := n.lowerBound(key)
+		if i == len(n.keys) {
+			return nil, nil, false, nil
+		}
+		val, err := readValue(v, n.vals[i])
+		return n.keys[i], val, err == nil, err
+	}
+	// Following children are checked if the child doesn't have any key which
+	// is not less than the key
+	for i := n.child(key); i < len(n.children); i++ {
+		k, val, found, err := seekNode(v, n.children[i], key)
+		if err != nil || found {
+			return k, val, found, err
+		}
+	}
+	return nil, nil, false, nil
+}
+
+// seekBefore returns the last key which is less than the key along with its
+// value. If the key is nil, the last key in the tree is returned
+func seekBefore(v view, key []byte) ([]byte, []byte, bool, error) {
+	return seekBeforeNode(v, v.root(), key)
+}
+
+func seekBeforeNode(v view, id pgid, key []byte) ([]byte, []byte, bool, error) {
+	n, err := v.node(id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if n.leaf {
+		i := len(n.keys)
+		if key != nil {
+			i = n.lowerBound(key)
+		}
+		if i == 0 {
+			return nil, nil, false, nil
+		}
+		val, err := readValue(v, n.vals[i-1])
+		return n.keys[i-1], val, err == nil, err
+	}
+	i := len(n.children) - 1
+	if key != nil {
+		i = n.lowerBound(key)
+	}
+	for ; i >= 0; i-- {
+		k, val, found, err := seekBeforeNode(v, n.children[i], key)
+		if err != nil || found {
+			return k, val, found, err
+		}
+	}
+	return nil, nil, false, nil
+}
+
+// put adds or replaces the value of the key
+func (t *tx) put(key, data []byte) error {
+	id, sep, right, err := t.insert(t.meta.root, key, t.newValue(data))
+	if err != nil {
+		return err
+	}
+	if right != 0 {
+		id = t.allocNode(&node{keys: [][]byte{sep}, children: []pgid{id, right}})
+	}
+	t.meta.root = id
+	return nil
+}
+
+// insert adds the key to the subtree. If the node is split, the separator
+// key and the new node on the right are returned
+func (t *tx) insert(id pgid, key []byte, val value) (pgid, []byte, pgid, error) {
+	n, id, err := t.writable(id)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if n.leaf {
+		i := n.lowerBound(key)
+		if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+			if err := t.freeValue(n.vals[i]); err != nil {
+				return 0, nil, 0, err
+			}
+			n.vals[i] = val
+		} else {
+			n.keys = append(n.keys, nil)
+			copy(n.keys[i+1:], n.keys[i:])
+			n.keys[i] = key
+			n.vals = append(n.vals, value{})
+			copy(n.vals[i+1:], n.vals[i:])
+			n.vals[i] = val
+		}
+	} else {
+		i := n.child(key)
+		cid, sep, right, err := t.insert(n.children[i], key, val)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		n.children[i] = cid
+		if right != 0 {
+			n.keys = append(n.keys, nil)
+			copy(n.keys[i+1:], n.keys[i:])
+			n.keys[i] = sep
+			n.children = append(n.children, 0)
+			copy(n.children[i+2:], n.children[i+1:])
+			n.children[i+1] = right
+		}
+	}
+	if n.size() <= pageSize {
+		return id, nil, 0, nil
+	}
+	left, right, sep := n.split()
+	*n = *left
+	return id, sep, t.allocNode(right), nil
+}
+
+// delete removes the key if it exists. Nodes are not merged with their
+// siblings, only the empty ones are removed
+func (t *tx) delete(key []byte) (bool, error) {
+	id, _, found, err := t.remove(t.meta.root, key)
+	if err != nil || !found {
+		return false, err
+	}
+	for {
+		n, err := t.node(id)
+		if err != nil {
+			return false, err
+		}
+		if n.leaf || len(n.children) > 1 {
+			break
+		}
+		t.release(id)
+		if len(n.children) == 0 {
+			id = t.allocNode(&node{leaf: true})
+			break
+		}
+		id = n.children[0]
+	}
+	t.meta.root = id
+	return true, nil
+}
+
+// remove deletes the key from the subtree. Nodes are only copied if the key
+// is found
+func (t *tx) remove(id pgid, key []byte) (pgid, bool, bool, error) {
+	n, err := t.node(id)
+	if err != nil {
+		return 0, false, false, err
+	}
+	if n.leaf {
+		i := n.lowerBound(key)
+		if i == len(n.keys) || !bytes.Equal(n.keys[i], key) {
+			return id, false, false, nil
+		}
+		if err := t.freeValue(n.vals[i]); err != nil {
+			return 0, false, false, err
+		}
+		n, id, err = t.writable(id)
+		if err != nil {
+			return 0, false, false, err
+		}
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.vals = append(n.vals[:i], n.vals[i+1:]...)
+		return id, len(n.keys) == 0, true, nil
+	}
+
+	i := n.child(key)
+	cid, empty, found, err := t.remove(n.children[i], key)
+	if err != nil || !found {
+		return id, false, found, err
+	}
+	n, id, err = t.writable(id)
+	if err != nil {
+		return 0, false, false, err
+	}
+	if !empty {
+		n.children[i] = cid
+		return id, false, true, nil
+	}
+	t.release(cid)
+	n.children = append(n.children[:i], n.children[i+1:]...)
+	switch {
+	case i > 0:
+		n.keys = append(n.keys[:i-1], n.keys[i:]...)
+	case len(n.keys) > 0:
+		n.keys = n.keys[1:]
+	}
+	return id, len(n.children) == 0, true, nil
+}
@@ -0,0 +1,41 @@
+package gkvstore
+
+import (
+	"context"
+	"errors"
+)
+
+// Counter interface can be implemented by stores which can count the items
+// without listing them. Sort, Page, Limit and Cursor in the ListOpt are ignored
+type Counter interface {
+	Count(context.Context, Factory, ListOpt) (int64, error)
+}
+
+// Count returns the no of items matching the options using the Counter
+// implementation if the store supports it, else it drains the List
+func Count(ctx context.Context, st Store, factory Factory, opts ListOpt) (int64, error) {
+	if cs, ok := st.(Counter); ok {
+		count, err := cs.Count(ctx, factory, opts)
+		if !errors.Is(err, ErrNotSupported) {
+			return count, err
+		}
+	}
+
+	opts.Sort, opts.Page, opts.Limit, opts.Cursor = SortNatural, 0, 0, ""
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res, err := st.List(ctx, factory, opts)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for r := range res {
+		if r.Err != nil {
+			return 0, r.Err
+		}
+		count++
+	}
+	return count, nil
+}
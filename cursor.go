@@ -0,0 +1,50 @@
+package gkvstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursor is the position of an item in the listing order of a store. Key is
+// the store specific key of the item. Stores which order the items on the
+// TimeTracker timestamps or the index values keep them in Index and Value, as
+// the key alone doesn't locate the item in such orders
+type Cursor struct {
+	Sort  Sort   `json:"s"`
+	Index int64  `json:"i,omitempty"`
+	Value string `json:"v,omitempty"`
+	Key   []byte `json:"k"`
+}
+
+// Encode returns the cursor to be used in the Result
+func (c Cursor) Encode() string {
+	buf, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeCursor decodes the ListOpt Cursor. ErrInvalidCursor is returned if it
+// is malformed or was obtained using a different Sort
+func DecodeCursor(c string, s Sort) (Cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var cr Cursor
+	if err := json.Unmarshal(buf, &cr); err != nil || cr.Sort != s {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cr, nil
+}
+
+// PrefixEnd returns the smallest key which is greater than all the keys with
+// the prefix. It is nil if there is no such key
+func PrefixEnd(p []byte) []byte {
+	end := append([]byte(nil), p...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package gkvstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StoreError adds the operation and the item it was performed on to the errors
+// returned by the stores. The sentinel errors can be matched using errors.Is
+type StoreError struct {
+	Op        string
+	Namespace string
+	ID        string
+	Err       error
+}
+
+func (e *StoreError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.Namespace, e.Err)
+	}
+	return fmt.Sprintf("%s /%s/%s: %v", e.Op, e.Namespace, e.ID, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+// WrapError returns a StoreError for the operation on the item. It returns nil
+// if err is nil and the error as is if it is already a StoreError
+func WrapError(op string, item Item, err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *StoreError
+	if errors.As(err, &se) {
+		return err
+	}
+	return &StoreError{
+		Op:        op,
+		Namespace: item.GetNamespace(),
+		ID:        item.GetID(),
+		Err:       err,
+	}
+}
+
+// WrapNamespaceError returns a StoreError for the operation on the namespace.
+// It returns nil if err is nil and the error as is if it is already a
+// StoreError
+func WrapNamespaceError(op, namespace string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *StoreError
+	if errors.As(err, &se) {
+		return err
+	}
+	return &StoreError{
+		Op:        op,
+		Namespace: namespace,
+		Err:       err,
+	}
+}
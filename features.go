@@ -0,0 +1,91 @@
+package gkvstore
+
+type (
+	// Features describes the optional parts of the Store API supported by the
+	// store. Clients can use it to check if an option is supported before
+	// using it instead of relying on the errors
+	Features struct {
+		// Sorts are the sort orders supported by List
+		Sorts []Sort
+		// Filter is set if the ListOpt Filter is evaluated by the store
+		Filter bool
+		// Pagination is set if the ListOpt Page and Limit are supported
+		Pagination bool
+		// Cursor is set if List returns cursors to resume iteration
+		Cursor bool
+		// IDRange is set if the ListOpt IDPrefix, StartID and EndID are supported
+		IDRange bool
+		// Index is set if Indexable items can be queried using ListOpt Index
+		Index bool
+		// TimeTracker is set if Created and Updated timestamps are maintained
+		TimeTracker bool
+		// Versioning is set if Versioned items are checked for conflicts
+		Versioning bool
+		// Expiry is set if Expirer items are removed after their expiry
+		Expiry bool
+		// Watch is set if the store implements Watcher
+		Watch bool
+		// Transactions is set if the store implements Transactional
+		Transactions bool
+		// Namespaces is set if the store implements NamespaceManager
+		Namespaces bool
+	}
+
+	// FeatureDescriber interface can be implemented by stores to describe the
+	// features they support
+	FeatureDescriber interface {
+		Features() Features
+	}
+)
+
+// SupportsSort returns true if all the sort orders are supported
+func (f Features) SupportsSort(sorts ...Sort) bool {
+	for _, s := range sorts {
+		found := false
+		for _, fs := range f.Sorts {
+			if fs == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersect returns the features supported by both
+func (f Features) Intersect(o Features) Features {
+	res := Features{
+		Filter:       f.Filter && o.Filter,
+		Pagination:   f.Pagination && o.Pagination,
+		Cursor:       f.Cursor && o.Cursor,
+		IDRange:      f.IDRange && o.IDRange,
+		Index:        f.Index && o.Index,
+		TimeTracker:  f.TimeTracker && o.TimeTracker,
+		Versioning:   f.Versioning && o.Versioning,
+		Expiry:       f.Expiry && o.Expiry,
+		Watch:        f.Watch && o.Watch,
+		Transactions: f.Transactions && o.Transactions,
+		Namespaces:   f.Namespaces && o.Namespaces,
+	}
+	for _, s := range f.Sorts {
+		if o.SupportsSort(s) {
+			res.Sorts = append(res.Sorts, s)
+		}
+	}
+	return res
+}
+
+// GetFeatures returns the features of the store. Stores which don't describe
+// their features are assumed to support only natural sort and pagination
+func GetFeatures(st Store) Features {
+	if fd, ok := st.(FeatureDescriber); ok {
+		return fd.Features()
+	}
+	return Features{
+		Sorts:      []Sort{SortNatural},
+		Pagination: true,
+	}
+}
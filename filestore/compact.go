@@ -0,0 +1,226 @@
+package filestore
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+func (f *fileStore) compactor() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.opts.CompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if f.needsCompaction() {
+				// Failed compaction is retried on the next run
+				_ = f.merge()
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// needsCompaction checks if the stale records in the sealed segments are
+// above the compaction ratio
+func (f *fileStore) needsCompaction() bool {
+	var size, dead int64
+	for id, seg := range f.segments {
+		if seg != f.active {
+			size += seg.size
+			dead += f.dead[id]
+		}
+	}
+	return size > 0 && float64(dead) >= float64(size)*f.opts.CompactRatio
+}
+
+func (f *fileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return gkvstore.ErrStoreClosed
+	}
+	if f.active.size > 0 {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	return f.merge()
+}
+
+// merge writes the live records of all the sealed segments to a new segment
+// which replaces them. The merged segment takes the ID of the newest sealed
+// segment, so the order of the segments is maintained. Tombstones are not
+// required in the merged segment as all the older records are removed along
+// with it. It has to be called with the lock held
+func (f *fileStore) merge() (err error) {
+	var sealed []uint64
+	for id, seg := range f.segments {
+		if seg != f.active {
+			sealed = append(sealed, id)
+		}
+	}
+	if len(sealed) == 0 {
+		return nil
+	}
+	sortIDs(sealed)
+	target := sealed[len(sealed)-1]
+
+	path := segmentPath(f.dir, target, mergeExt)
+	mf, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	merged := &segment{id: target, f: mf}
+	marker := filepath.Join(f.dir, compactMarker)
+	defer func() {
+		if err != nil {
+			mf.Close()
+			os.Remove(marker)
+			os.Remove(path)
+		}
+	}()
+
+	w := bufio.NewWriterSize(mf, 64*1024)
+	moved := make(map[*entry]int64)
+	for _, id := range sealed {
+		_, err := f.segments[id].scan(func(rec record) error {
+			if rec.op != opPut {
+				return nil
+			}
+			e, found := f.keydir[rec.meta.Namespace][rec.meta.ID]
+			if !found || e.seg != id || e.offset != rec.offset {
+				return nil
+			}
+			buf, err := encodeRecord(opPut, e.meta, rec.val)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			moved[e] = merged.size + int64(len(buf)-len(rec.val))
+			merged.size += int64(len(buf))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := mf.Sync(); err != nil {
+		return err
+	}
+
+	// The marker is written once the merged segment is complete, so an
+	// interrupted compaction can be finished on open
+	ids := make([]string, len(sealed))
+	for i, id := range sealed {
+		ids[i] = strconv.FormatUint(id, 10)
+	}
+	if err := writeFileSync(marker, []byte(strings.Join(ids, "\n"))); err != nil {
+		return err
+	}
+	if err := os.Rename(path, segmentPath(f.dir, target, segmentExt)); err != nil {
+		return err
+	}
+
+	for e, offset := range moved {
+		e.seg, e.offset = target, offset
+	}
+	for _, id := range sealed {
+		f.segments[id].f.Close()
+		delete(f.segments, id)
+		delete(f.dead, id)
+		if id != target {
+			// Failures are cleaned up on the next open using the marker
+			_ = os.Remove(segmentPath(f.dir, id, segmentExt))
+		}
+	}
+	f.segments[target] = merged
+	// A leftover marker only removes the segments which are already merged
+	_ = os.Remove(marker)
+	return nil
+}
+
+// recoverCompaction finishes the compaction interrupted after the merged
+// segment was written and discards the incomplete ones
+func recoverCompaction(dir string) error {
+	marker := filepath.Join(dir, compactMarker)
+	buf, err := os.ReadFile(marker)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		ids := strings.Split(string(buf), "\n")
+		target, err := strconv.ParseUint(ids[len(ids)-1], 10, 64)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(segmentPath(dir, target, mergeExt), segmentPath(dir, target, segmentExt))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, s := range ids[:len(ids)-1] {
+			id, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			err = os.Remove(segmentPath(dir, id, segmentExt))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		if err := os.Remove(marker); err != nil {
+			return err
+		}
+	}
+
+	incomplete, err := filepath.Glob(filepath.Join(dir, "*"+mergeExt))
+	if err != nil {
+		return err
+	}
+	for _, p := range incomplete {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileSync writes the file using a temporary file, so it is either
+// written completely or not at all
+func writeFileSync(path string, buf []byte) error {
+	tmp := path + ".tmp"
+	fl, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fl.Write(buf); err != nil {
+		fl.Close()
+		return err
+	}
+	if err := fl.Sync(); err != nil {
+		fl.Close()
+		return err
+	}
+	if err := fl.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
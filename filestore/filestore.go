@@ -0,0 +1,504 @@
+// Package filestore provides a persistent store on an append-only log. Every
+// write is appended to the active segment of the log and an in-memory index
+// keeps the location and metadata of the latest record of each key, so reads
+// need a single disk access and listing doesn't decode the skipped items.
+// The index is rebuilt from the segments on open. A partially written record
+// at the end of the log is discarded, so the store recovers from crashes
+// during writes. The space used by overwritten and deleted records is
+// reclaimed by merging the older segments in the background.
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"go.uber.org/atomic"
+)
+
+const (
+	// reapInterval is the interval at which tombstones are written for the
+	// expired items
+	reapInterval = time.Second
+
+	defaultSegmentSize     = 64 << 20
+	defaultCompactInterval = time.Minute
+	defaultCompactRatio    = 0.5
+)
+
+// Options configure the store. Zero values use the defaults
+type Options struct {
+	// SegmentSize is the size after which writes go to a new segment.
+	// Default is 64MB
+	SegmentSize int64
+	// CompactInterval is the interval at which the segments are checked for
+	// compaction. Default is 1 minute
+	CompactInterval time.Duration
+	// CompactRatio is the fraction of the space in the older segments used by
+	// stale records after which they are compacted. Default is 0.5
+	CompactRatio float64
+	// SyncWrites syncs the segment to the disk after every write. Without it
+	// the last few writes can be lost on a machine crash
+	SyncWrites bool
+}
+
+// Compacter is implemented by the store returned by New. Compact merges all
+// the segments written so far, instead of waiting for the background
+// compaction
+type Compacter interface {
+	Compact() error
+}
+
+// itemMeta is the information maintained for each key apart from the
+// serialized item. It is stored along with each record, so the indexes can
+// be rebuilt without unmarshaling the items
+type itemMeta struct {
+	Namespace string            `json:"n"`
+	ID        string            `json:"i"`
+	Version   int64             `json:"v,omitempty"`
+	Expiry    int64             `json:"e,omitempty"`
+	TimeTrack bool              `json:"t,omitempty"`
+	Created   int64             `json:"c,omitempty"`
+	Updated   int64             `json:"u,omitempty"`
+	Indexes   map[string]string `json:"x,omitempty"`
+}
+
+func (m *itemMeta) key() string {
+	return "/" + m.Namespace + "/" + m.ID
+}
+
+func (m *itemMeta) expired(now int64) bool {
+	return m.Expiry != 0 && m.Expiry <= now
+}
+
+// entry is the location of the latest record of a key
+type entry struct {
+	meta   *itemMeta
+	seg    uint64
+	offset int64
+	vsize  int64
+	size   int64
+}
+
+type fileStore struct {
+	mu       sync.RWMutex
+	nonce    atomic.Int64
+	dir      string
+	opts     Options
+	segments map[uint64]*segment
+	active   *segment
+	// dead is the size of the stale records in each segment
+	dead     map[uint64]int64
+	keydir   map[string]map[string]*entry
+	expiring map[*entry]struct{}
+	closed   bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New opens the store in the directory, creating it if required. Background
+// routines remove the expired items and compact the segments, which are
+// stopped on Close. The store is not usable after Close
+func New(dir string, opts Options) (gkvstore.Store, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.CompactInterval <= 0 {
+		opts.CompactInterval = defaultCompactInterval
+	}
+	if opts.CompactRatio <= 0 {
+		opts.CompactRatio = defaultCompactRatio
+	}
+	st := &fileStore{
+		dir:      dir,
+		opts:     opts,
+		segments: make(map[uint64]*segment),
+		dead:     make(map[uint64]int64),
+		keydir:   make(map[string]map[string]*entry),
+		expiring: make(map[*entry]struct{}),
+		stop:     make(chan struct{}),
+	}
+	if err := st.open(); err != nil {
+		st.closeSegments()
+		return nil, fmt.Errorf("filestore: failed opening %s: %w", dir, err)
+	}
+	st.wg.Add(2)
+	go st.reaper()
+	go st.compactor()
+	return st, nil
+}
+
+// open rebuilds the index from the segments. Only the last segment can have
+// a partially written record, which is truncated
+func (f *fileStore) open() error {
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	if err := recoverCompaction(f.dir); err != nil {
+		return err
+	}
+	ids, err := segmentIDs(f.dir)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		ids = append(ids, 1)
+	}
+	for idx, id := range ids {
+		seg, err := openSegment(f.dir, id)
+		if err != nil {
+			return err
+		}
+		f.segments[id] = seg
+		end, err := seg.scan(func(rec record) error {
+			f.apply(id, rec)
+			return nil
+		})
+		if errors.Is(err, errCorrupted) && idx == len(ids)-1 {
+			if err := seg.f.Truncate(end); err != nil {
+				return err
+			}
+			seg.size, err = end, nil
+		}
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", id, err)
+		}
+	}
+	f.active = f.segments[ids[len(ids)-1]]
+	return nil
+}
+
+// apply updates the index with a record read from the segment
+func (f *fileStore) apply(id uint64, rec record) {
+	m := rec.meta
+	if rec.op == opDelete {
+		f.dead[id] += rec.size
+		f.unsetEntry(m.Namespace, m.ID)
+		return
+	}
+	if n, err := strconv.ParseInt(m.ID, 10, 64); err == nil && n > f.nonce.Load() {
+		f.nonce.Store(n)
+	}
+	f.setEntry(&entry{
+		meta:   m,
+		seg:    id,
+		offset: rec.offset,
+		vsize:  int64(len(rec.val)),
+		size:   rec.size,
+	})
+}
+
+func (f *fileStore) setEntry(e *entry) {
+	ids, found := f.keydir[e.meta.Namespace]
+	if !found {
+		ids = make(map[string]*entry)
+		f.keydir[e.meta.Namespace] = ids
+	}
+	if old, found := ids[e.meta.ID]; found {
+		f.dead[old.seg] += old.size
+		delete(f.expiring, old)
+	}
+	ids[e.meta.ID] = e
+	if e.meta.Expiry != 0 {
+		f.expiring[e] = struct{}{}
+	}
+}
+
+func (f *fileStore) unsetEntry(ns, id string) {
+	old, found := f.keydir[ns][id]
+	if !found {
+		return
+	}
+	f.dead[old.seg] += old.size
+	delete(f.expiring, old)
+	delete(f.keydir[ns], id)
+	if len(f.keydir[ns]) == 0 {
+		delete(f.keydir, ns)
+	}
+}
+
+// write appends the record to the active segment, starting a new segment if
+// the active one is full. It has to be called with the lock held
+func (f *fileStore) write(op byte, m *itemMeta, val []byte) (*entry, error) {
+	buf, err := encodeRecord(op, m, val)
+	if err != nil {
+		return nil, err
+	}
+	if f.active.size >= f.opts.SegmentSize {
+		if err := f.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	seg := f.active
+	// A failed write can leave a partial record, which is overwritten by the
+	// next one as the size is not updated
+	if _, err := seg.f.WriteAt(buf, seg.size); err != nil {
+		return nil, err
+	}
+	if f.opts.SyncWrites {
+		if err := seg.f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	e := &entry{
+		meta:   m,
+		seg:    seg.id,
+		offset: seg.size + int64(len(buf)-len(val)),
+		vsize:  int64(len(val)),
+		size:   int64(len(buf)),
+	}
+	seg.size += e.size
+	return e, nil
+}
+
+// rotate seals the active segment and starts a new one
+func (f *fileStore) rotate() error {
+	if err := f.active.f.Sync(); err != nil {
+		return err
+	}
+	seg, err := openSegment(f.dir, f.active.id+1)
+	if err != nil {
+		return err
+	}
+	f.segments[seg.id] = seg
+	f.active = seg
+	return nil
+}
+
+func (f *fileStore) put(m *itemMeta, val []byte) error {
+	e, err := f.write(opPut, m, val)
+	if err != nil {
+		return err
+	}
+	f.setEntry(e)
+	return nil
+}
+
+// remove writes a tombstone for the key if it exists. The tombstone is stale
+// as soon as the older records of the key are compacted
+func (f *fileStore) remove(ns, id string) error {
+	if _, found := f.keydir[ns][id]; !found {
+		return nil
+	}
+	e, err := f.write(opDelete, &itemMeta{Namespace: ns, ID: id}, nil)
+	if err != nil {
+		return err
+	}
+	f.dead[e.seg] += e.size
+	f.unsetEntry(ns, id)
+	return nil
+}
+
+// get returns the entry if the key exists and is not expired. Expired items
+// are removed by the reaper, till then they are treated as non-existent
+func (f *fileStore) get(ns, id string) (*entry, bool) {
+	e, found := f.keydir[ns][id]
+	if !found || e.meta.expired(time.Now().UnixNano()) {
+		return nil, false
+	}
+	return e, true
+}
+
+func (f *fileStore) value(e *entry) ([]byte, error) {
+	buf := make([]byte, e.vsize)
+	if _, err := f.segments[e.seg].f.ReadAt(buf, e.offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (f *fileStore) Create(ctx context.Context, item gkvstore.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrStoreClosed)
+	}
+
+	if ids, ok := item.(gkvstore.IDSetter); ok {
+		ids.SetID(fmt.Sprintf("%d", f.nonce.Inc()))
+	}
+
+	if _, found := f.get(item.GetNamespace(), item.GetID()); found {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrRecordAlreadyExists)
+	}
+
+	m := &itemMeta{
+		Namespace: item.GetNamespace(),
+		ID:        item.GetID(),
+		Version:   1,
+		Expiry:    gkvstore.ItemExpiry(item),
+		Indexes:   gkvstore.ItemIndexes(item),
+	}
+
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		tt.SetCreated(timestamp)
+		tt.SetUpdated(timestamp)
+		m.TimeTrack = true
+		m.Created = timestamp
+		m.Updated = timestamp
+	}
+
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(1)
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return gkvstore.WrapError("Create", item, err)
+	}
+
+	return gkvstore.WrapError("Create", item, f.put(m, itemBuf))
+}
+
+func (f *fileStore) Read(ctx context.Context, item gkvstore.Item) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrStoreClosed)
+	}
+
+	e, found := f.get(item.GetNamespace(), item.GetID())
+	if !found {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+	}
+	buf, err := f.value(e)
+	if err != nil {
+		return gkvstore.WrapError("Read", item, err)
+	}
+	return gkvstore.WrapError("Read", item, item.Unmarshal(buf))
+}
+
+func (f *fileStore) Update(ctx context.Context, item gkvstore.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrStoreClosed)
+	}
+
+	old, exists := f.get(item.GetNamespace(), item.GetID())
+
+	var version int64
+	if exists {
+		version = old.meta.Version
+	}
+	v, versioned := item.(gkvstore.Versioned)
+	if versioned && v.GetVersion() != version {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrVersionConflict)
+	}
+
+	m := &itemMeta{
+		Namespace: item.GetNamespace(),
+		ID:        item.GetID(),
+		Version:   version + 1,
+		Expiry:    gkvstore.ItemExpiry(item),
+		Indexes:   gkvstore.ItemIndexes(item),
+	}
+
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		if exists && old.meta.TimeTrack {
+			tt.SetCreated(old.meta.Created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
+		tt.SetUpdated(timestamp)
+		m.TimeTrack = true
+		m.Created = tt.GetCreated()
+		m.Updated = timestamp
+	}
+
+	if versioned {
+		v.SetVersion(version + 1)
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return gkvstore.WrapError("Update", item, err)
+	}
+
+	return gkvstore.WrapError("Update", item, f.put(m, itemBuf))
+}
+
+func (f *fileStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return gkvstore.WrapError("Delete", item, gkvstore.ErrStoreClosed)
+	}
+
+	return gkvstore.WrapError("Delete", item, f.remove(item.GetNamespace(), item.GetID()))
+}
+
+func (f *fileStore) reaper() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.reap()
+		}
+	}
+}
+
+// reap removes the expired items. Failed removals are retried on the next
+// run
+func (f *fileStore) reap() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	for e := range f.expiring {
+		if e.meta.expired(now) {
+			if err := f.remove(e.meta.Namespace, e.meta.ID); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (f *fileStore) closeSegments() error {
+	var firstErr error
+	for _, seg := range f.segments {
+		if seg == f.active {
+			if err := seg.f.Sync(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if err := seg.f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close stops the background routines and closes the segments
+func (f *fileStore) Close() error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	return f.closeSegments()
+}
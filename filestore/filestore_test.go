@@ -0,0 +1,215 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/filestore"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func TestSuite(t *testing.T) {
+	st, err := filestore.New(t.TempDir(), filestore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testsuite.RunTestsuite(t, st, testsuite.Advanced)
+}
+
+func BenchmarkSuite(b *testing.B) {
+	st, err := filestore.New(b.TempDir(), filestore.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer st.Close()
+
+	testsuite.BenchmarkSuite(b, st)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+func newDocument(id int) gkvstore.Item {
+	return autoencoding.MustNew(&document{Id: fmt.Sprintf("%03d", id)})
+}
+
+// populate creates the documents and updates the even ones. Every third
+// document is deleted
+func populate(t *testing.T, st gkvstore.Store, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		doc := &document{Id: fmt.Sprintf("%03d", i), Text: "created"}
+		if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i += 2 {
+		doc := &document{Id: fmt.Sprintf("%03d", i), Text: "updated"}
+		if err := st.Update(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i += 3 {
+		if err := st.Delete(context.TODO(), newDocument(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func verify(t *testing.T, st gkvstore.Store, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		doc := &document{Id: fmt.Sprintf("%03d", i)}
+		err := st.Read(context.TODO(), autoencoding.MustNew(doc))
+		if i%3 == 0 {
+			if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+				t.Fatal("expected deleted document", doc.Id, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (i%2 == 0) != (doc.Text == "updated") {
+			t.Fatal("incorrect document", doc)
+		}
+		if doc.Created == 0 || doc.Updated < doc.Created {
+			t.Fatal("incorrect timestamps", doc)
+		}
+	}
+
+	res, err := st.List(
+		context.TODO(),
+		func() gkvstore.Item { return autoencoding.MustNew(&document{}) },
+		gkvstore.ListOpt{Sort: gkvstore.SortUpdatedAsc},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last int64
+	listed := 0
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		doc := r.Val.(autoencoding.ObjectGetter).Get().(*document)
+		if doc.Updated < last {
+			t.Fatal("incorrect order", doc)
+		}
+		last = doc.Updated
+		listed++
+	}
+	if listed != count-(count+2)/3 {
+		t.Fatal("incorrect no of documents", listed)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := filestore.New(dir, filestore.Options{SegmentSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	populate(t, st, 30)
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), newDocument(1)); !errors.Is(err, gkvstore.ErrStoreClosed) {
+		t.Fatal("expected store closed error", err)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) < 2 {
+		t.Fatal("expected multiple segments", len(segments))
+	}
+
+	// Partially written record at the end of the log
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0xde, 0xad, 0xbe, 0xef, 1, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	st, err = filestore.New(dir, filestore.Options{SegmentSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	verify(t, st, 30)
+
+	doc := &document{Id: "030", Text: "created"}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), newDocument(30)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	st, err := filestore.New(dir, filestore.Options{SegmentSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	populate(t, st, 30)
+
+	before, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.(filestore.Compacter).Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Merged segment and the new active segment
+	if len(after) != 2 || len(before) <= len(after) {
+		t.Fatal("incorrect no of segments", len(before), len(after))
+	}
+	verify(t, st, 30)
+
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupted compaction leaves the incomplete merged segment
+	err = os.WriteFile(filepath.Join(dir, "00000001.merge"), []byte("incomplete"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err = filestore.New(dir, filestore.Options{SegmentSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	verify(t, st, 30)
+	if _, err := os.Stat(filepath.Join(dir, "00000001.merge")); !os.IsNotExist(err) {
+		t.Fatal("expected incomplete segment to be removed", err)
+	}
+}
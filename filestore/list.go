@@ -0,0 +1,294 @@
+package filestore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// listEntry is the position of a key in the listing order. index is the
+// timestamp for the timetracker sorts and value is the secondary index value
+// if an IndexQuery is used with the natural order
+type listEntry struct {
+	key   string
+	id    string
+	index int64
+	value string
+}
+
+// after checks if the entry comes after the cursor position in the listing
+// order
+func (e listEntry) after(c listEntry, desc bool) bool {
+	if e.index != c.index {
+		return (e.index > c.index) != desc
+	}
+	if e.value != c.value {
+		return (e.value > c.value) != desc
+	}
+	return e.key != c.key && (e.key > c.key) != desc
+}
+
+func (e listEntry) cursor(s gkvstore.Sort) string {
+	return gkvstore.Cursor{Sort: s, Index: e.index, Value: e.value, Key: []byte(e.key)}.Encode()
+}
+
+// entries returns the keys of the namespace in the listing order of the
+// options, starting after the cursor if provided. The order is computed from
+// the in-memory index, so no items are read from the disk
+func (f *fileStore) entries(ns string, opts gkvstore.ListOpt) ([]listEntry, error) {
+	var start listEntry
+	if opts.Cursor != "" {
+		c, err := gkvstore.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		start = listEntry{key: string(c.Key), index: c.Index, value: c.Value}
+	}
+
+	var desc, timeSort bool
+	switch opts.Sort {
+	case gkvstore.SortNatural, gkvstore.SortIDAsc:
+	case gkvstore.SortIDDesc:
+		desc = true
+	case gkvstore.SortCreatedAsc, gkvstore.SortUpdatedAsc:
+		timeSort = true
+	case gkvstore.SortCreatedDesc, gkvstore.SortUpdatedDesc:
+		timeSort, desc = true, true
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+
+	now := time.Now().UnixNano()
+	entries := make([]listEntry, 0, len(f.keydir[ns]))
+	for id, e := range f.keydir[ns] {
+		m := e.meta
+		if m.expired(now) || m.Version < opts.Version || !opts.MatchID(id) {
+			continue
+		}
+		if timeSort && !m.TimeTrack {
+			continue
+		}
+		le := listEntry{key: m.key(), id: id}
+		if opts.Index.Name != "" {
+			val, found := m.Indexes[opts.Index.Name]
+			if !found || !opts.Index.Match(val) {
+				continue
+			}
+			// Natural order with index query is the order of the index values
+			if opts.Sort == gkvstore.SortNatural {
+				le.value = val
+			}
+		}
+		switch opts.Sort {
+		case gkvstore.SortCreatedAsc, gkvstore.SortCreatedDesc:
+			le.index = m.Created
+		case gkvstore.SortUpdatedAsc, gkvstore.SortUpdatedDesc:
+			le.index = m.Updated
+		}
+		entries = append(entries, le)
+	}
+
+	// An entry comes after the other in descending order if it is smaller
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].after(entries[b], true)
+	})
+	if desc {
+		for a, b := 0, len(entries)-1; a < b; a, b = a+1, b-1 {
+			entries[a], entries[b] = entries[b], entries[a]
+		}
+	}
+
+	if opts.Cursor != "" {
+		idx := sort.Search(len(entries), func(idx int) bool {
+			return entries[idx].after(start, desc)
+		})
+		entries = entries[idx:]
+	}
+	return entries, nil
+}
+
+// lookup returns the item buffer if the key is present and matches the version
+// in the list options
+func (f *fileStore) lookup(ns, id string, opts gkvstore.ListOpt) ([]byte, bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, false, gkvstore.ErrStoreClosed
+	}
+
+	e, found := f.get(ns, id)
+	if !found || e.meta.Version < opts.Version {
+		return nil, false, nil
+	}
+	buf, err := f.value(e)
+	return buf, true, err
+}
+
+func (f *fileStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	entries, err := f.entries(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+
+	skip := opts.Page * opts.Limit
+	if opts.Cursor != "" {
+		skip = 0
+	}
+	res := make(chan *gkvstore.Result)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		for _, e := range entries {
+			// Skipped items are not read unless they have to be filtered
+			if skip > 0 && opts.Filter == nil {
+				skip--
+				continue
+			}
+			val, found, err := f.lookup(ns, e.id, opts)
+			if !found && err == nil {
+				// best effort continue
+				continue
+			}
+			it := factory()
+			if err == nil {
+				err = it.Unmarshal(val)
+			}
+			if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case res <- &gkvstore.Result{Val: it, Err: err, Cursor: e.cursor(opts.Sort)}:
+				count++
+			}
+			if int64(count) == opts.Limit {
+				return
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+func (f *fileStore) ListKeys(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.KeyResult, error) {
+
+	ns := factory().GetNamespace()
+	entries, err := f.entries(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+	}
+
+	skip := opts.Page * opts.Limit
+	if opts.Cursor != "" {
+		skip = 0
+	}
+	res := make(chan *gkvstore.KeyResult)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		for _, e := range entries {
+			var err error
+			if opts.Filter != nil {
+				val, found, lerr := f.lookup(ns, e.id, opts)
+				if !found && lerr == nil {
+					continue
+				}
+				err = lerr
+				if err == nil {
+					it := factory()
+					err = it.Unmarshal(val)
+					if err == nil && !opts.Filter.Compare(it) {
+						continue
+					}
+				}
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			kr := &gkvstore.KeyResult{
+				Key:    gkvstore.Key{Namespace: ns, ID: e.id},
+				Err:    err,
+				Cursor: e.cursor(opts.Sort),
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case res <- kr:
+				count++
+			}
+			if int64(count) == opts.Limit {
+				return
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+// Count uses the in-memory index to count the items. Items are read only if
+// a Filter is provided
+func (f *fileStore) Count(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (int64, error) {
+
+	ns := factory().GetNamespace()
+	opts.Sort, opts.Cursor = gkvstore.SortNatural, ""
+	entries, err := f.entries(ns, opts)
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+	if opts.Filter == nil {
+		return int64(len(entries)), nil
+	}
+
+	var count int64
+	for _, e := range entries {
+		val, found, err := f.lookup(ns, e.id, opts)
+		if err != nil {
+			return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+		}
+		if !found {
+			continue
+		}
+		it := factory()
+		if err := it.Unmarshal(val); err != nil {
+			return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+		}
+		if opts.Filter.Compare(it) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ListNamespaces is answered from the keydir, so no segment is read. A
+// namespace is listed while it has a key which is not expired
+func (f *fileStore) ListNamespaces(_ context.Context) ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+
+	now := time.Now().UnixNano()
+	var namespaces []string
+	for ns, ids := range f.keydir {
+		for _, e := range ids {
+			if !e.meta.expired(now) {
+				namespaces = append(namespaces, ns)
+				break
+			}
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// DropNamespace writes tombstones for all the items in the namespace
+func (f *fileStore) DropNamespace(_ context.Context, ns string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return gkvstore.WrapNamespaceError("DropNamespace", ns, gkvstore.ErrStoreClosed)
+	}
+
+	for id := range f.keydir[ns] {
+		if err := f.remove(ns, id); err != nil {
+			return gkvstore.WrapNamespaceError("DropNamespace", ns, err)
+		}
+	}
+	return nil
+}
+
+func (f *fileStore) NamespaceStats(_ context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stats := gkvstore.NamespaceStats{Namespace: ns}
+	if f.closed {
+		return stats, gkvstore.WrapNamespaceError("NamespaceStats", ns, gkvstore.ErrStoreClosed)
+	}
+
+	now := time.Now().UnixNano()
+	for _, e := range f.keydir[ns] {
+		if e.meta.expired(now) {
+			continue
+		}
+		stats.Items++
+		stats.Size += e.vsize
+		if e.meta.TimeTrack && e.meta.Updated > stats.LastUpdated {
+			stats.LastUpdated = e.meta.Updated
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,165 @@
+package filestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Records are stored in the segments as
+//
+//	crc (4) | op (1) | meta length (4) | value length (4) | meta | value
+//
+// The checksum covers everything after it. The meta is the JSON encoded
+// itemMeta which carries the key, so the index can be rebuilt without
+// decoding the items.
+const (
+	opPut    byte = 1
+	opDelete byte = 2
+
+	headerSize = 13
+
+	segmentExt = ".log"
+	mergeExt   = ".merge"
+	// compactMarker lists the segments to be removed after the merged segment
+	// is in place. It is used to finish an interrupted compaction on open
+	compactMarker = "COMPACT"
+)
+
+var errCorrupted = errors.New("corrupted record")
+
+type segment struct {
+	id   uint64
+	f    *os.File
+	size int64
+}
+
+// record is a decoded record. offset is the position of the value in the
+// segment and size is the total size of the record
+type record struct {
+	op     byte
+	meta   *itemMeta
+	val    []byte
+	offset int64
+	size   int64
+}
+
+func segmentPath(dir string, id uint64, ext string) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", id, ext))
+}
+
+func openSegment(dir string, id uint64) (*segment, error) {
+	f, err := os.OpenFile(segmentPath(dir, id, segmentExt), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{id: id, f: f, size: fi.Size()}, nil
+}
+
+// segmentIDs returns the IDs of the segments in the directory in ascending
+// order
+func segmentIDs(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids, nil
+}
+
+func sortIDs(ids []uint64) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
+
+func encodeRecord(op byte, m *itemMeta, val []byte) ([]byte, error) {
+	mbuf, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize+len(mbuf)+len(val))
+	buf[4] = op
+	binary.BigEndian.PutUint32(buf[5:], uint32(len(mbuf)))
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(val)))
+	copy(buf[headerSize:], mbuf)
+	copy(buf[headerSize+len(mbuf):], val)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	return buf, nil
+}
+
+// scan reads the records of the segment in order. It returns the offset after
+// the last valid record. If the segment has a partial or corrupted record,
+// errCorrupted is returned along with the offset
+func (s *segment) scan(fn func(record) error) (int64, error) {
+	r := bufio.NewReaderSize(io.NewSectionReader(s.f, 0, s.size), 64*1024)
+	hdr := make([]byte, headerSize)
+
+	var offset int64
+	for {
+		if _, err := io.ReadFull(r, hdr); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, errCorrupted
+			}
+			return offset, err
+		}
+		op := hdr[4]
+		mlen := int64(binary.BigEndian.Uint32(hdr[5:]))
+		vlen := int64(binary.BigEndian.Uint32(hdr[9:]))
+		if (op != opPut && op != opDelete) || offset+headerSize+mlen+vlen > s.size {
+			return offset, errCorrupted
+		}
+		body := make([]byte, mlen+vlen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return offset, errCorrupted
+		}
+		crc := crc32.NewIEEE()
+		_, _ = crc.Write(hdr[4:])
+		_, _ = crc.Write(body)
+		if crc.Sum32() != binary.BigEndian.Uint32(hdr) {
+			return offset, errCorrupted
+		}
+		m := &itemMeta{}
+		if err := json.Unmarshal(body[:mlen], m); err != nil {
+			return offset, errCorrupted
+		}
+		rec := record{
+			op:     op,
+			meta:   m,
+			val:    body[mlen:],
+			offset: offset + headerSize + mlen,
+			size:   headerSize + mlen + vlen,
+		}
+		if err := fn(rec); err != nil {
+			return offset, err
+		}
+		offset += rec.size
+	}
+}
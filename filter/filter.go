@@ -0,0 +1,246 @@
+package filter
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+)
+
+// Func is an adapter to use ordinary functions as filters
+type Func func(gkvstore.Item) bool
+
+// Compare calls f(i)
+func (f Func) Compare(i gkvstore.Item) bool {
+	return f(i)
+}
+
+// And matches the items which match all the filters
+func And(filters ...gkvstore.ItemFilter) gkvstore.ItemFilter {
+	return Func(func(i gkvstore.Item) bool {
+		for _, f := range filters {
+			if !f.Compare(i) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Or matches the items which match any of the filters
+func Or(filters ...gkvstore.ItemFilter) gkvstore.ItemFilter {
+	return Func(func(i gkvstore.Item) bool {
+		for _, f := range filters {
+			if f.Compare(i) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Not matches the items which do not match the filter
+func Not(f gkvstore.ItemFilter) gkvstore.ItemFilter {
+	return Func(func(i gkvstore.Item) bool {
+		return !f.Compare(i)
+	})
+}
+
+// Eq matches the items where the field is equal to the value
+func Eq(field string, val interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		return equal(fv, val)
+	})
+}
+
+// Ne matches the items where the field is not equal to the value. Items
+// without the field do not match
+func Ne(field string, val interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		return !equal(fv, val)
+	})
+}
+
+// Lt matches the items where the field is less than the value. Only numbers
+// and strings can be compared
+func Lt(field string, val interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		res, ok := compare(fv, reflect.ValueOf(val))
+		return ok && res < 0
+	})
+}
+
+// Gt matches the items where the field is greater than the value. Only
+// numbers and strings can be compared
+func Gt(field string, val interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		res, ok := compare(fv, reflect.ValueOf(val))
+		return ok && res > 0
+	})
+}
+
+// In matches the items where the field is equal to any of the values
+func In(field string, vals ...interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		for _, v := range vals {
+			if equal(fv, v) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Contains matches the items where the string field contains the value as
+// substring or the slice field contains the value as an element
+func Contains(field string, val interface{}) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		switch fv.Kind() {
+		case reflect.String:
+			s, ok := val.(string)
+			return ok && strings.Contains(fv.String(), s)
+		case reflect.Slice, reflect.Array:
+			for idx := 0; idx < fv.Len(); idx++ {
+				if equal(fv.Index(idx), val) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Regex matches the items where the string field matches the expression
+func Regex(field string, re *regexp.Regexp) gkvstore.ItemFilter {
+	return fieldFilter(field, func(fv reflect.Value) bool {
+		return fv.Kind() == reflect.String && re.MatchString(fv.String())
+	})
+}
+
+// fieldFilter resolves the field on the item and uses the predicate on it.
+// For autoencoding items, the field is resolved on the wrapped value. Nested
+// fields can be accessed using '.' separated names
+func fieldFilter(field string, pred func(reflect.Value) bool) gkvstore.ItemFilter {
+	path := strings.Split(field, ".")
+	return Func(func(i gkvstore.Item) bool {
+		var val interface{} = i
+		if og, ok := i.(autoencoding.ObjectGetter); ok {
+			val = og.Get()
+		}
+		fv, found := lookup(reflect.ValueOf(val), path)
+		if !found {
+			return false
+		}
+		return pred(fv)
+	})
+}
+
+func lookup(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, name := range path {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return reflect.Value{}, false
+		}
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+func equal(fv reflect.Value, val interface{}) bool {
+	if res, ok := compare(fv, reflect.ValueOf(val)); ok {
+		return res == 0
+	}
+	return fv.CanInterface() && reflect.DeepEqual(fv.Interface(), val)
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater than b.
+// Numbers of different kinds are compared by their values
+func compare(a, b reflect.Value) (int, bool) {
+	switch {
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+	case isInt(a) && isInt(b):
+		return cmpInt(a.Int(), b.Int()), true
+	case isUint(a) && isUint(b):
+		return cmpUint(a.Uint(), b.Uint()), true
+	case isNumber(a) && isNumber(b):
+		return cmpFloat(toFloat(a), toFloat(b)), true
+	}
+	return 0, false
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	return isInt(v) || isUint(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v):
+		return float64(v.Int())
+	case isUint(v):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package filter_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/filter"
+	"github.com/plexsysio/gkvstore/inmem"
+)
+
+type address struct {
+	City string
+}
+
+type user struct {
+	Id      string
+	Name    string
+	Age     int
+	Score   float64
+	Tags    []string
+	Address *address
+}
+
+func TestPredicates(t *testing.T) {
+	it := autoencoding.MustNew(&user{
+		Id:      "1",
+		Name:    "alice",
+		Age:     30,
+		Score:   4.5,
+		Tags:    []string{"admin", "dev"},
+		Address: &address{City: "Berlin"},
+	})
+
+	for _, tc := range []struct {
+		name  string
+		f     gkvstore.ItemFilter
+		match bool
+	}{
+		{"eq", filter.Eq("Name", "alice"), true},
+		{"eq other type", filter.Eq("Age", int64(30)), true},
+		{"eq mismatch", filter.Eq("Name", "bob"), false},
+		{"eq missing field", filter.Eq("Email", "alice"), false},
+		{"ne", filter.Ne("Name", "bob"), true},
+		{"ne missing field", filter.Ne("Email", "bob"), false},
+		{"lt", filter.Lt("Age", 31), true},
+		{"lt equal", filter.Lt("Age", 30), false},
+		{"gt float", filter.Gt("Score", 4), true},
+		{"gt string", filter.Gt("Name", "bob"), false},
+		{"lt incomparable", filter.Lt("Name", 10), false},
+		{"in", filter.In("Age", 10, 20, 30), true},
+		{"in mismatch", filter.In("Name", "bob", "carol"), false},
+		{"contains substring", filter.Contains("Name", "lic"), true},
+		{"contains element", filter.Contains("Tags", "dev"), true},
+		{"contains missing element", filter.Contains("Tags", "ops"), false},
+		{"regex", filter.Regex("Name", regexp.MustCompile("^a.*e$")), true},
+		{"regex non string", filter.Regex("Age", regexp.MustCompile(".*")), false},
+		{"nested", filter.Eq("Address.City", "Berlin"), true},
+		{"and", filter.And(filter.Eq("Name", "alice"), filter.Gt("Age", 18)), true},
+		{"and mismatch", filter.And(filter.Eq("Name", "alice"), filter.Gt("Age", 40)), false},
+		{"or", filter.Or(filter.Eq("Name", "bob"), filter.Gt("Age", 18)), true},
+		{"or mismatch", filter.Or(filter.Eq("Name", "bob"), filter.Gt("Age", 40)), false},
+		{"not", filter.Not(filter.Eq("Name", "bob")), true},
+	} {
+		if tc.f.Compare(it) != tc.match {
+			t.Fatalf("%s: expected match %t", tc.name, tc.match)
+		}
+	}
+
+	t.Run("nil nested", func(st *testing.T) {
+		it := autoencoding.MustNew(&user{Id: "2", Name: "bob"})
+		if filter.Eq("Address.City", "Berlin").Compare(it) {
+			st.Fatal("expected no match for nil nested field")
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	s := inmem.New()
+	defer s.Close()
+
+	for _, u := range []*user{
+		{Name: "alice", Age: 30},
+		{Name: "bob", Age: 17},
+		{Name: "carol", Age: 45},
+		{Name: "dave", Age: 25},
+	} {
+		err := s.Create(context.TODO(), autoencoding.MustNew(u))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := s.List(
+		context.TODO(),
+		func() gkvstore.Item { return autoencoding.MustNew(&user{}) },
+		gkvstore.ListOpt{
+			Filter: filter.And(
+				filter.Gt("Age", 18),
+				filter.Not(filter.In("Name", "carol")),
+			),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		names[r.Val.(autoencoding.ObjectGetter).Get().(*user).Name] = true
+	}
+	if len(names) != 2 || !names["alice"] || !names["dave"] {
+		t.Fatalf("unexpected results %v", names)
+	}
+}
@@ -0,0 +1,22 @@
+package gkvstore
+
+import "context"
+
+type (
+	// Revision describes a version of the item retained by the store. Updated
+	// is the TimeTracker Updated timestamp of the item if available, else the
+	// time of the write
+	Revision struct {
+		Revision int64
+		Updated  int64
+		Deleted  bool
+	}
+
+	// HistoryKeeper interface is implemented by stores which retain the
+	// previous versions of the items. History returns the retained revisions
+	// from oldest to newest and ReadAt reads the item at the revision
+	HistoryKeeper interface {
+		History(context.Context, Item) ([]Revision, error)
+		ReadAt(context.Context, Item, int64) error
+	}
+)
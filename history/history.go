@@ -0,0 +1,309 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"go.uber.org/multierr"
+)
+
+// ErrRevisionNotRecorded is returned along with the cause if the item was
+// written to a store which is not Transactional, but its revision could not be
+// recorded. The write is not rolled back in this case
+var ErrRevisionNotRecorded = errors.New("item written but revision not recorded")
+
+// historySuffix is added to the namespace of the item to get the namespace
+// holding its revisions. These namespaces are not listed by ListNamespaces and
+// are dropped along with the namespace of the items
+const historySuffix = ".history"
+
+// Options configure the retention of the revisions. Revisions beyond the
+// latest MaxRevisions or older than MaxAge are removed on the next write. Zero
+// value disables the respective limit. Latest revision is always retained
+type Options struct {
+	MaxRevisions int
+	MaxAge       time.Duration
+}
+
+// revisionLog is the head of the revisions of an item. Each revision is a
+// separate record, so a write only adds the new revision and removes the
+// pruned ones. Revisions from First to Latest are retained
+type revisionLog struct {
+	namespace string
+	id        string
+
+	First  int64
+	Latest int64
+	// Deleted is set if the item was deleted in the latest revision
+	Deleted bool
+}
+
+func newLog(item gkvstore.Item) *revisionLog {
+	return &revisionLog{
+		namespace: item.GetNamespace() + historySuffix,
+		id:        item.GetID(),
+	}
+}
+
+func (l *revisionLog) GetNamespace() string { return l.namespace }
+
+// GetID ends with the separator used by the revisions. The part before the
+// last '/' is the item ID, so the head and the revisions of different items
+// cannot have the same ID
+func (l *revisionLog) GetID() string { return l.id + "/" }
+
+func (l *revisionLog) Marshal() ([]byte, error) { return json.Marshal(l) }
+
+func (l *revisionLog) Unmarshal(buf []byte) error { return json.Unmarshal(buf, l) }
+
+func (l *revisionLog) revision(rev int64) *revision {
+	return &revision{
+		namespace: l.namespace,
+		id:        l.id,
+		Revision:  gkvstore.Revision{Revision: rev},
+	}
+}
+
+// revision is stored with the ID of the item followed by the revision no
+type revision struct {
+	namespace string
+	id        string
+
+	gkvstore.Revision
+	Data []byte `json:",omitempty"`
+}
+
+func (r *revision) GetNamespace() string { return r.namespace }
+
+func (r *revision) GetID() string { return fmt.Sprintf("%s/%d", r.id, r.Revision.Revision) }
+
+func (r *revision) Marshal() ([]byte, error) { return json.Marshal(r) }
+
+func (r *revision) Unmarshal(buf []byte) error { return json.Unmarshal(buf, r) }
+
+type historyStore struct {
+	gkvstore.Store
+
+	opts Options
+	// mu serializes the writes so the revision log is updated in the same
+	// order as the item
+	mu sync.Mutex
+}
+
+// New returns a store which retains the revisions of the items written to the
+// underlying store
+func New(st gkvstore.Store, opts Options) gkvstore.Store {
+	return &historyStore{
+		Store: st,
+		opts:  opts,
+	}
+}
+
+// writer is implemented by both the store and its transactions, so the item
+// and its revision log can be written the same way with or without one
+type writer interface {
+	Create(context.Context, gkvstore.Item) error
+	Read(context.Context, gkvstore.Item) error
+	Update(context.Context, gkvstore.Item) error
+	Delete(context.Context, gkvstore.Item) error
+}
+
+func readLog(ctx context.Context, w writer, item gkvstore.Item) (*revisionLog, bool, error) {
+	l := newLog(item)
+	err := w.Read(ctx, l)
+	switch {
+	case err == nil:
+		return l, true, nil
+	case errors.Is(err, gkvstore.ErrRecordNotFound):
+		return l, false, nil
+	}
+	return nil, false, err
+}
+
+// prune removes the revisions which are not retained anymore. Latest revision
+// is always retained
+func (h *historyStore) prune(ctx context.Context, w writer, l *revisionLog) error {
+	for ; h.opts.MaxRevisions > 0 && l.Latest-l.First >= int64(h.opts.MaxRevisions); l.First++ {
+		if err := w.Delete(ctx, l.revision(l.First)); err != nil {
+			return err
+		}
+	}
+	if h.opts.MaxAge > 0 {
+		cutoff := time.Now().Add(-h.opts.MaxAge).UnixNano()
+		for ; l.First < l.Latest; l.First++ {
+			r := l.revision(l.First)
+			err := w.Read(ctx, r)
+			switch {
+			case errors.Is(err, gkvstore.ErrRecordNotFound):
+				continue
+			case err != nil:
+				return err
+			}
+			if r.Updated >= cutoff {
+				break
+			}
+			if err := w.Delete(ctx, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// record adds the revision of the item
+func (h *historyStore) record(ctx context.Context, w writer, item gkvstore.Item, deleted bool) error {
+	l, exists, err := readLog(ctx, w, item)
+	if err != nil {
+		return err
+	}
+	if deleted && (!exists || l.Deleted) {
+		// Nothing to delete
+		return nil
+	}
+
+	if !exists {
+		l.First = 1
+	}
+	l.Latest++
+	l.Deleted = deleted
+	rev := l.revision(l.Latest)
+	rev.Updated = time.Now().UnixNano()
+	rev.Deleted = deleted
+	if !deleted {
+		rev.Data, err = item.Marshal()
+		if err != nil {
+			return err
+		}
+		if tt, ok := item.(gkvstore.TimeTracker); ok {
+			rev.Updated = tt.GetUpdated()
+		}
+	}
+	// Revision could be left behind by an earlier write which failed to
+	// update the head
+	if err := w.Update(ctx, rev); err != nil {
+		return err
+	}
+	if err := h.prune(ctx, w, l); err != nil {
+		return err
+	}
+
+	if exists {
+		return w.Update(ctx, l)
+	}
+	return w.Create(ctx, l)
+}
+
+// write applies the operation on the item and records the revision. If the
+// underlying store is Transactional, both are committed together. Otherwise
+// the revision is recorded after the operation and a failure to do so is
+// reported with ErrRevisionNotRecorded, as the item is already written
+func (h *historyStore) write(
+	ctx context.Context,
+	op string,
+	item gkvstore.Item,
+	deleted bool,
+	apply func(writer) error,
+) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ts, ok := h.Store.(gkvstore.Transactional); ok {
+		txn, err := ts.NewTransaction(ctx)
+		switch {
+		case err == nil:
+			defer txn.Discard(ctx)
+
+			if err := apply(txn); err != nil {
+				return err
+			}
+			if err := h.record(ctx, txn, item, deleted); err != nil {
+				return gkvstore.WrapError(op, item, err)
+			}
+			return txn.Commit(ctx)
+		case !errors.Is(err, gkvstore.ErrNotSupported):
+			return err
+		}
+	}
+
+	if err := apply(h.Store); err != nil {
+		return err
+	}
+	if err := h.record(ctx, h.Store, item, deleted); err != nil {
+		return gkvstore.WrapError(op, item, multierr.Append(ErrRevisionNotRecorded, err))
+	}
+	return nil
+}
+
+func (h *historyStore) Create(ctx context.Context, item gkvstore.Item) error {
+	return h.write(ctx, "Create", item, false, func(w writer) error {
+		return w.Create(ctx, item)
+	})
+}
+
+func (h *historyStore) Update(ctx context.Context, item gkvstore.Item) error {
+	return h.write(ctx, "Update", item, false, func(w writer) error {
+		return w.Update(ctx, item)
+	})
+}
+
+// Delete records a deleted revision, so the history of the item is retained
+// after it is deleted
+func (h *historyStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	return h.write(ctx, "Delete", item, true, func(w writer) error {
+		return w.Delete(ctx, item)
+	})
+}
+
+func (h *historyStore) History(ctx context.Context, item gkvstore.Item) ([]gkvstore.Revision, error) {
+	l, exists, err := readLog(ctx, h.Store, item)
+	if err != nil {
+		return nil, gkvstore.WrapError("History", item, err)
+	}
+	if !exists {
+		return nil, gkvstore.WrapError("History", item, gkvstore.ErrRecordNotFound)
+	}
+	items := make([]gkvstore.Item, 0, l.Latest-l.First+1)
+	for rev := l.First; rev <= l.Latest; rev++ {
+		items = append(items, l.revision(rev))
+	}
+	revs := make([]gkvstore.Revision, 0, len(items))
+	for idx, err := range gkvstore.ReadMany(ctx, h.Store, items) {
+		switch {
+		case errors.Is(err, gkvstore.ErrRecordNotFound):
+			// Revision was not recorded or the pruning was interrupted
+			continue
+		case err != nil:
+			return nil, gkvstore.WrapError("History", item, err)
+		}
+		revs = append(revs, items[idx].(*revision).Revision)
+	}
+	return revs, nil
+}
+
+// ReadAt reads the item at the revision. ErrRecordNotFound is returned if the
+// revision is not retained or the item was deleted in the revision
+func (h *historyStore) ReadAt(ctx context.Context, item gkvstore.Item, rev int64) error {
+	r := newLog(item).revision(rev)
+	if err := h.Store.Read(ctx, r); err != nil {
+		return gkvstore.WrapError("ReadAt", item, err)
+	}
+	if r.Deleted {
+		return gkvstore.WrapError("ReadAt", item, gkvstore.ErrRecordNotFound)
+	}
+	return gkvstore.WrapError("ReadAt", item, item.Unmarshal(r.Data))
+}
+
+// Features do not include Watch and Transactions. Events of the underlying
+// store include the revision records and writes done in its transactions
+// would not be recorded
+func (h *historyStore) Features() gkvstore.Features {
+	f := gkvstore.GetFeatures(h.Store)
+	f.Watch, f.Transactions = false, false
+	_, f.Namespaces = h.Store.(gkvstore.NamespaceManager)
+	return f
+}
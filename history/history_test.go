@@ -0,0 +1,234 @@
+package history_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/history"
+	"github.com/plexsysio/gkvstore/inmem"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func TestSuite(t *testing.T) {
+	testsuite.RunTestsuite(t, history.New(inmem.New(), history.Options{}), testsuite.Advanced)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+func TestHistory(t *testing.T) {
+	st := history.New(inmem.New(), history.Options{})
+	defer st.Close()
+
+	doc := &document{Id: "1", Text: "first"}
+	err := st.Create(context.TODO(), autoencoding.MustNew(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"second", "third"} {
+		doc.Text = text
+		err = st.Update(context.TODO(), autoencoding.MustNew(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = st.Delete(context.TODO(), autoencoding.MustNew(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hk := st.(gkvstore.HistoryKeeper)
+	revs, err := hk.History(context.TODO(), autoencoding.MustNew(&document{Id: "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 4 {
+		t.Fatal("incorrect no of revisions", len(revs))
+	}
+	for idx, r := range revs {
+		if r.Revision != int64(idx+1) || r.Deleted != (idx == 3) {
+			t.Fatal("incorrect revision", r)
+		}
+		if idx > 0 && r.Updated < revs[idx-1].Updated {
+			t.Fatal("revisions not in order of updated timestamps")
+		}
+	}
+
+	for rev, text := range map[int64]string{1: "first", 2: "second", 3: "third"} {
+		d := &document{Id: "1"}
+		err = hk.ReadAt(context.TODO(), autoencoding.MustNew(d), rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Text != text {
+			t.Fatal("incorrect value at revision", rev, d.Text)
+		}
+		if d.Updated != revs[rev-1].Updated {
+			t.Fatal("revision timestamp doesn't match updated timestamp")
+		}
+	}
+	err = hk.ReadAt(context.TODO(), autoencoding.MustNew(&document{Id: "1"}), 4)
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error for deleted revision", err)
+	}
+	_, err = hk.History(context.TODO(), autoencoding.MustNew(&document{Id: "2"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error for unknown item", err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	t.Run("MaxRevisions", func(t *testing.T) {
+		st := history.New(inmem.New(), history.Options{MaxRevisions: 2})
+		defer st.Close()
+
+		doc := &document{Id: "1"}
+		err := st.Create(context.TODO(), autoencoding.MustNew(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			err = st.Update(context.TODO(), autoencoding.MustNew(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		revs, err := st.(gkvstore.HistoryKeeper).History(context.TODO(), autoencoding.MustNew(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revs) != 2 || revs[0].Revision != 3 || revs[1].Revision != 4 {
+			t.Fatal("incorrect revisions retained", revs)
+		}
+		err = st.(gkvstore.HistoryKeeper).ReadAt(context.TODO(), autoencoding.MustNew(doc), 1)
+		if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+			t.Fatal("expected not found error for pruned revision", err)
+		}
+	})
+	t.Run("MaxAge", func(t *testing.T) {
+		st := history.New(inmem.New(), history.Options{MaxAge: 100 * time.Millisecond})
+		defer st.Close()
+
+		doc := &document{Id: "1"}
+		err := st.Create(context.TODO(), autoencoding.MustNew(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+		for i := 0; i < 2; i++ {
+			err = st.Update(context.TODO(), autoencoding.MustNew(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		revs, err := st.(gkvstore.HistoryKeeper).History(context.TODO(), autoencoding.MustNew(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revs) != 2 || revs[0].Revision != 2 {
+			t.Fatal("incorrect revisions retained", revs)
+		}
+	})
+}
+
+// failingLog fails the writes of the revision logs. Embedding only the Store
+// interface hides the transactions of the underlying store
+type failingLog struct {
+	gkvstore.Store
+}
+
+func (f failingLog) Create(ctx context.Context, item gkvstore.Item) error {
+	if strings.HasSuffix(item.GetNamespace(), ".history") {
+		return errors.New("log write failed")
+	}
+	return f.Store.Create(ctx, item)
+}
+
+func TestNonTransactional(t *testing.T) {
+	st := history.New(failingLog{inmem.New()}, history.Options{})
+	defer st.Close()
+
+	doc := &document{Id: "1", Text: "first"}
+	err := st.Create(context.TODO(), autoencoding.MustNew(doc))
+	if !errors.Is(err, history.ErrRevisionNotRecorded) {
+		t.Fatal("expected revision not recorded error", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "log write failed") {
+		t.Fatal("expected cause of the failed revision", err)
+	}
+	// Item is written even though the revision is not
+	err = st.Read(context.TODO(), autoencoding.MustNew(&document{Id: "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.(gkvstore.HistoryKeeper).History(context.TODO(), autoencoding.MustNew(doc))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error for lost revision", err)
+	}
+}
+
+func TestRevisionIDs(t *testing.T) {
+	st := history.New(inmem.New(), history.Options{})
+	defer st.Close()
+
+	// Revision 1 of "a" must not overlap with the item "a/1"
+	for _, id := range []string{"a", "a/1", "a/"} {
+		err := st.Create(context.TODO(), autoencoding.MustNew(&document{Id: id, Text: id}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"a", "a/1", "a/"} {
+		revs, err := st.(gkvstore.HistoryKeeper).History(context.TODO(), autoencoding.MustNew(&document{Id: id}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revs) != 1 {
+			t.Fatal("incorrect no of revisions", id, len(revs))
+		}
+		d := &document{Id: id}
+		err = st.(gkvstore.HistoryKeeper).ReadAt(context.TODO(), autoencoding.MustNew(d), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Text != id {
+			t.Fatal("incorrect value at revision", id, d.Text)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	st := history.New(inmem.New(), history.Options{})
+	defer st.Close()
+
+	doc := &document{Id: "1"}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+
+	nsStore := st.(gkvstore.NamespaceManager)
+	namespaces, err := nsStore.ListNamespaces(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 1 || namespaces[0] != "document" {
+		t.Fatal("history namespace listed", namespaces)
+	}
+
+	if err := nsStore.DropNamespace(context.TODO(), "document"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.(gkvstore.HistoryKeeper).History(context.TODO(), autoencoding.MustNew(doc))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected revisions to be dropped with the namespace", err)
+	}
+}
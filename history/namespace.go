@@ -0,0 +1,53 @@
+package history
+
+import (
+	"context"
+	"strings"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ListNamespaces hides the namespaces holding the revisions
+func (h *historyStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	nsStore, ok := h.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+	all, err := nsStore.ListNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := all[:0]
+	for _, ns := range all {
+		if !strings.HasSuffix(ns, historySuffix) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+// DropNamespace is not recorded as the deletion of the items. Their revisions
+// are dropped instead
+func (h *historyStore) DropNamespace(ctx context.Context, ns string) error {
+	nsStore, ok := h.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := nsStore.DropNamespace(ctx, ns); err != nil {
+		return err
+	}
+	return nsStore.DropNamespace(ctx, ns+historySuffix)
+}
+
+// NamespaceStats do not include the revisions of the items
+func (h *historyStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	nsStore, ok := h.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.NamespaceStats{}, gkvstore.ErrNotSupported
+	}
+	return nsStore.NamespaceStats(ctx, ns)
+}
@@ -0,0 +1,67 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/plexsysio/gkvstore"
+	"go.uber.org/multierr"
+)
+
+type batchOp struct {
+	item   gkvstore.Item
+	delete bool
+}
+
+type inmemBatch struct {
+	store *inmemStore
+	ops   []batchOp
+}
+
+func (i *inmemStore) NewBatch(_ context.Context) (gkvstore.Batcher, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+	return &inmemBatch{store: i}, nil
+}
+
+func (b *inmemBatch) Put(_ context.Context, item gkvstore.Item) error {
+	b.ops = append(b.ops, batchOp{item: item})
+	return nil
+}
+
+func (b *inmemBatch) Delete(_ context.Context, item gkvstore.Item) error {
+	b.ops = append(b.ops, batchOp{item: item, delete: true})
+	return nil
+}
+
+// Commit writes all the items to the map with a single lock acquisition and
+// collects the timetracker index changes for each namespace, so the indexes
+// are updated in a single pass at the end
+func (b *inmemBatch) Commit(_ context.Context) error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	if b.store.closed {
+		return gkvstore.ErrStoreClosed
+	}
+
+	var err error
+	changes := make(indexChanges)
+
+	for _, op := range b.ops {
+		if op.delete {
+			b.store.removeKey(key(op.item), changes)
+			continue
+		}
+
+		_, uErr := b.store.upsert(op.item, changes)
+		multierr.AppendInto(&err, gkvstore.WrapError("Put", op.item, uErr))
+	}
+	b.store.applyIndexChanges(changes)
+
+	b.ops = nil
+	return err
+}
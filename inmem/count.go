@@ -0,0 +1,57 @@
+package inmem
+
+import (
+	"context"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// Count uses the ID index and the item metadata of the namespace to count the
+// items. Items are decoded only if a Filter is provided
+func (i *inmemStore) Count(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (int64, error) {
+
+	ns := factory().GetNamespace()
+	now := time.Now().UnixNano()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, gkvstore.ErrStoreClosed)
+	}
+
+	idIdx, found := i.idIdx[ns]
+	if !found {
+		return 0, nil
+	}
+	var count int64
+	for _, id := range idIdx.rng(opts) {
+		k := itemKey(ns, id)
+		m := i.meta[k]
+		if m.expired(now) || m.version < opts.Version {
+			continue
+		}
+		if opts.Index.Name != "" {
+			val, found := m.indexes[opts.Index.Name]
+			if !found || !opts.Index.Match(val) {
+				continue
+			}
+		}
+		if opts.Filter != nil {
+			it := factory()
+			if err := it.Unmarshal(i.mp[k]); err != nil {
+				return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+			}
+			if !opts.Filter.Compare(it) {
+				continue
+			}
+		}
+		count++
+	}
+	return count, nil
+}
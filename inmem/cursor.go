@@ -0,0 +1,28 @@
+package inmem
+
+import "github.com/plexsysio/gkvstore"
+
+// indexEntry is the position of a key in the listing order. index is the
+// timestamp for the timetracker sorts and value is the secondary index value
+// if an IndexQuery is used
+type indexEntry struct {
+	key   string
+	index int64
+	value string
+}
+
+// after checks if the entry comes after the cursor position in the listing
+// order
+func (e indexEntry) after(c indexEntry, desc bool) bool {
+	if e.index != c.index {
+		return (e.index > c.index) != desc
+	}
+	if e.value != c.value {
+		return (e.value > c.value) != desc
+	}
+	return e.key != c.key && (e.key > c.key) != desc
+}
+
+func (e indexEntry) cursor(s gkvstore.Sort) string {
+	return gkvstore.Cursor{Sort: s, Index: e.index, Value: e.value, Key: []byte(e.key)}.Encode()
+}
@@ -0,0 +1,79 @@
+package inmem
+
+import (
+	"sort"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// valueIndex maintains the keys of a namespace sorted on the value of a
+// secondary index. Keys with the same value are sorted on the key. It is
+// protected by the store lock
+type valueIndex struct {
+	entries []indexEntry
+}
+
+func (v *valueIndex) search(value, key string) int {
+	return sort.Search(len(v.entries), func(idx int) bool {
+		e := v.entries[idx]
+		return e.value > value || (e.value == value && e.key >= key)
+	})
+}
+
+func (v *valueIndex) insert(value, key string) {
+	idx := v.search(value, key)
+	if idx < len(v.entries) && v.entries[idx].value == value && v.entries[idx].key == key {
+		return
+	}
+	v.entries = append(v.entries, indexEntry{})
+	copy(v.entries[idx+1:], v.entries[idx:])
+	v.entries[idx] = indexEntry{key: key, value: value}
+}
+
+func (v *valueIndex) remove(value, key string) {
+	idx := v.search(value, key)
+	if idx < len(v.entries) && v.entries[idx].value == value && v.entries[idx].key == key {
+		v.entries = append(v.entries[:idx], v.entries[idx+1:]...)
+	}
+}
+
+// query returns a copy of the entries matching the query in the index order
+func (v *valueIndex) query(q gkvstore.IndexQuery) []indexEntry {
+	start := q.Start
+	if q.Value != "" {
+		start = q.Value
+	}
+	idx := v.search(start, "")
+	end := idx
+	for end < len(v.entries) && q.Match(v.entries[end].value) {
+		end++
+	}
+	return append([]indexEntry(nil), v.entries[idx:end]...)
+}
+
+// updateIndexes replaces the secondary index entries of the key. It has to
+// be called with the lock held
+func (i *inmemStore) updateIndexes(ns, k string, old, updated map[string]string) {
+	for name, val := range old {
+		if nv, found := updated[name]; found && nv == val {
+			continue
+		}
+		if vIdx, found := i.secIdx[ns][name]; found {
+			vIdx.remove(val, k)
+		}
+	}
+	for name, val := range updated {
+		if ov, found := old[name]; found && ov == val {
+			continue
+		}
+		if _, found := i.secIdx[ns]; !found {
+			i.secIdx[ns] = make(map[string]*valueIndex)
+		}
+		vIdx, found := i.secIdx[ns][name]
+		if !found {
+			vIdx = &valueIndex{}
+			i.secIdx[ns][name] = vIdx
+		}
+		vIdx.insert(val, k)
+	}
+}
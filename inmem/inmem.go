@@ -2,7 +2,6 @@ package inmem
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/plexsysio/gkvstore"
 	"go.uber.org/atomic"
@@ -12,103 +11,510 @@ import (
 	"time"
 )
 
+// reapInterval is the interval of the reaper. Expired items are hidden from
+// the reads till they are removed
+const reapInterval = time.Second
+
+// itemMeta is the information maintained for each key apart from the
+// serialized item. This is used to maintain the indexes without having
+// to unmarshal the stored items
+type itemMeta struct {
+	namespace string
+	version   int64
+	expiry    int64
+	timeTrack bool
+	created   int64
+	updated   int64
+	indexes   map[string]string
+}
+
 type inmemStore struct {
-	nonce atomic.Int64
-	mp    map[string][]byte
-	ttIdx map[string]*ttIndex
+	mu       sync.RWMutex
+	nonce    atomic.Int64
+	mp       map[string][]byte
+	meta     map[string]*itemMeta
+	expiring map[string]struct{}
+	ttIdx    map[string]*ttIndex
+	idIdx    map[string]*idIndex
+	secIdx   map[string]map[string]*valueIndex
+	watchers watchers
+	// closed is set on Close, after which the operations fail with
+	// ErrStoreClosed. It is protected by the lock
+	closed bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
+// New returns an in-memory store. A background routine removes the expired
+// items, which is stopped on Close. Operations after Close fail with
+// ErrStoreClosed
 func New() gkvstore.Store {
-	return &inmemStore{
-		mp:    make(map[string][]byte, 1000),
-		ttIdx: make(map[string]*ttIndex, 10),
+	st := &inmemStore{
+		mp:       make(map[string][]byte, 1000),
+		meta:     make(map[string]*itemMeta, 1000),
+		expiring: make(map[string]struct{}),
+		ttIdx:    make(map[string]*ttIndex, 10),
+		idIdx:    make(map[string]*idIndex, 10),
+		secIdx:   make(map[string]map[string]*valueIndex, 10),
+		stop:     make(chan struct{}),
 	}
+	go st.reaper()
+	return st
 }
 
 func key(item gkvstore.Item) string {
-	return fmt.Sprintf("/%s/%s", item.GetNamespace(), item.GetID())
+	return itemKey(item.GetNamespace(), item.GetID())
+}
+
+// itemKey separates the namespace from the ID with NUL, which is not allowed
+// in the namespaces. With '/' namespace "a/b" with ID "c" and namespace "a"
+// with ID "b/c" would share the key
+func itemKey(ns, id string) string {
+	return "/" + ns + "\x00" + id
+}
+
+// keyID returns the ID part of the key of the form /namespace NUL id
+func keyID(ns, k string) string {
+	return k[len(ns)+2:]
+}
+
+func validate(item gkvstore.Item) error {
+	if strings.IndexByte(item.GetNamespace(), 0) != -1 {
+		return fmt.Errorf("%w: namespace cannot contain NUL", gkvstore.ErrInvalidItem)
+	}
+	return nil
+}
+
+func (m *itemMeta) expired(now int64) bool {
+	return m.expiry != 0 && m.expiry <= now
+}
+
+// found checks if the key exists and is not expired. Expired items are
+// removed by the reaper, till then they are treated as non-existent
+func (i *inmemStore) found(k string) bool {
+	m, found := i.meta[k]
+	return found && !m.expired(time.Now().UnixNano())
+}
+
+// indexChanges collects the timetracker index changes for each namespace so
+// multiple operations can be applied to the indexes together
+type indexChanges map[string]*ttChanges
+
+type ttChanges struct {
+	created []indexChange
+	updated []indexChange
+}
+
+func (c indexChanges) get(ns string) *ttChanges {
+	ch, found := c[ns]
+	if !found {
+		ch = &ttChanges{}
+		c[ns] = ch
+	}
+	return ch
+}
+
+func (i *inmemStore) applyIndexChanges(changes indexChanges) {
+	for ns, c := range changes {
+		ttIdx, exists := i.ttIdx[ns]
+		if !exists {
+			ttIdx = newTTIndex()
+			i.ttIdx[ns] = ttIdx
+		}
+		ttIdx.created.update(c.created)
+		ttIdx.updated.update(c.updated)
+	}
+}
+
+// put stores the item buffer and metadata and collects the index changes. It
+// has to be called with the lock held
+func (i *inmemStore) put(k string, buf []byte, m *itemMeta, changes indexChanges) {
+	old, exists := i.meta[k]
+	if exists && old.timeTrack {
+		c := changes.get(old.namespace)
+		if !m.timeTrack || old.created != m.created {
+			c.created = append(c.created, indexChange{k, old.created, true})
+		}
+		c.updated = append(c.updated, indexChange{k, old.updated, true})
+	}
+	if m.timeTrack {
+		c := changes.get(m.namespace)
+		if !exists || !old.timeTrack || old.created != m.created {
+			c.created = append(c.created, indexChange{k, m.created, false})
+		}
+		c.updated = append(c.updated, indexChange{k, m.updated, false})
+	}
+
+	var oldIndexes map[string]string
+	if exists {
+		oldIndexes = old.indexes
+	}
+	i.updateIndexes(m.namespace, k, oldIndexes, m.indexes)
+
+	if !exists {
+		idIdx, found := i.idIdx[m.namespace]
+		if !found {
+			idIdx = &idIndex{}
+			i.idIdx[m.namespace] = idIdx
+		}
+		idIdx.insert(keyID(m.namespace, k))
+	}
+
+	i.mp[k] = buf
+	i.meta[k] = m
+	if m.expiry != 0 {
+		i.expiring[k] = struct{}{}
+	} else {
+		delete(i.expiring, k)
+	}
+
+	if exists {
+		i.watchers.notify(m.namespace, gkvstore.EventUpdated, buf)
+	} else {
+		i.watchers.notify(m.namespace, gkvstore.EventCreated, buf)
+	}
+}
+
+// removeKey removes the item and collects the index changes. It has to be
+// called with the lock held
+func (i *inmemStore) removeKey(k string, changes indexChanges) {
+	m, found := i.meta[k]
+	if !found {
+		return
+	}
+	if m.timeTrack {
+		c := changes.get(m.namespace)
+		c.created = append(c.created, indexChange{k, m.created, true})
+		c.updated = append(c.updated, indexChange{k, m.updated, true})
+	}
+	if idIdx, found := i.idIdx[m.namespace]; found {
+		idIdx.remove(keyID(m.namespace, k))
+	}
+	i.updateIndexes(m.namespace, k, m.indexes, nil)
+
+	buf := i.mp[k]
+	delete(i.mp, k)
+	delete(i.meta, k)
+	delete(i.expiring, k)
+
+	i.watchers.notify(m.namespace, gkvstore.EventDeleted, buf)
 }
 
 func (i *inmemStore) Create(ctx context.Context, item gkvstore.Item) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrStoreClosed)
+	}
+
+	if err := validate(item); err != nil {
+		return gkvstore.WrapError("Create", item, err)
+	}
 
 	if ids, ok := item.(gkvstore.IDSetter); ok {
 		ids.SetID(fmt.Sprintf("%d", i.nonce.Inc()))
 	}
 
-	if _, found := i.mp[key(item)]; found {
-		return gkvstore.ErrRecordAlreadyExists
+	k := key(item)
+	if i.found(k) {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrRecordAlreadyExists)
+	}
+
+	m := &itemMeta{
+		namespace: item.GetNamespace(),
+		version:   1,
+		expiry:    gkvstore.ItemExpiry(item),
+		indexes:   gkvstore.ItemIndexes(item),
 	}
 
 	if tt, ok := item.(gkvstore.TimeTracker); ok {
-		ttIdx, exists := i.ttIdx[item.GetNamespace()]
-		if !exists {
-			ttIdx = newTTIndex()
-			i.ttIdx[item.GetNamespace()] = ttIdx
-		}
 		timestamp := time.Now().UnixNano()
 		tt.SetCreated(timestamp)
 		tt.SetUpdated(timestamp)
-		ttIdx.created.insert(key(item), timestamp)
-		ttIdx.updated.insert(key(item), timestamp)
+		m.timeTrack = true
+		m.created = timestamp
+		m.updated = timestamp
+	}
+
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(1)
 	}
 
 	itemBuf, err := item.Marshal()
 	if err != nil {
-		return err
+		return gkvstore.WrapError("Create", item, err)
 	}
-	i.mp[key(item)] = itemBuf
+
+	changes := make(indexChanges)
+	// Expired item which is not yet reaped
+	i.removeKey(k, changes)
+	i.put(k, itemBuf, m, changes)
+	i.applyIndexChanges(changes)
 
 	return nil
 }
 
 func (i *inmemStore) Read(ctx context.Context, item gkvstore.Item) error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 
-	itemBuf, found := i.mp[key(item)]
-	if !found {
-		return gkvstore.ErrRecordNotFound
+	if i.closed {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrStoreClosed)
+	}
+	if !i.found(key(item)) {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
 	}
 
-	return item.Unmarshal(itemBuf)
+	return gkvstore.WrapError("Read", item, item.Unmarshal(i.mp[key(item)]))
 }
 
 func (i *inmemStore) Update(ctx context.Context, item gkvstore.Item) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrStoreClosed)
+	}
+	if err := validate(item); err != nil {
+		return gkvstore.WrapError("Update", item, err)
+	}
+
+	k := key(item)
+	// Expired item which is not yet reaped is treated as non-existent
+	var (
+		old     *itemMeta
+		exists  bool
+		version int64
+	)
+	if i.found(k) {
+		old, exists = i.meta[k], true
+		version = old.version
+	}
+	v, versioned := item.(gkvstore.Versioned)
+	if versioned && v.GetVersion() != version {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrVersionConflict)
+	}
+
+	m := &itemMeta{
+		namespace: item.GetNamespace(),
+		version:   version + 1,
+		expiry:    gkvstore.ItemExpiry(item),
+		indexes:   gkvstore.ItemIndexes(item),
+	}
 
 	if tt, ok := item.(gkvstore.TimeTracker); ok {
-		ttIdx, exists := i.ttIdx[item.GetNamespace()]
-		if !exists {
-			return errors.New("timetracker index not found")
+		if _, found := i.ttIdx[item.GetNamespace()]; !found {
+			return gkvstore.WrapError("Update", item, gkvstore.ErrIndexNotFound)
 		}
-		old := tt.GetUpdated()
 		timestamp := time.Now().UnixNano()
+		if exists && old.timeTrack {
+			tt.SetCreated(old.created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
 		tt.SetUpdated(timestamp)
-		ttIdx.updated.remove(key(item), old)
-		ttIdx.updated.insert(key(item), timestamp)
+		m.timeTrack = true
+		m.created = tt.GetCreated()
+		m.updated = timestamp
+	}
+
+	if versioned {
+		v.SetVersion(version + 1)
 	}
 
 	itemBuf, err := item.Marshal()
 	if err != nil {
-		return err
+		return gkvstore.WrapError("Update", item, err)
+	}
+
+	changes := make(indexChanges)
+	if !exists {
+		i.removeKey(k, changes)
 	}
-	i.mp[key(item)] = itemBuf
+	i.put(k, itemBuf, m, changes)
+	i.applyIndexChanges(changes)
 
 	return nil
 }
 
 func (i *inmemStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return gkvstore.WrapError("Delete", item, gkvstore.ErrStoreClosed)
+	}
+
+	changes := make(indexChanges)
+	i.removeKey(key(item), changes)
+	i.applyIndexChanges(changes)
+
+	return nil
+}
+
+// lookup returns the item buffer if the key is present and matches the version
+// in the list options
+func (i *inmemStore) lookup(k string, opts gkvstore.ListOpt) ([]byte, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	m, found := i.meta[k]
+	if !found || m.expired(time.Now().UnixNano()) || m.version < opts.Version {
+		return nil, false
+	}
+	return i.mp[k], true
+}
 
-	itemBuf, found := i.mp[key(item)]
-	if found {
-		ttIdx, found := i.ttIdx[item.GetNamespace()]
-		if found {
-			err := item.Unmarshal(itemBuf)
-			if err == nil {
-				ttIdx.created.remove(key(item), item.(gkvstore.TimeTracker).GetCreated())
-				ttIdx.updated.remove(key(item), item.(gkvstore.TimeTracker).GetUpdated())
+// entries returns the keys of the namespace in the listing order of the
+// options, starting after the cursor if provided
+func (i *inmemStore) entries(ns string, opts gkvstore.ListOpt) ([]indexEntry, error) {
+	var start indexEntry
+	if opts.Cursor != "" {
+		c, err := gkvstore.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		start = indexEntry{key: string(c.Key), index: c.Index, value: c.Value}
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+
+	var (
+		entries []indexEntry
+		desc    bool
+	)
+	switch {
+	// Natural order with index query is the order of the index values
+	case opts.Index.Name != "" && opts.Sort == gkvstore.SortNatural:
+		if vIdx, found := i.secIdx[ns][opts.Index.Name]; found {
+			entries = vIdx.query(opts.Index)
+		}
+	// Natural order is the order of the IDs, which is stable across calls
+	case opts.Sort == gkvstore.SortNatural || opts.Sort == gkvstore.SortIDAsc || opts.Sort == gkvstore.SortIDDesc:
+		if idIdx, found := i.idIdx[ns]; found {
+			for _, id := range idIdx.rng(opts) {
+				entries = append(entries, indexEntry{key: itemKey(ns, id)})
 			}
 		}
-		delete(i.mp, key(item))
+		if opts.Sort == gkvstore.SortIDDesc {
+			for a, b := 0, len(entries)-1; a < b; a, b = a+1, b-1 {
+				entries[a], entries[b] = entries[b], entries[a]
+			}
+			desc = true
+		}
+	case opts.Sort == gkvstore.SortCreatedAsc:
+		ttIdx, found := i.ttIdx[ns]
+		if !found {
+			return nil, gkvstore.ErrIndexNotFound
+		}
+		entries = ttIdx.created.asc()
+	case opts.Sort == gkvstore.SortCreatedDesc:
+		ttIdx, found := i.ttIdx[ns]
+		if !found {
+			return nil, gkvstore.ErrIndexNotFound
+		}
+		entries, desc = ttIdx.created.desc(), true
+	case opts.Sort == gkvstore.SortUpdatedAsc:
+		ttIdx, found := i.ttIdx[ns]
+		if !found {
+			return nil, gkvstore.ErrIndexNotFound
+		}
+		entries = ttIdx.updated.asc()
+	case opts.Sort == gkvstore.SortUpdatedDesc:
+		ttIdx, found := i.ttIdx[ns]
+		if !found {
+			return nil, gkvstore.ErrIndexNotFound
+		}
+		entries, desc = ttIdx.updated.desc(), true
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+
+	if opts.Index.Name != "" && opts.Sort != gkvstore.SortNatural {
+		matched := make(map[string]bool)
+		if vIdx, found := i.secIdx[ns][opts.Index.Name]; found {
+			for _, e := range vIdx.query(opts.Index) {
+				matched[e.key] = true
+			}
+		}
+		filtered := entries[:0:0]
+		for _, e := range entries {
+			if matched[e.key] {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	if opts.IDPrefix != "" || opts.StartID != "" || opts.EndID != "" {
+		filtered := entries[:0:0]
+		for _, e := range entries {
+			if opts.MatchID(keyID(ns, e.key)) {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+
+	if opts.Cursor != "" {
+		idx := sort.Search(len(entries), func(idx int) bool {
+			return entries[idx].after(start, desc)
+		})
+		entries = entries[idx:]
+	}
+	return entries, nil
+}
+
+// walk calls the function for the entries which are present and match the
+// options, till it returns false or the Limit is reached. Entries of the Page
+// are skipped. Items are decoded if required or a Filter is provided
+func (i *inmemStore) walk(
+	entries []indexEntry,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+	decode bool,
+	fn func(indexEntry, gkvstore.Item, error) bool,
+) {
+	skip := opts.Page * opts.Limit
+	if opts.Cursor != "" {
+		skip = 0
+	}
+	count := 0
+	for _, e := range entries {
+		val, found := i.lookup(e.key, opts)
+		if !found {
+			// best effort continue
+			continue
+		}
+		var (
+			it  gkvstore.Item
+			err error
+		)
+		if decode || opts.Filter != nil {
+			it = factory()
+			err = it.Unmarshal(val)
+			if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
+				continue
+			}
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !fn(e, it, err) {
+			return
+		}
+		if count++; int64(count) == opts.Limit {
+			return
+		}
 	}
-	return nil
 }
 
 func (i *inmemStore) List(
@@ -117,100 +523,105 @@ func (i *inmemStore) List(
 	opts gkvstore.ListOpt,
 ) (<-chan *gkvstore.Result, error) {
 
-	skip := opts.Page * opts.Limit
+	ns := factory().GetNamespace()
+	entries, err := i.entries(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+
 	res := make(chan *gkvstore.Result)
 
-	sendResults := func(keyChan <-chan string) {
+	go func() {
 		defer close(res)
 
-		count := 0
-		for k := range keyChan {
-			if skip > 0 {
-				skip--
-				continue
-			}
-			val, found := i.mp[k]
-			if !found {
-				// best effort continue
-				continue
-			}
-			it := factory()
-			err := it.Unmarshal(val)
+		i.walk(entries, factory, opts, true, func(e indexEntry, it gkvstore.Item, err error) bool {
 			select {
 			case <-ctx.Done():
-				return
-			case res <- &gkvstore.Result{Val: it, Err: err}:
-			}
-			if int64(count) == opts.Limit {
-				return
+				return false
+			case res <- &gkvstore.Result{Val: it, Err: err, Cursor: e.cursor(opts.Sort)}:
+				return true
 			}
+		})
+	}()
+
+	return res, nil
+}
+
+func (i *inmemStore) reaper() {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-i.stop:
+			return
+		case <-ticker.C:
+			i.reap()
 		}
 	}
+}
 
-	switch opts.Sort {
-	case gkvstore.SortNatural:
-		go func() {
-			defer close(res)
+func (i *inmemStore) reap() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 
-			count := 0
-			for k, v := range i.mp {
-				it := factory()
-				if !strings.HasPrefix(k, "/"+it.GetNamespace()) {
-					continue
-				}
-				err := it.Unmarshal(v)
-				if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
-					continue
-				}
-				if skip > 0 {
-					skip--
-					continue
-				}
-				select {
-				case <-ctx.Done():
-					return
-				case res <- &gkvstore.Result{Val: it, Err: err}:
-					count++
-				}
-				if int64(count) == opts.Limit {
-					return
-				}
-			}
-		}()
-	case gkvstore.SortCreatedAsc:
-		ttIdx, found := i.ttIdx[factory().GetNamespace()]
-		if !found {
-			return nil, errors.New("timetracker index not found")
+	now := time.Now().UnixNano()
+	changes := make(indexChanges)
+	for k := range i.expiring {
+		if i.meta[k].expired(now) {
+			i.removeKey(k, changes)
 		}
-		go sendResults(ttIdx.created.asc())
-	case gkvstore.SortCreatedDesc:
-		ttIdx, found := i.ttIdx[factory().GetNamespace()]
-		if !found {
-			return nil, errors.New("timetracker index not found")
-		}
-		go sendResults(ttIdx.created.desc())
-	case gkvstore.SortUpdatedAsc:
-		ttIdx, found := i.ttIdx[factory().GetNamespace()]
-		if !found {
-			return nil, errors.New("timetracker index not found")
-		}
-		go sendResults(ttIdx.updated.asc())
-	case gkvstore.SortUpdatedDesc:
-		ttIdx, found := i.ttIdx[factory().GetNamespace()]
-		if !found {
-			return nil, errors.New("timetracker index not found")
-		}
-		go sendResults(ttIdx.updated.desc())
-	default:
-		return nil, errors.New("invalid sort type")
 	}
-	return res, nil
+	i.applyIndexChanges(changes)
 }
 
 func (i *inmemStore) Close() error {
+	i.mu.Lock()
+	i.closed = true
+	i.mu.Unlock()
+
+	i.stopOnce.Do(func() { close(i.stop) })
+	i.watchers.close()
 	return nil
 }
 
+// idIndex maintains the IDs of a namespace in sorted order. It is protected
+// by the store lock
+type idIndex struct {
+	ids []string
+}
+
+func (i *idIndex) insert(id string) {
+	idx := sort.SearchStrings(i.ids, id)
+	if idx < len(i.ids) && i.ids[idx] == id {
+		return
+	}
+	i.ids = append(i.ids, "")
+	copy(i.ids[idx+1:], i.ids[idx:])
+	i.ids[idx] = id
+}
+
+func (i *idIndex) remove(id string) {
+	idx := sort.SearchStrings(i.ids, id)
+	if idx < len(i.ids) && i.ids[idx] == id {
+		i.ids = append(i.ids[:idx], i.ids[idx+1:]...)
+	}
+}
+
+// rng returns a copy of the IDs matching the ID options in ascending order
+func (i *idIndex) rng(opts gkvstore.ListOpt) []string {
+	start := opts.StartID
+	if opts.IDPrefix > start {
+		start = opts.IDPrefix
+	}
+	idx := sort.SearchStrings(i.ids, start)
+	end := idx
+	for end < len(i.ids) && opts.MatchID(i.ids[end]) {
+		end++
+	}
+	return append([]string(nil), i.ids[idx:end]...)
+}
+
 type ttIndex struct {
 	created intIndex
 	updated intIndex
@@ -243,10 +654,16 @@ func (i *intIndex) synchronize() func() {
 const sizeThreshold = 15
 
 func (i *intIndex) insert(key string, index int64) {
+	defer i.synchronize()()
+	i.insertUnsafe(key, index)
+}
+
+func (i *intIndex) insertUnsafe(key string, index int64) {
 	if cap(i.items)-len(i.items) < sizeThreshold {
-		i.items = append(i.items, make([]indexItem, 100)...)
+		items := make([]indexItem, len(i.items), cap(i.items)+100)
+		copy(items, i.items)
+		i.items = items
 	}
-	defer i.synchronize()()
 	if len(i.items) == 0 || i.items[len(i.items)-1].index < index {
 		i.items = append(i.items, indexItem{index, []string{key}})
 		return
@@ -266,6 +683,10 @@ func (i *intIndex) insert(key string, index int64) {
 
 func (i *intIndex) remove(key string, oldIndex int64) {
 	defer i.synchronize()()
+	i.removeUnsafe(key, oldIndex)
+}
+
+func (i *intIndex) removeUnsafe(key string, oldIndex int64) {
 	idx := sort.Search(len(i.items), func(idx int) bool { return i.items[idx].index >= oldIndex })
 	if idx < len(i.items) && i.items[idx].index == oldIndex {
 		if len(i.items[idx].keys) == 1 {
@@ -282,32 +703,52 @@ func (i *intIndex) remove(key string, oldIndex int64) {
 	}
 }
 
-func (i *intIndex) asc() <-chan string {
-	res := make(chan string)
-	go func() {
-		defer i.synchronize()()
-		defer close(res)
+type indexChange struct {
+	key    string
+	index  int64
+	remove bool
+}
 
-		for idx := 0; idx < len(i.items); idx++ {
-			for _, v := range i.items[idx].keys {
-				res <- v
-			}
+// update applies multiple changes in order with a single lock acquisition
+func (i *intIndex) update(changes []indexChange) {
+	defer i.synchronize()()
+	for _, c := range changes {
+		if c.remove {
+			i.removeUnsafe(c.key, c.index)
+		} else {
+			i.insertUnsafe(c.key, c.index)
 		}
-	}()
-	return res
+	}
 }
 
-func (i *intIndex) desc() <-chan string {
-	res := make(chan string)
-	go func() {
-		defer i.synchronize()()
-		defer close(res)
+// asc returns a snapshot of the entries in ascending order of the index.
+// Keys with the same index are ordered by the key
+func (i *intIndex) asc() []indexEntry {
+	defer i.synchronize()()
 
-		for idx := len(i.items) - 1; idx >= 0; idx-- {
-			for _, v := range i.items[idx].keys {
-				res <- v
-			}
+	entries := make([]indexEntry, 0, len(i.items))
+	for idx := 0; idx < len(i.items); idx++ {
+		keys := append([]string(nil), i.items[idx].keys...)
+		sort.Strings(keys)
+		for _, k := range keys {
+			entries = append(entries, indexEntry{key: k, index: i.items[idx].index})
 		}
-	}()
-	return res
+	}
+	return entries
+}
+
+// desc returns a snapshot of the entries in descending order of the index.
+// Keys with the same index are ordered by the key in reverse
+func (i *intIndex) desc() []indexEntry {
+	defer i.synchronize()()
+
+	entries := make([]indexEntry, 0, len(i.items))
+	for idx := len(i.items) - 1; idx >= 0; idx-- {
+		keys := append([]string(nil), i.items[idx].keys...)
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		for _, k := range keys {
+			entries = append(entries, indexEntry{key: k, index: i.items[idx].index})
+		}
+	}
+	return entries
 }
@@ -1,8 +1,14 @@
 package inmem_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/plexsysio/gkvstore"
 	"github.com/plexsysio/gkvstore/inmem"
 	"github.com/plexsysio/gkvstore/testsuite"
 )
@@ -14,3 +20,123 @@ func TestSuite(t *testing.T) {
 func BenchmarkSuite(b *testing.B) {
 	testsuite.BenchmarkSuite(b, inmem.New())
 }
+
+type session struct {
+	Id     string
+	Expiry int64
+}
+
+func (s *session) GetNamespace() string { return "session" }
+
+func (s *session) GetID() string { return s.Id }
+
+func (s *session) Marshal() ([]byte, error) { return json.Marshal(s) }
+
+func (s *session) Unmarshal(buf []byte) error { return json.Unmarshal(buf, s) }
+
+func (s *session) GetExpiry() int64 { return s.Expiry }
+
+func TestReaper(t *testing.T) {
+	st := inmem.New()
+	defer st.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	evs, err := st.(gkvstore.Watcher).Watch(ctx, func() gkvstore.Item { return &session{} }, gkvstore.WatchOpt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.Create(context.TODO(), &session{
+		Id:     "1",
+		Expiry: time.Now().Add(100 * time.Millisecond).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []gkvstore.EventType{gkvstore.EventCreated, gkvstore.EventDeleted} {
+		select {
+		case ev := <-evs:
+			if ev.Type != typ || ev.Val.GetID() != "1" {
+				t.Fatal("incorrect event", ev.Type, ev.Val.GetID())
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestIndexNotFound(t *testing.T) {
+	st := inmem.New()
+	defer st.Close()
+
+	_, err := st.List(
+		context.TODO(),
+		func() gkvstore.Item { return &session{} },
+		gkvstore.ListOpt{Sort: gkvstore.SortCreatedAsc},
+	)
+	if !errors.Is(err, gkvstore.ErrIndexNotFound) {
+		t.Fatal("expected index not found error", err)
+	}
+	var se *gkvstore.StoreError
+	if !errors.As(err, &se) || se.Op != "List" || se.Namespace != "session" {
+		t.Fatal("expected error context", err)
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	st := inmem.New()
+	defer st.Close()
+
+	evs, err := st.(gkvstore.Watcher).Watch(
+		context.Background(),
+		func() gkvstore.Item { return &session{} },
+		gkvstore.WatchOpt{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Events are not consumed while writing, so the queue overflows
+	for i := 0; i < 3000; i++ {
+		if err := st.Create(context.TODO(), &session{Id: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var last *gkvstore.Event
+	for ev := range evs {
+		last = ev
+	}
+	if last == nil || !errors.Is(last.Err, gkvstore.ErrWatchOverflow) {
+		t.Fatal("expected overflow error as the last event", last)
+	}
+}
+
+func TestWatchClose(t *testing.T) {
+	st := inmem.New()
+
+	factory := func() gkvstore.Item { return &session{} }
+	evs, err := st.(gkvstore.Watcher).Watch(context.Background(), factory, gkvstore.WatchOpt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case _, open := <-evs:
+		if open {
+			t.Fatal("unexpected event after close")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("watch not ended on close")
+	}
+	_, err = st.(gkvstore.Watcher).Watch(context.Background(), factory, gkvstore.WatchOpt{})
+	if !errors.Is(err, gkvstore.ErrStoreClosed) {
+		t.Fatal("expected store closed error", err)
+	}
+}
@@ -0,0 +1,42 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+func (i *inmemStore) ListKeys(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.KeyResult, error) {
+
+	ns := factory().GetNamespace()
+	entries, err := i.entries(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+	}
+
+	res := make(chan *gkvstore.KeyResult)
+
+	go func() {
+		defer close(res)
+
+		i.walk(entries, factory, opts, false, func(e indexEntry, _ gkvstore.Item, err error) bool {
+			kr := &gkvstore.KeyResult{
+				Key:    gkvstore.Key{Namespace: ns, ID: keyID(ns, e.key)},
+				Err:    err,
+				Cursor: e.cursor(opts.Sort),
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- kr:
+				return true
+			}
+		})
+	}()
+
+	return res, nil
+}
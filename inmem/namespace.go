@@ -0,0 +1,94 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ListNamespaces returns the namespaces with at least one unexpired item in
+// sorted order
+func (i *inmemStore) ListNamespaces(_ context.Context) ([]string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+
+	now := time.Now().UnixNano()
+	seen := make(map[string]bool)
+	for _, m := range i.meta {
+		if !m.expired(now) {
+			seen[m.namespace] = true
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// DropNamespace removes all the items in the namespace along with the indexes.
+// Watchers get delete events for all the items
+func (i *inmemStore) DropNamespace(_ context.Context, ns string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return gkvstore.WrapNamespaceError("DropNamespace", ns, gkvstore.ErrStoreClosed)
+	}
+
+	idIdx, found := i.idIdx[ns]
+	if !found {
+		return nil
+	}
+	ids := make([]string, len(idIdx.ids))
+	copy(ids, idIdx.ids)
+
+	changes := make(indexChanges)
+	for _, id := range ids {
+		i.removeKey(itemKey(ns, id), changes)
+	}
+	i.applyIndexChanges(changes)
+
+	delete(i.idIdx, ns)
+	delete(i.ttIdx, ns)
+	delete(i.secIdx, ns)
+	return nil
+}
+
+// NamespaceStats returns the no of unexpired items in the namespace with their
+// serialized size and the latest update time of the TimeTracker items
+func (i *inmemStore) NamespaceStats(_ context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	stats := gkvstore.NamespaceStats{Namespace: ns}
+	if i.closed {
+		return stats, gkvstore.WrapNamespaceError("NamespaceStats", ns, gkvstore.ErrStoreClosed)
+	}
+	idIdx, found := i.idIdx[ns]
+	if !found {
+		return stats, nil
+	}
+
+	now := time.Now().UnixNano()
+	for _, id := range idIdx.ids {
+		k := itemKey(ns, id)
+		m := i.meta[k]
+		if m.expired(now) {
+			continue
+		}
+		stats.Items++
+		stats.Size += int64(len(i.mp[k]))
+		if m.timeTrack && m.updated > stats.LastUpdated {
+			stats.LastUpdated = m.updated
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,83 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// Patch reads the current value into the item, applies the patch and writes
+// it back while holding the lock, so concurrent writers can't interleave
+func (i *inmemStore) Patch(_ context.Context, item gkvstore.Item, p gkvstore.Patch) error {
+	pi, ok := item.(gkvstore.Patchable)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+
+	// Item is modified by the patch, so the context is captured before
+	ns, id := item.GetNamespace(), item.GetID()
+	if err := i.patch(item, pi, p); err != nil {
+		return &gkvstore.StoreError{Op: "Patch", Namespace: ns, ID: id, Err: err}
+	}
+	return nil
+}
+
+func (i *inmemStore) patch(item gkvstore.Item, pi gkvstore.Patchable, p gkvstore.Patch) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return gkvstore.ErrStoreClosed
+	}
+
+	k := key(item)
+	if !i.found(k) {
+		return gkvstore.ErrRecordNotFound
+	}
+	old := i.meta[k]
+
+	if err := item.Unmarshal(i.mp[k]); err != nil {
+		return err
+	}
+	if err := pi.ApplyPatch(p); err != nil {
+		return err
+	}
+	if key(item) != k {
+		return fmt.Errorf("%w: patch cannot modify the item key", gkvstore.ErrInvalidItem)
+	}
+
+	m := &itemMeta{
+		namespace: old.namespace,
+		version:   old.version + 1,
+		expiry:    gkvstore.ItemExpiry(item),
+		indexes:   gkvstore.ItemIndexes(item),
+	}
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(m.version)
+	}
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		if old.timeTrack {
+			tt.SetCreated(old.created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
+		tt.SetUpdated(timestamp)
+		m.timeTrack = true
+		m.created = tt.GetCreated()
+		m.updated = timestamp
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return err
+	}
+
+	changes := make(indexChanges)
+	i.put(k, itemBuf, m, changes)
+	i.applyIndexChanges(changes)
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ReadMany reads all the items with a single lock acquisition
+func (i *inmemStore) ReadMany(_ context.Context, items []gkvstore.Item) []error {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	errs := make([]error, len(items))
+	for idx, item := range items {
+		if i.closed {
+			errs[idx] = gkvstore.WrapError("ReadMany", item, gkvstore.ErrStoreClosed)
+			continue
+		}
+		k := key(item)
+		if !i.found(k) {
+			errs[idx] = gkvstore.WrapError("ReadMany", item, gkvstore.ErrRecordNotFound)
+			continue
+		}
+		errs[idx] = gkvstore.WrapError("ReadMany", item, item.Unmarshal(i.mp[k]))
+	}
+	return errs
+}
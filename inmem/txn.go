@@ -0,0 +1,298 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+type opType int
+
+const (
+	opCreate opType = iota
+	opUpdate
+	opDelete
+)
+
+// txnOp is a single staged operation. Items are marshalled when the operation
+// is staged, so the commit only has to validate and copy buffers to the map
+type txnOp struct {
+	op        opType
+	item      gkvstore.Item
+	key       string
+	buf       []byte
+	meta      *itemMeta
+	versioned bool
+}
+
+type inmemTxn struct {
+	store   *inmemStore
+	ops     []*txnOp
+	pending map[string]*txnOp
+	done    bool
+}
+
+func (i *inmemStore) NewTransaction(_ context.Context) (gkvstore.Txn, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if i.closed {
+		return nil, gkvstore.ErrStoreClosed
+	}
+	return &inmemTxn{
+		store:   i,
+		pending: make(map[string]*txnOp),
+	}, nil
+}
+
+func (t *inmemTxn) exists(k string) bool {
+	_, found := t.current(k)
+	return found
+}
+
+// current returns the metadata of the key as seen by the transaction
+func (t *inmemTxn) current(k string) (*itemMeta, bool) {
+	if op, found := t.pending[k]; found {
+		return op.meta, op.op != opDelete
+	}
+	t.store.mu.RLock()
+	defer t.store.mu.RUnlock()
+
+	if !t.store.found(k) {
+		return nil, false
+	}
+	return t.store.meta[k], true
+}
+
+func (t *inmemTxn) stage(op *txnOp) {
+	t.ops = append(t.ops, op)
+	t.pending[op.key] = op
+}
+
+func (t *inmemTxn) Create(_ context.Context, item gkvstore.Item) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+	if err := validate(item); err != nil {
+		return gkvstore.WrapError("Create", item, err)
+	}
+
+	if ids, ok := item.(gkvstore.IDSetter); ok {
+		ids.SetID(fmt.Sprintf("%d", t.store.nonce.Inc()))
+	}
+
+	if t.exists(key(item)) {
+		return gkvstore.WrapError("Create", item, gkvstore.ErrRecordAlreadyExists)
+	}
+
+	op := &txnOp{
+		op:   opCreate,
+		item: item,
+		key:  key(item),
+		meta: &itemMeta{
+			namespace: item.GetNamespace(),
+			version:   1,
+			expiry:    gkvstore.ItemExpiry(item),
+			indexes:   gkvstore.ItemIndexes(item),
+		},
+	}
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		tt.SetCreated(timestamp)
+		tt.SetUpdated(timestamp)
+		op.meta.timeTrack = true
+		op.meta.created = timestamp
+		op.meta.updated = timestamp
+	}
+
+	if v, ok := item.(gkvstore.Versioned); ok {
+		v.SetVersion(1)
+		op.versioned = true
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return gkvstore.WrapError("Create", item, err)
+	}
+	op.buf = itemBuf
+	t.stage(op)
+
+	return nil
+}
+
+func (t *inmemTxn) Read(ctx context.Context, item gkvstore.Item) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+
+	if op, found := t.pending[key(item)]; found {
+		if op.op == opDelete {
+			return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+		}
+		return gkvstore.WrapError("Read", item, item.Unmarshal(op.buf))
+	}
+
+	return t.store.Read(ctx, item)
+}
+
+func (t *inmemTxn) Update(_ context.Context, item gkvstore.Item) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+	if err := validate(item); err != nil {
+		return gkvstore.WrapError("Update", item, err)
+	}
+
+	op := &txnOp{
+		op:   opUpdate,
+		item: item,
+		key:  key(item),
+		meta: &itemMeta{
+			namespace: item.GetNamespace(),
+			expiry:    gkvstore.ItemExpiry(item),
+			indexes:   gkvstore.ItemIndexes(item),
+		},
+	}
+	old, exists := t.current(op.key)
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		if exists && old.timeTrack {
+			tt.SetCreated(old.created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
+		tt.SetUpdated(timestamp)
+		op.meta.timeTrack = true
+		op.meta.created = tt.GetCreated()
+		op.meta.updated = timestamp
+	}
+
+	// Version is validated again on commit
+	if v, ok := item.(gkvstore.Versioned); ok {
+		op.versioned = true
+		op.meta.version = v.GetVersion() + 1
+		v.SetVersion(op.meta.version)
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return gkvstore.WrapError("Update", item, err)
+	}
+	op.buf = itemBuf
+	t.stage(op)
+
+	return nil
+}
+
+func (t *inmemTxn) Delete(_ context.Context, item gkvstore.Item) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+
+	t.stage(&txnOp{op: opDelete, item: item, key: key(item)})
+	return nil
+}
+
+// validate checks the staged operations against the current state of the
+// store. Store could have been modified after the operations were staged, so
+// this has to be done again before applying anything. It has to be called
+// with the lock held
+func (t *inmemTxn) validate() error {
+	found := make(map[string]bool)
+	indexed := make(map[string]bool)
+	versions := make(map[string]int64)
+
+	exists := func(k string) bool {
+		if f, ok := found[k]; ok {
+			return f
+		}
+		return t.store.found(k)
+	}
+
+	version := func(k string) int64 {
+		if v, ok := versions[k]; ok {
+			return v
+		}
+		if !t.store.found(k) {
+			return 0
+		}
+		return t.store.meta[k].version
+	}
+
+	for _, op := range t.ops {
+		switch op.op {
+		case opCreate:
+			if exists(op.key) {
+				return gkvstore.WrapError("Create", op.item, gkvstore.ErrRecordAlreadyExists)
+			}
+			found[op.key] = true
+			versions[op.key] = 1
+			if op.meta.timeTrack {
+				indexed[op.meta.namespace] = true
+			}
+		case opUpdate:
+			ns := op.meta.namespace
+			if _, idxFound := t.store.ttIdx[ns]; op.meta.timeTrack && !idxFound && !indexed[ns] {
+				return gkvstore.WrapError("Update", op.item, gkvstore.ErrIndexNotFound)
+			}
+			if op.versioned && op.meta.version != version(op.key)+1 {
+				return gkvstore.WrapError("Update", op.item, gkvstore.ErrVersionConflict)
+			}
+			found[op.key] = true
+			versions[op.key] = version(op.key) + 1
+		case opDelete:
+			found[op.key] = false
+			versions[op.key] = 0
+		}
+	}
+	return nil
+}
+
+func (t *inmemTxn) Commit(_ context.Context) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+	t.done = true
+
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	if t.store.closed {
+		return gkvstore.ErrStoreClosed
+	}
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	changes := make(indexChanges)
+	for _, op := range t.ops {
+		if !t.store.found(op.key) {
+			// Expired item which is not yet reaped
+			t.store.removeKey(op.key, changes)
+		}
+		switch op.op {
+		case opCreate:
+			t.store.put(op.key, op.buf, op.meta, changes)
+		case opUpdate:
+			var version int64
+			if old, found := t.store.meta[op.key]; found {
+				version = old.version
+			}
+			op.meta.version = version + 1
+			t.store.put(op.key, op.buf, op.meta, changes)
+		case opDelete:
+			t.store.removeKey(op.key, changes)
+		}
+	}
+	t.store.applyIndexChanges(changes)
+
+	return nil
+}
+
+func (t *inmemTxn) Discard(_ context.Context) {
+	t.done = true
+	t.ops = nil
+	t.pending = nil
+}
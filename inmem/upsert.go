@@ -0,0 +1,83 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// Upsert creates or updates the item while holding the lock. Versioned items
+// have to carry the current version if the record exists
+func (i *inmemStore) Upsert(_ context.Context, item gkvstore.Item) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return false, gkvstore.WrapError("Upsert", item, gkvstore.ErrStoreClosed)
+	}
+
+	changes := make(indexChanges)
+	created, err := i.upsert(item, changes)
+	i.applyIndexChanges(changes)
+
+	return created, gkvstore.WrapError("Upsert", item, err)
+}
+
+// upsert writes the item and collects the index changes. It has to be called
+// with the lock held
+func (i *inmemStore) upsert(item gkvstore.Item, changes indexChanges) (bool, error) {
+	if err := validate(item); err != nil {
+		return false, err
+	}
+
+	if ids, ok := item.(gkvstore.IDSetter); ok {
+		ids.SetID(fmt.Sprintf("%d", i.nonce.Inc()))
+	}
+
+	k := key(item)
+	if !i.found(k) {
+		// Expired item which is not yet reaped
+		i.removeKey(k, changes)
+	}
+	old, exists := i.meta[k]
+
+	m := &itemMeta{
+		namespace: item.GetNamespace(),
+		version:   1,
+		expiry:    gkvstore.ItemExpiry(item),
+		indexes:   gkvstore.ItemIndexes(item),
+	}
+	if exists {
+		m.version = old.version + 1
+	}
+	if v, ok := item.(gkvstore.Versioned); ok {
+		if exists && v.GetVersion() != old.version {
+			return false, gkvstore.ErrVersionConflict
+		}
+		v.SetVersion(m.version)
+	}
+
+	if tt, ok := item.(gkvstore.TimeTracker); ok {
+		timestamp := time.Now().UnixNano()
+		if exists && old.timeTrack {
+			tt.SetCreated(old.created)
+		} else {
+			tt.SetCreated(timestamp)
+		}
+		tt.SetUpdated(timestamp)
+		m.timeTrack = true
+		m.created = tt.GetCreated()
+		m.updated = timestamp
+	}
+
+	itemBuf, err := item.Marshal()
+	if err != nil {
+		return false, err
+	}
+
+	i.put(k, itemBuf, m, changes)
+
+	return !exists, nil
+}
@@ -0,0 +1,179 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+type rawEvent struct {
+	typ gkvstore.EventType
+	buf []byte
+}
+
+// watchQueueSize is the no of events queued for a watcher. Consumers which
+// fall further behind get ErrWatchOverflow and the watch is ended
+const watchQueueSize = 1024
+
+// watcher queues the events for a single Watch call. Writers only append to
+// the queue, so slow consumers never block the store operations. Events are
+// decoded in the watcher goroutine
+type watcher struct {
+	mu       sync.Mutex
+	queue    []rawEvent
+	overflow bool
+	signal   chan struct{}
+	done     chan struct{}
+}
+
+func newWatcher() *watcher {
+	return &watcher{
+		signal: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+func (w *watcher) push(ev rawEvent) {
+	w.mu.Lock()
+	switch {
+	case w.overflow:
+	case len(w.queue) == watchQueueSize:
+		// Queued events are not delivered anymore
+		w.queue, w.overflow = nil, true
+	default:
+		w.queue = append(w.queue, ev)
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) drain() ([]rawEvent, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	evs := w.queue
+	w.queue = nil
+	return evs, w.overflow
+}
+
+type watchers struct {
+	mu     sync.Mutex
+	subs   map[string]map[*watcher]struct{}
+	closed bool
+}
+
+// add registers the watcher. It returns false if the store is closed
+func (w *watchers) add(ns string, wt *watcher) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return false
+	}
+	if w.subs == nil {
+		w.subs = make(map[string]map[*watcher]struct{})
+	}
+	if _, found := w.subs[ns]; !found {
+		w.subs[ns] = make(map[*watcher]struct{})
+	}
+	w.subs[ns][wt] = struct{}{}
+	return true
+}
+
+func (w *watchers) remove(ns string, wt *watcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.subs[ns], wt)
+	if len(w.subs[ns]) == 0 {
+		delete(w.subs, ns)
+	}
+}
+
+func (w *watchers) notify(ns string, typ gkvstore.EventType, buf []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for wt := range w.subs[ns] {
+		wt.push(rawEvent{typ: typ, buf: buf})
+	}
+}
+
+// close ends all the watches. Watch fails after this
+func (w *watchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	for _, subs := range w.subs {
+		for wt := range subs {
+			close(wt.done)
+		}
+	}
+	w.subs = nil
+}
+
+// Watch returns the events till the context is cancelled or the store is
+// closed. If the consumer falls behind by more than watchQueueSize events,
+// the last event has ErrWatchOverflow and the channel is closed
+func (i *inmemStore) Watch(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.WatchOpt,
+) (<-chan *gkvstore.Event, error) {
+
+	ns := factory().GetNamespace()
+	wt := newWatcher()
+	if !i.watchers.add(ns, wt) {
+		return nil, gkvstore.WrapNamespaceError("Watch", ns, gkvstore.ErrStoreClosed)
+	}
+
+	res := make(chan *gkvstore.Event)
+	go func() {
+		defer close(res)
+		defer i.watchers.remove(ns, wt)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wt.done:
+				return
+			case <-wt.signal:
+			}
+			evs, overflow := wt.drain()
+			if overflow {
+				select {
+				case <-ctx.Done():
+				case <-wt.done:
+				case res <- &gkvstore.Event{Err: gkvstore.WrapNamespaceError("Watch", ns, gkvstore.ErrWatchOverflow)}:
+				}
+				return
+			}
+			for _, ev := range evs {
+				it := factory()
+				err := it.Unmarshal(ev.buf)
+				if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-wt.done:
+					return
+				case res <- &gkvstore.Event{Type: ev.typ, Val: it, Err: err}:
+				}
+			}
+		}
+	}()
+
+	return res, nil
+}
@@ -0,0 +1,213 @@
+// Package kv has the key and record encoding shared by the stores on ordered
+// key-value databases.
+//
+// Items are stored with keys of the form /namespace NUL id, so the items of a
+// namespace are listed in the natural order with a prefix iteration. The
+// created and updated timestamps, the secondary indexes and the expiry are
+// maintained as separate keys whose prefixes sort before '/'. Namespaces and
+// index names cannot contain the NUL character.
+package kv
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// Key prefixes. Item keys start with '/' and the indexes use prefixes which
+// sort before it
+const (
+	NoncePrefix   byte = 0x00
+	CreatedPrefix byte = 0x01
+	UpdatedPrefix byte = 0x02
+	IndexPrefix   byte = 0x03
+	ExpiryPrefix  byte = 0x04
+)
+
+// NonceKey stores the last ID generated for the IDSetter items
+var NonceKey = []byte{NoncePrefix, 'n', 'o', 'n', 'c', 'e'}
+
+// DataKey separates the namespace from the ID with NUL, which is not allowed
+// in the namespaces. So the keys of different items cannot be the same
+func DataKey(ns, id string) []byte {
+	return []byte("/" + ns + "\x00" + id)
+}
+
+func AppendUint64(k []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(k, buf[:]...)
+}
+
+func AppendUint32(k []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(k, buf[:]...)
+}
+
+// Concat returns a copy of the prefix followed by the strings
+func Concat(p []byte, s ...string) []byte {
+	k := append([]byte(nil), p...)
+	for _, v := range s {
+		k = append(k, v...)
+	}
+	return k
+}
+
+// TimePrefix is the prefix of the created or updated index keys of the
+// namespace. The keys are followed by the timestamp and the ID
+func TimePrefix(prefix byte, ns string) []byte {
+	k := make([]byte, 0, len(ns)+2)
+	k = append(k, prefix)
+	k = append(k, ns...)
+	return append(k, 0)
+}
+
+func TimeKey(prefix byte, ns string, ts int64, id string) []byte {
+	return append(AppendUint64(TimePrefix(prefix, ns), uint64(ts)), id...)
+}
+
+// ValuePrefix is the prefix of the secondary index keys. The keys are
+// followed by the index value, NUL and the ID
+func ValuePrefix(ns, name string) []byte {
+	k := make([]byte, 0, len(ns)+len(name)+3)
+	k = append(k, IndexPrefix)
+	k = append(k, ns...)
+	k = append(k, 0)
+	k = append(k, name...)
+	return append(k, 0)
+}
+
+func ValueKey(ns, name, val, id string) []byte {
+	k := append(ValuePrefix(ns, name), val...)
+	k = append(k, 0)
+	return append(k, id...)
+}
+
+// ExpiryKey orders the keys on the expiry, so the reaper only iterates over
+// the expired items
+func ExpiryKey(ts int64, ns, id string) []byte {
+	k := AppendUint64([]byte{ExpiryPrefix}, uint64(ts))
+	k = append(k, ns...)
+	k = append(k, 0)
+	return append(k, id...)
+}
+
+// Validate checks that the item can be encoded in the keys. The expiry is
+// stored unsigned in the keys, so it cannot be negative
+func Validate(item gkvstore.Item) error {
+	if strings.IndexByte(item.GetNamespace(), 0) != -1 {
+		return fmt.Errorf("%w: namespace cannot contain NUL", gkvstore.ErrInvalidItem)
+	}
+	if gkvstore.ItemExpiry(item) < 0 {
+		return fmt.Errorf("%w: negative expiry", gkvstore.ErrInvalidItem)
+	}
+	if idx, ok := item.(gkvstore.Indexable); ok {
+		for name := range idx.Indexes() {
+			if strings.IndexByte(name, 0) != -1 {
+				return fmt.Errorf("%w: index name cannot contain NUL", gkvstore.ErrInvalidItem)
+			}
+		}
+	}
+	return nil
+}
+
+// Meta is stored along with the serialized item. It is used to maintain the
+// indexes without having to unmarshal the items. The version and expiry are
+// stored in the Header
+type Meta struct {
+	Version   int64             `json:"-"`
+	Expiry    int64             `json:"-"`
+	TimeTrack bool              `json:"t,omitempty"`
+	Created   int64             `json:"c,omitempty"`
+	Updated   int64             `json:"u,omitempty"`
+	Indexes   map[string]string `json:"x,omitempty"`
+}
+
+func (m *Meta) Expired(now int64) bool {
+	return m.Expiry != 0 && m.Expiry <= now
+}
+
+func (m *Meta) Header() Header {
+	return Header{Version: m.Version, Expiry: m.Expiry}
+}
+
+// Header is the fixed size part of the record. It has the fields required
+// to skip the entries while listing, so the stores can also keep it in the
+// values of the index keys
+type Header struct {
+	Version int64
+	Expiry  int64
+}
+
+const HeaderSize = 16
+
+func (h Header) Expired(now int64) bool {
+	return h.Expiry != 0 && h.Expiry <= now
+}
+
+func (h Header) Append(buf []byte) []byte {
+	buf = AppendUint64(buf, uint64(h.Version))
+	return AppendUint64(buf, uint64(h.Expiry))
+}
+
+func DecodeHeader(buf []byte) (Header, []byte, error) {
+	if len(buf) < HeaderSize {
+		return Header{}, nil, errors.New("invalid header")
+	}
+	return Header{
+		Version: int64(binary.BigEndian.Uint64(buf)),
+		Expiry:  int64(binary.BigEndian.Uint64(buf[8:])),
+	}, buf[HeaderSize:], nil
+}
+
+// EncodeRecord stores the header, the rest of the meta and the item
+func EncodeRecord(m *Meta, item []byte) ([]byte, error) {
+	mbuf, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, HeaderSize+4+len(mbuf)+len(item))
+	buf = m.Header().Append(buf)
+	buf = AppendUint32(buf, uint32(len(mbuf)))
+	buf = append(buf, mbuf...)
+	return append(buf, item...), nil
+}
+
+func DecodeRecord(buf []byte) (*Meta, []byte, error) {
+	h, rest, err := DecodeHeader(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, err := metaSize(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &Meta{}
+	if err := json.Unmarshal(rest[4:4+l], m); err != nil {
+		return nil, nil, err
+	}
+	m.Version, m.Expiry = h.Version, h.Expiry
+	return m, rest[4+l:], nil
+}
+
+// RecordItem returns the item from the rest of the record after the header,
+// without decoding the meta
+func RecordItem(rest []byte) ([]byte, error) {
+	l, err := metaSize(rest)
+	if err != nil {
+		return nil, err
+	}
+	return rest[4+l:], nil
+}
+
+func metaSize(rest []byte) (int, error) {
+	if len(rest) < 4 || len(rest) < 4+int(binary.BigEndian.Uint32(rest)) {
+		return 0, errors.New("invalid record")
+	}
+	return int(binary.BigEndian.Uint32(rest)), nil
+}
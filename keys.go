@@ -0,0 +1,65 @@
+package gkvstore
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	// Key identifies a single item in the store
+	Key struct {
+		Namespace string
+		ID        string
+	}
+
+	// KeyResult contains a single result of the ListKeys operation
+	KeyResult struct {
+		Key    Key
+		Err    error
+		Cursor string
+	}
+
+	// KeyLister interface can be implemented by stores which can list the keys
+	// without unmarshalling the items. All the options of List are supported
+	// and the keys are returned in the same order as the items of List.
+	// The Factory is only used to obtain the namespace, unless a Filter is
+	// provided in which case the items have to be unmarshalled
+	KeyLister interface {
+		ListKeys(context.Context, Factory, ListOpt) (<-chan *KeyResult, error)
+	}
+)
+
+// ListKeys returns the keys using the KeyLister implementation if the store
+// supports it, else it uses the List results
+func ListKeys(ctx context.Context, st Store, factory Factory, opts ListOpt) (<-chan *KeyResult, error) {
+	if kl, ok := st.(KeyLister); ok {
+		res, err := kl.ListKeys(ctx, factory, opts)
+		if !errors.Is(err, ErrNotSupported) {
+			return res, err
+		}
+	}
+
+	res, err := st.List(ctx, factory, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(chan *KeyResult)
+	go func() {
+		defer close(keys)
+
+		for r := range res {
+			kr := &KeyResult{Err: r.Err, Cursor: r.Cursor}
+			if r.Val != nil {
+				kr.Key = Key{Namespace: r.Val.GetNamespace(), ID: r.Val.GetID()}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case keys <- kr:
+			}
+		}
+	}()
+
+	return keys, nil
+}
@@ -0,0 +1,370 @@
+// Package leveldbstore provides a persistent store on goleveldb.
+//
+// Items are stored with keys of the form /namespace NUL id, so listing in the
+// natural order is a prefix iteration. The created and updated timestamps,
+// the secondary indexes and the expiry are maintained as separate keys
+// written in the same batch as the item. The values of the index keys carry
+// the version and expiry of the item, so Page and Limit skip the entries
+// while iterating without reading or decoding the items. Namespaces cannot
+// contain the NUL character.
+package leveldbstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"go.uber.org/atomic"
+)
+
+// reapInterval is the interval at which the expiry keys are scanned to
+// remove the expired items
+const reapInterval = time.Second
+
+// Options configure the store
+type Options struct {
+	// SyncWrites syncs the write ahead log on every write. Recent writes can
+	// be lost on a machine crash if it is not set
+	SyncWrites bool
+	// LevelDB options used to open the database. Defaults of goleveldb are
+	// used if not provided
+	LevelDB *opt.Options
+}
+
+type levelStore struct {
+	// mu serializes the writes, so the checks and the batch are atomic
+	mu    sync.Mutex
+	nonce atomic.Int64
+	db    *leveldb.DB
+	wopts *opt.WriteOptions
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New opens the database in the directory, creating it if required. A
+// background routine removes the expired items, which is stopped on Close.
+// The store is not usable after Close
+func New(path string, opts Options) (gkvstore.Store, error) {
+	db, err := leveldb.OpenFile(path, opts.LevelDB)
+	if err != nil {
+		return nil, fmt.Errorf("leveldbstore: failed opening %s: %w", path, err)
+	}
+	st := &levelStore{
+		db:    db,
+		wopts: &opt.WriteOptions{Sync: opts.SyncWrites},
+		stop:  make(chan struct{}),
+	}
+
+	buf, err := db.Get(kv.NonceKey, nil)
+	switch {
+	case err == nil && len(buf) == 8:
+		st.nonce.Store(int64(binary.BigEndian.Uint64(buf)))
+	case err != nil && !errors.Is(err, leveldb.ErrNotFound):
+		db.Close()
+		return nil, fmt.Errorf("leveldbstore: failed reading %s: %w", path, err)
+	}
+
+	st.wg.Add(1)
+	go st.reaper()
+	return st, nil
+}
+
+// reader is the database or a snapshot of it
+type reader interface {
+	Get([]byte, *opt.ReadOptions) ([]byte, error)
+}
+
+// lookup returns the record of the item. Expired items which are not yet
+// removed are returned as well
+func lookup(r reader, ns, id string) (*kv.Meta, []byte, bool, error) {
+	buf, err := r.Get(kv.DataKey(ns, id), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil, false, nil
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	m, item, err := kv.DecodeRecord(buf)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// live returns the record if the item exists and is not expired. Expired
+// items are removed by the reaper, till then they are treated as
+// non-existent
+func live(r reader, ns, id string) (*kv.Meta, []byte, bool, error) {
+	m, item, exists, err := lookup(r, ns, id)
+	if err != nil || !exists || m.Expired(time.Now().UnixNano()) {
+		return nil, nil, false, err
+	}
+	return m, item, true, nil
+}
+
+// indexKeys returns the index keys of the item. The values are the header
+// followed by the ID, so the listing can skip the entries without reading
+// the item
+func indexKeys(ns, id string, m *kv.Meta) map[string][]byte {
+	val := append(m.Header().Append(nil), id...)
+	keys := make(map[string][]byte)
+	if m.TimeTrack {
+		keys[string(kv.TimeKey(kv.CreatedPrefix, ns, m.Created, id))] = val
+		keys[string(kv.TimeKey(kv.UpdatedPrefix, ns, m.Updated, id))] = val
+	}
+	for name, v := range m.Indexes {
+		keys[string(kv.ValueKey(ns, name, v, id))] = val
+	}
+	if m.Expiry != 0 {
+		keys[string(kv.ExpiryKey(m.Expiry, ns, id))] = nil
+	}
+	return keys
+}
+
+// write adds the item and its index keys to the batch. All the index keys
+// are written again as the version in their values changes
+func write(b *leveldb.Batch, ns, id string, old, m *kv.Meta, item []byte) error {
+	newKeys := indexKeys(ns, id, m)
+	if old != nil {
+		for k := range indexKeys(ns, id, old) {
+			if _, found := newKeys[k]; !found {
+				b.Delete([]byte(k))
+			}
+		}
+	}
+	for k, v := range newKeys {
+		b.Put([]byte(k), v)
+	}
+	rec, err := kv.EncodeRecord(m, item)
+	if err != nil {
+		return err
+	}
+	b.Put(kv.DataKey(ns, id), rec)
+	return nil
+}
+
+// remove adds the deletes of the item and its index keys to the batch
+func remove(b *leveldb.Batch, ns, id string, m *kv.Meta) {
+	for k := range indexKeys(ns, id, m) {
+		b.Delete([]byte(k))
+	}
+	b.Delete(kv.DataKey(ns, id))
+}
+
+// storeErr returns ErrStoreClosed for the operations after Close
+func storeErr(err error) error {
+	if errors.Is(err, leveldb.ErrClosed) {
+		return gkvstore.ErrStoreClosed
+	}
+	return err
+}
+
+// update runs the function with a batch which is written if it succeeds
+func (l *levelStore) update(fn func(*leveldb.Batch) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := new(leveldb.Batch)
+	if err := fn(b); err != nil {
+		return storeErr(err)
+	}
+	return storeErr(l.db.Write(b, l.wopts))
+}
+
+func (l *levelStore) Create(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Create", item, l.update(func(b *leveldb.Batch) error {
+		if ids, ok := item.(gkvstore.IDSetter); ok {
+			n := l.nonce.Inc()
+			ids.SetID(fmt.Sprintf("%d", n))
+			b.Put(kv.NonceKey, kv.AppendUint64(nil, uint64(n)))
+		}
+		if err := kv.Validate(item); err != nil {
+			return err
+		}
+
+		ns, id := item.GetNamespace(), item.GetID()
+		old, _, exists, err := lookup(l.db, ns, id)
+		if err != nil {
+			return err
+		}
+		if exists && !old.Expired(time.Now().UnixNano()) {
+			return gkvstore.ErrRecordAlreadyExists
+		}
+
+		m := &kv.Meta{
+			Version: 1,
+			Expiry:  gkvstore.ItemExpiry(item),
+			Indexes: gkvstore.ItemIndexes(item),
+		}
+
+		if tt, ok := item.(gkvstore.TimeTracker); ok {
+			timestamp := time.Now().UnixNano()
+			tt.SetCreated(timestamp)
+			tt.SetUpdated(timestamp)
+			m.TimeTrack = true
+			m.Created = timestamp
+			m.Updated = timestamp
+		}
+
+		if v, ok := item.(gkvstore.Versioned); ok {
+			v.SetVersion(1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+		// Expired item which is not yet reaped is replaced
+		return write(b, ns, id, old, m, itemBuf)
+	}))
+}
+
+func (l *levelStore) Read(ctx context.Context, item gkvstore.Item) error {
+	_, buf, exists, err := live(l.db, item.GetNamespace(), item.GetID())
+	if err != nil {
+		return gkvstore.WrapError("Read", item, storeErr(err))
+	}
+	if !exists {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+	}
+	return gkvstore.WrapError("Read", item, item.Unmarshal(buf))
+}
+
+func (l *levelStore) Update(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Update", item, l.update(func(b *leveldb.Batch) error {
+		if err := kv.Validate(item); err != nil {
+			return err
+		}
+
+		ns, id := item.GetNamespace(), item.GetID()
+		old, _, exists, err := lookup(l.db, ns, id)
+		if err != nil {
+			return err
+		}
+		prev := old
+		if exists && old.Expired(time.Now().UnixNano()) {
+			exists = false
+		}
+
+		var version int64
+		if exists {
+			version = old.Version
+		}
+		v, versioned := item.(gkvstore.Versioned)
+		if versioned && v.GetVersion() != version {
+			return gkvstore.ErrVersionConflict
+		}
+
+		m := &kv.Meta{
+			Version: version + 1,
+			Expiry:  gkvstore.ItemExpiry(item),
+			Indexes: gkvstore.ItemIndexes(item),
+		}
+
+		if tt, ok := item.(gkvstore.TimeTracker); ok {
+			timestamp := time.Now().UnixNano()
+			if exists && old.TimeTrack {
+				tt.SetCreated(old.Created)
+			} else {
+				tt.SetCreated(timestamp)
+			}
+			tt.SetUpdated(timestamp)
+			m.TimeTrack = true
+			m.Created = tt.GetCreated()
+			m.Updated = timestamp
+		}
+
+		if versioned {
+			v.SetVersion(version + 1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+		return write(b, ns, id, prev, m, itemBuf)
+	}))
+}
+
+func (l *levelStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Delete", item, l.update(func(b *leveldb.Batch) error {
+		ns, id := item.GetNamespace(), item.GetID()
+		m, _, exists, err := lookup(l.db, ns, id)
+		if err != nil || !exists {
+			return err
+		}
+		remove(b, ns, id, m)
+		return nil
+	}))
+}
+
+func (l *levelStore) reaper() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			// Failed removals are retried on the next run
+			_ = l.reap()
+		}
+	}
+}
+
+// reap removes the expired items in a single batch
+func (l *levelStore) reap() error {
+	now := time.Now().UnixNano()
+	return l.update(func(b *leveldb.Batch) error {
+		iter := l.db.NewIterator(&util.Range{
+			Start: []byte{kv.ExpiryPrefix},
+			Limit: kv.AppendUint64([]byte{kv.ExpiryPrefix}, uint64(now)+1),
+		}, nil)
+		defer iter.Release()
+
+		for iter.Next() {
+			k := iter.Key()
+			sep := bytes.IndexByte(k[9:], 0)
+			ns, id := string(k[9:9+sep]), string(k[10+sep:])
+			m, _, exists, err := lookup(l.db, ns, id)
+			if err != nil {
+				return err
+			}
+			if !exists || !m.Expired(now) {
+				// Stale expiry key
+				b.Delete(append([]byte(nil), k...))
+				continue
+			}
+			remove(b, ns, id, m)
+		}
+		return iter.Error()
+	})
+}
+
+// Close stops the reaper and closes the database
+func (l *levelStore) Close() error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.wg.Wait()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.db.Close(); err != nil && !errors.Is(err, leveldb.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package leveldbstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/leveldbstore"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func TestSuite(t *testing.T) {
+	st, err := leveldbstore.New(filepath.Join(t.TempDir(), "store"), leveldbstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testsuite.RunTestsuite(t, st, testsuite.Advanced)
+}
+
+func BenchmarkSuite(b *testing.B) {
+	st, err := leveldbstore.New(filepath.Join(b.TempDir(), "store"), leveldbstore.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer st.Close()
+
+	testsuite.BenchmarkSuite(b, st)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+func docID(i int) string {
+	return fmt.Sprintf("%04d", i)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store")
+
+	st, err := leveldbstore.New(path, leveldbstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		doc := &document{Id: docID(i), Text: "created"}
+		if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(&document{})); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i += 2 {
+		if err := st.Delete(context.TODO(), autoencoding.MustNew(&document{Id: docID(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), autoencoding.MustNew(&document{Id: docID(1)})); !errors.Is(err, gkvstore.ErrStoreClosed) {
+		t.Fatal("expected store closed error", err)
+	}
+
+	st, err = leveldbstore.New(path, leveldbstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for i := 0; i < 100; i++ {
+		doc := &document{Id: docID(i)}
+		err := st.Read(context.TODO(), autoencoding.MustNew(doc))
+		if i%2 == 0 {
+			if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+				t.Fatal("expected deleted document", doc.Id, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if doc.Text != "created" {
+			t.Fatal("incorrect document", doc.Id)
+		}
+	}
+
+	// Nonce continues after reopening
+	doc := &document{}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Id != "102" {
+		t.Fatal("unexpected ID", doc.Id)
+	}
+}
+
+// TestSkip checks that the items skipped by the Page are not decoded
+func TestSkip(t *testing.T) {
+	st, err := leveldbstore.New(filepath.Join(t.TempDir(), "store"), leveldbstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := st.Create(context.TODO(), autoencoding.MustNew(&document{Id: docID(i)})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, sort := range []gkvstore.Sort{gkvstore.SortNatural, gkvstore.SortCreatedDesc, gkvstore.SortUpdatedAsc} {
+		decoded := 0
+		res, err := st.List(context.TODO(), func() gkvstore.Item {
+			decoded++
+			return autoencoding.MustNew(&document{})
+		}, gkvstore.ListOpt{Sort: sort, Page: 8, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for r := range res {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			ids = append(ids, r.Val.GetID())
+		}
+		if len(ids) != 10 {
+			t.Fatal("incorrect no of documents", sort, len(ids))
+		}
+		if sort == gkvstore.SortCreatedDesc && ids[0] != docID(19) {
+			t.Fatal("incorrect page", ids[0])
+		}
+		if sort != gkvstore.SortCreatedDesc && ids[0] != docID(80) {
+			t.Fatal("incorrect page", sort, ids[0])
+		}
+		// Factory is used once for the namespace
+		if decoded != 11 {
+			t.Fatal("skipped documents decoded", sort, decoded)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package leveldbstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/internal/kv"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// listRange is the range of keys to iterate for the listing order
+type listRange struct {
+	prefix []byte
+	rng    util.Range
+	desc   bool
+	// items is set if the iteration is over the item keys, else the values
+	// are the IDs of the items
+	items bool
+	// values is set if the iteration is over the secondary index keys
+	values bool
+}
+
+func newRange(ns string, opts gkvstore.ListOpt) (*listRange, error) {
+	r := &listRange{}
+	switch {
+	// Natural order with index query is the order of the index values
+	case opts.Index.Name != "" && opts.Sort == gkvstore.SortNatural:
+		r.prefix, r.values = kv.ValuePrefix(ns, opts.Index.Name), true
+		if opts.Index.Value != "" {
+			r.rng.Start = append(kv.Concat(r.prefix, opts.Index.Value), 0)
+			r.rng.Limit = util.BytesPrefix(r.rng.Start).Limit
+			break
+		}
+		r.rng.Start = kv.Concat(r.prefix, opts.Index.Start)
+		if opts.Index.End != "" {
+			r.rng.Limit = kv.Concat(r.prefix, opts.Index.End)
+		}
+	// Natural order is the order of the IDs
+	case opts.Sort == gkvstore.SortNatural || opts.Sort == gkvstore.SortIDAsc || opts.Sort == gkvstore.SortIDDesc:
+		r.prefix, r.items = kv.DataKey(ns, ""), true
+		start := opts.StartID
+		if opts.IDPrefix > start {
+			start = opts.IDPrefix
+		}
+		r.rng.Start = kv.Concat(r.prefix, start)
+		if opts.EndID != "" {
+			r.rng.Limit = kv.Concat(r.prefix, opts.EndID)
+		}
+		if opts.IDPrefix != "" {
+			end := util.BytesPrefix(kv.Concat(r.prefix, opts.IDPrefix)).Limit
+			if r.rng.Limit == nil || (end != nil && bytes.Compare(end, r.rng.Limit) < 0) {
+				r.rng.Limit = end
+			}
+		}
+		r.desc = opts.Sort == gkvstore.SortIDDesc
+	case opts.Sort == gkvstore.SortCreatedAsc || opts.Sort == gkvstore.SortCreatedDesc:
+		r.prefix = kv.TimePrefix(kv.CreatedPrefix, ns)
+		r.rng.Start = r.prefix
+		r.desc = opts.Sort == gkvstore.SortCreatedDesc
+	case opts.Sort == gkvstore.SortUpdatedAsc || opts.Sort == gkvstore.SortUpdatedDesc:
+		r.prefix = kv.TimePrefix(kv.UpdatedPrefix, ns)
+		r.rng.Start = r.prefix
+		r.desc = opts.Sort == gkvstore.SortUpdatedDesc
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+	if r.rng.Limit == nil {
+		r.rng.Limit = util.BytesPrefix(r.prefix).Limit
+	}
+
+	if opts.Cursor != "" {
+		c, err := gkvstore.DecodeCursor(opts.Cursor, opts.Sort)
+		if err != nil {
+			return nil, err
+		}
+		k := c.Key
+		if !bytes.HasPrefix(k, r.prefix) {
+			return nil, gkvstore.ErrInvalidCursor
+		}
+		if r.desc {
+			r.rng.Limit = k
+		} else {
+			r.rng.Start = append(k, 0)
+		}
+	}
+	return r, nil
+}
+
+// entry is a key of the iteration which matches the list options
+type entry struct {
+	key []byte
+	id  string
+	// record is set if the item key was iterated
+	record []byte
+}
+
+// scanner iterates over a snapshot of the database in the listing order
+type scanner struct {
+	ns   string
+	opts gkvstore.ListOpt
+	r    *listRange
+	snap *leveldb.Snapshot
+	now  int64
+}
+
+func (l *levelStore) newScanner(ns string, opts gkvstore.ListOpt) (*scanner, error) {
+	r, err := newRange(ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := l.db.GetSnapshot()
+	if err != nil {
+		return nil, storeErr(err)
+	}
+	return &scanner{ns: ns, opts: opts, r: r, snap: snap, now: time.Now().UnixNano()}, nil
+}
+
+// match checks the key and the header in its value against the options.
+// Index values are only read from the records if the iteration is not over
+// the secondary index keys
+func (s *scanner) match(k, val []byte) (entry, bool, error) {
+	e := entry{key: k}
+	h, rest, err := kv.DecodeHeader(val)
+	if err != nil {
+		return e, true, err
+	}
+	if s.r.items {
+		e.id, e.record = string(k[len(s.r.prefix):]), rest
+	} else {
+		e.id = string(rest)
+	}
+
+	if h.Expired(s.now) || h.Version < s.opts.Version || !s.opts.MatchID(e.id) {
+		return e, false, nil
+	}
+	if s.opts.Index.Name == "" {
+		return e, true, nil
+	}
+	if s.r.values {
+		v := k[len(s.r.prefix):]
+		v = v[:bytes.IndexByte(v, 0)]
+		return e, s.opts.Index.Match(string(v)), nil
+	}
+	m, _, found, err := lookup(s.snap, s.ns, e.id)
+	if err != nil || !found {
+		return e, err != nil, err
+	}
+	v, found := m.Indexes[s.opts.Index.Name]
+	return e, found && s.opts.Index.Match(v), nil
+}
+
+// item returns the serialized item of the entry
+func (s *scanner) item(e entry) ([]byte, error) {
+	if e.record != nil {
+		return kv.RecordItem(e.record)
+	}
+	_, item, found, err := lookup(s.snap, s.ns, e.id)
+	if err == nil && !found {
+		return nil, gkvstore.ErrRecordNotFound
+	}
+	return item, err
+}
+
+// scan calls the function for the entries matching the options till it
+// returns false. Entries skipped by the Page are not read unless they have
+// to be filtered. The item is decoded only if required or a Filter is used
+func (s *scanner) scan(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	withItem bool,
+	fn func(entry, gkvstore.Item, error) bool,
+) error {
+	defer s.snap.Release()
+
+	iter := s.snap.NewIterator(&s.r.rng, nil)
+	defer iter.Release()
+
+	skip := s.opts.Page * s.opts.Limit
+	if s.opts.Cursor != "" {
+		skip = 0
+	}
+
+	next, step := iter.First, iter.Next
+	if s.r.desc {
+		next, step = iter.Last, iter.Prev
+	}
+	for ; next(); next = step {
+		if ctx.Err() != nil {
+			return nil
+		}
+		e, found, err := s.match(iter.Key(), iter.Value())
+		if !found {
+			continue
+		}
+		// Iterator buffers are reused
+		e.key = append([]byte(nil), e.key...)
+		if err == nil && skip > 0 && s.opts.Filter == nil {
+			skip--
+			continue
+		}
+
+		var it gkvstore.Item
+		if err == nil && (withItem || s.opts.Filter != nil) {
+			var buf []byte
+			buf, err = s.item(e)
+			if errors.Is(err, gkvstore.ErrRecordNotFound) {
+				continue
+			}
+			it = factory()
+			if err == nil {
+				err = it.Unmarshal(buf)
+			}
+			if s.opts.Filter != nil && err == nil && !s.opts.Filter.Compare(it) {
+				continue
+			}
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if !fn(e, it, err) {
+			return nil
+		}
+	}
+	return storeErr(iter.Error())
+}
+
+func (l *levelStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	s, err := l.newScanner(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+	res := make(chan *gkvstore.Result)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := s.scan(ctx, factory, true, func(e entry, it gkvstore.Item, err error) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- &gkvstore.Result{Val: it, Err: err, Cursor: gkvstore.Cursor{Sort: opts.Sort, Key: e.key}.Encode()}:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.Result{Err: gkvstore.WrapNamespaceError("List", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+func (l *levelStore) ListKeys(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.KeyResult, error) {
+
+	ns := factory().GetNamespace()
+	s, err := l.newScanner(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+	}
+	res := make(chan *gkvstore.KeyResult)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := s.scan(ctx, factory, false, func(e entry, _ gkvstore.Item, err error) bool {
+			kr := &gkvstore.KeyResult{
+				Key:    gkvstore.Key{Namespace: ns, ID: e.id},
+				Err:    err,
+				Cursor: gkvstore.Cursor{Sort: opts.Sort, Key: e.key}.Encode(),
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- kr:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.KeyResult{Err: gkvstore.WrapNamespaceError("ListKeys", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+// Count iterates over the keys. Items are read only if a Filter is provided
+func (l *levelStore) Count(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (int64, error) {
+
+	ns := factory().GetNamespace()
+	opts.Sort, opts.Page, opts.Limit, opts.Cursor = gkvstore.SortNatural, 0, 0, ""
+	s, err := l.newScanner(ns, opts)
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+
+	var (
+		count int64
+		ferr  error
+	)
+	err = s.scan(ctx, factory, false, func(_ entry, _ gkvstore.Item, err error) bool {
+		if err != nil {
+			ferr = err
+			return false
+		}
+		count++
+		return true
+	})
+	if err == nil {
+		err = ferr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,24 @@
+package gkvstore
+
+import "context"
+
+type (
+	// NamespaceStats is the summary of the items stored in a namespace
+	NamespaceStats struct {
+		Namespace string
+		// Items is the no of items in the namespace
+		Items int64
+		// Size is the total size of the serialized items in bytes
+		Size int64
+		// LastUpdated is the latest Updated timestamp of the TimeTracker items
+		LastUpdated int64
+	}
+
+	// NamespaceManager interface can be implemented by stores which can
+	// enumerate and drop namespaces without listing the items
+	NamespaceManager interface {
+		ListNamespaces(context.Context) ([]string, error)
+		DropNamespace(context.Context, string) error
+		NamespaceStats(context.Context, string) (NamespaceStats, error)
+	}
+)
@@ -0,0 +1,157 @@
+package gkvstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Patch is a partial update of an Item. Fields in the mask are copied from
+	// the Source item first and then the Merge patch is applied
+	Patch struct {
+		// Merge is a RFC 7396 JSON merge patch document
+		Merge []byte
+		// Fields is the field mask. Nested fields are separated by '.'
+		Fields []string
+		// Source provides the values of the fields in the mask
+		Source Item
+	}
+
+	// Patchable interface is implemented by items which can apply a Patch on
+	// their current value
+	Patchable interface {
+		ApplyPatch(Patch) error
+	}
+
+	// Patcher interface can be implemented by stores which can apply patches
+	// atomically. The item is used to identify the record and holds the patched
+	// value on success
+	Patcher interface {
+		Patch(context.Context, Item, Patch) error
+	}
+)
+
+// PatchItem applies the patch using the Patcher implementation if the store
+// supports it, else it reads the item, applies the patch and updates it. The
+// fallback is not atomic, so concurrent writes can only be detected for
+// Versioned items
+func PatchItem(ctx context.Context, st Store, item Item, p Patch) error {
+	if ps, ok := st.(Patcher); ok {
+		err := ps.Patch(ctx, item, p)
+		if !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+
+	pi, ok := item.(Patchable)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := st.Read(ctx, item); err != nil {
+		return err
+	}
+	ns, id := item.GetNamespace(), item.GetID()
+	if err := pi.ApplyPatch(p); err != nil {
+		return &StoreError{Op: "Patch", Namespace: ns, ID: id, Err: err}
+	}
+	if item.GetNamespace() != ns || item.GetID() != id {
+		return &StoreError{
+			Op:        "Patch",
+			Namespace: ns,
+			ID:        id,
+			Err:       fmt.Errorf("%w: patch cannot modify the item key", ErrInvalidItem),
+		}
+	}
+	return st.Update(ctx, item)
+}
+
+// MergePatch applies the RFC 7396 merge patch on a decoded document
+func MergePatch(doc, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	dm, ok := doc.(map[string]interface{})
+	if !ok {
+		dm = make(map[string]interface{})
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(dm, k)
+			continue
+		}
+		dm[k] = MergePatch(dm[k], v)
+	}
+	return dm
+}
+
+// ApplyFieldMask copies the fields in the mask from the source document to the
+// target. Fields missing in the source are removed from the target
+func ApplyFieldMask(doc, source interface{}, fields []string) interface{} {
+	dm, ok := doc.(map[string]interface{})
+	if !ok {
+		dm = make(map[string]interface{})
+	}
+	for _, f := range fields {
+		path := strings.Split(f, ".")
+		val, found := lookupField(source, path)
+		setField(dm, path, val, found)
+	}
+	return dm
+}
+
+func lookupField(doc interface{}, path []string) (interface{}, bool) {
+	for _, p := range path {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		doc, ok = m[p]
+		if !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func setField(doc map[string]interface{}, path []string, val interface{}, found bool) {
+	for _, p := range path[:len(path)-1] {
+		next, ok := doc[p].(map[string]interface{})
+		if !ok {
+			if !found {
+				return
+			}
+			next = make(map[string]interface{})
+			doc[p] = next
+		}
+		doc = next
+	}
+	if !found {
+		delete(doc, path[len(path)-1])
+		return
+	}
+	doc[path[len(path)-1]] = val
+}
+
+// MergeJSON applies the RFC 7396 merge patch on the JSON document. Numbers are
+// kept as is, so large integers don't lose precision
+func MergeJSON(doc, patch []byte) ([]byte, error) {
+	var d, p interface{}
+	if err := decodeJSON(doc, &d); err != nil {
+		return nil, err
+	}
+	if err := decodeJSON(patch, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(MergePatch(d, p))
+}
+
+func decodeJSON(buf []byte, val interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return dec.Decode(val)
+}
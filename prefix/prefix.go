@@ -3,6 +3,7 @@ package prefixstore
 import (
 	"context"
 	"errors"
+	"sort"
 	"strings"
 
 	"github.com/plexsysio/gkvstore"
@@ -13,7 +14,10 @@ type prefixStore struct {
 	stores map[string]gkvstore.Store
 }
 
-var ErrStoreNotConfigured error = errors.New("prefix store not configured")
+var (
+	ErrStoreNotConfigured error = errors.New("prefix store not configured")
+	ErrMultipleStores     error = errors.New("transaction spans multiple stores")
+)
 
 type Mount struct {
 	Prefix string
@@ -31,18 +35,27 @@ func New(mnts ...Mount) gkvstore.Store {
 }
 
 func (t *prefixStore) getStore(prefix string) (gkvstore.Store, bool) {
-	for k, v := range t.stores {
+	m, found := t.mount(prefix)
+	if !found {
+		return nil, false
+	}
+	return t.stores[m], true
+}
+
+// mount returns the prefix of the store configured for the namespace
+func (t *prefixStore) mount(prefix string) (string, bool) {
+	for k := range t.stores {
 		if strings.HasPrefix(prefix, k) {
-			return v, true
+			return k, true
 		}
 	}
-	return nil, false
+	return "", false
 }
 
 func (t *prefixStore) Create(ctx context.Context, item gkvstore.Item) error {
 	st, found := t.getStore(item.GetNamespace())
 	if !found {
-		return ErrStoreNotConfigured
+		return gkvstore.WrapError("Create", item, ErrStoreNotConfigured)
 	}
 	return st.Create(ctx, item)
 }
@@ -50,7 +63,7 @@ func (t *prefixStore) Create(ctx context.Context, item gkvstore.Item) error {
 func (t *prefixStore) Read(ctx context.Context, item gkvstore.Item) error {
 	st, found := t.getStore(item.GetNamespace())
 	if !found {
-		return ErrStoreNotConfigured
+		return gkvstore.WrapError("Read", item, ErrStoreNotConfigured)
 	}
 	return st.Read(ctx, item)
 }
@@ -58,7 +71,7 @@ func (t *prefixStore) Read(ctx context.Context, item gkvstore.Item) error {
 func (t *prefixStore) Update(ctx context.Context, item gkvstore.Item) error {
 	st, found := t.getStore(item.GetNamespace())
 	if !found {
-		return ErrStoreNotConfigured
+		return gkvstore.WrapError("Update", item, ErrStoreNotConfigured)
 	}
 	return st.Update(ctx, item)
 }
@@ -66,7 +79,7 @@ func (t *prefixStore) Update(ctx context.Context, item gkvstore.Item) error {
 func (t *prefixStore) Delete(ctx context.Context, item gkvstore.Item) error {
 	st, found := t.getStore(item.GetNamespace())
 	if !found {
-		return ErrStoreNotConfigured
+		return gkvstore.WrapError("Delete", item, ErrStoreNotConfigured)
 	}
 	return st.Delete(ctx, item)
 }
@@ -74,7 +87,7 @@ func (t *prefixStore) Delete(ctx context.Context, item gkvstore.Item) error {
 func (t *prefixStore) List(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.Result, error) {
 	st, found := t.getStore(factory().GetNamespace())
 	if !found {
-		return nil, ErrStoreNotConfigured
+		return nil, gkvstore.WrapNamespaceError("List", factory().GetNamespace(), ErrStoreNotConfigured)
 	}
 	return st.List(ctx, factory, opts)
 }
@@ -86,3 +99,284 @@ func (t *prefixStore) Close() error {
 	}
 	return err
 }
+
+// NewTransaction returns a transaction which is bound to the store mounted for
+// the first item used in it. Items from other mounts are rejected as the
+// commit cannot be atomic across different stores
+func (t *prefixStore) NewTransaction(_ context.Context) (gkvstore.Txn, error) {
+	return &prefixTxn{store: t}, nil
+}
+
+type prefixTxn struct {
+	store *prefixStore
+	st    gkvstore.Store
+	txn   gkvstore.Txn
+	done  bool
+}
+
+func (t *prefixTxn) getTxn(ctx context.Context, item gkvstore.Item) (gkvstore.Txn, error) {
+	if t.done {
+		return nil, gkvstore.ErrTxnClosed
+	}
+	st, found := t.store.getStore(item.GetNamespace())
+	if !found {
+		return nil, gkvstore.WrapError("Txn", item, ErrStoreNotConfigured)
+	}
+	if t.txn != nil {
+		if st != t.st {
+			return nil, gkvstore.WrapError("Txn", item, ErrMultipleStores)
+		}
+		return t.txn, nil
+	}
+	txnStore, ok := st.(gkvstore.Transactional)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+	txn, err := txnStore.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.st, t.txn = st, txn
+	return txn, nil
+}
+
+func (t *prefixTxn) Create(ctx context.Context, item gkvstore.Item) error {
+	txn, err := t.getTxn(ctx, item)
+	if err != nil {
+		return err
+	}
+	return txn.Create(ctx, item)
+}
+
+func (t *prefixTxn) Read(ctx context.Context, item gkvstore.Item) error {
+	txn, err := t.getTxn(ctx, item)
+	if err != nil {
+		return err
+	}
+	return txn.Read(ctx, item)
+}
+
+func (t *prefixTxn) Update(ctx context.Context, item gkvstore.Item) error {
+	txn, err := t.getTxn(ctx, item)
+	if err != nil {
+		return err
+	}
+	return txn.Update(ctx, item)
+}
+
+func (t *prefixTxn) Delete(ctx context.Context, item gkvstore.Item) error {
+	txn, err := t.getTxn(ctx, item)
+	if err != nil {
+		return err
+	}
+	return txn.Delete(ctx, item)
+}
+
+func (t *prefixTxn) Commit(ctx context.Context) error {
+	if t.done {
+		return gkvstore.ErrTxnClosed
+	}
+	t.done = true
+	if t.txn == nil {
+		return nil
+	}
+	return t.txn.Commit(ctx)
+}
+
+func (t *prefixTxn) Discard(ctx context.Context) {
+	t.done = true
+	if t.txn != nil {
+		t.txn.Discard(ctx)
+	}
+}
+
+// NewBatch returns a batch which queues the operations on a separate batch for
+// each mount. Mounts which do not support batching natively use the generic
+// implementation
+func (t *prefixStore) NewBatch(_ context.Context) (gkvstore.Batcher, error) {
+	return &prefixBatch{
+		store:   t,
+		batches: make(map[gkvstore.Store]gkvstore.Batcher),
+	}, nil
+}
+
+type prefixBatch struct {
+	store   *prefixStore
+	batches map[gkvstore.Store]gkvstore.Batcher
+}
+
+func (t *prefixBatch) getBatch(ctx context.Context, item gkvstore.Item) (gkvstore.Batcher, error) {
+	st, found := t.store.getStore(item.GetNamespace())
+	if !found {
+		return nil, gkvstore.WrapError("Batch", item, ErrStoreNotConfigured)
+	}
+	b, found := t.batches[st]
+	if !found {
+		var err error
+		b, err = gkvstore.NewBatch(ctx, st)
+		if err != nil {
+			return nil, err
+		}
+		t.batches[st] = b
+	}
+	return b, nil
+}
+
+func (t *prefixBatch) Put(ctx context.Context, item gkvstore.Item) error {
+	b, err := t.getBatch(ctx, item)
+	if err != nil {
+		return err
+	}
+	return b.Put(ctx, item)
+}
+
+func (t *prefixBatch) Delete(ctx context.Context, item gkvstore.Item) error {
+	b, err := t.getBatch(ctx, item)
+	if err != nil {
+		return err
+	}
+	return b.Delete(ctx, item)
+}
+
+func (t *prefixBatch) Commit(ctx context.Context) error {
+	var err error
+	for st, b := range t.batches {
+		multierr.AppendInto(&err, b.Commit(ctx))
+		delete(t.batches, st)
+	}
+	return err
+}
+
+func (t *prefixStore) Watch(ctx context.Context, factory gkvstore.Factory, opts gkvstore.WatchOpt) (<-chan *gkvstore.Event, error) {
+	st, found := t.getStore(factory().GetNamespace())
+	if !found {
+		return nil, gkvstore.WrapNamespaceError("Watch", factory().GetNamespace(), ErrStoreNotConfigured)
+	}
+	watchStore, ok := st.(gkvstore.Watcher)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+	return watchStore.Watch(ctx, factory, opts)
+}
+
+func (t *prefixStore) Count(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (int64, error) {
+	st, found := t.getStore(factory().GetNamespace())
+	if !found {
+		return 0, gkvstore.WrapNamespaceError("Count", factory().GetNamespace(), ErrStoreNotConfigured)
+	}
+	return gkvstore.Count(ctx, st, factory, opts)
+}
+
+func (t *prefixStore) ListKeys(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.KeyResult, error) {
+	st, found := t.getStore(factory().GetNamespace())
+	if !found {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", factory().GetNamespace(), ErrStoreNotConfigured)
+	}
+	return gkvstore.ListKeys(ctx, st, factory, opts)
+}
+
+func (t *prefixStore) Patch(ctx context.Context, item gkvstore.Item, p gkvstore.Patch) error {
+	st, found := t.getStore(item.GetNamespace())
+	if !found {
+		return gkvstore.WrapError("Patch", item, ErrStoreNotConfigured)
+	}
+	return gkvstore.PatchItem(ctx, st, item, p)
+}
+
+func (t *prefixStore) Upsert(ctx context.Context, item gkvstore.Item) (bool, error) {
+	st, found := t.getStore(item.GetNamespace())
+	if !found {
+		return false, gkvstore.WrapError("Upsert", item, ErrStoreNotConfigured)
+	}
+	return gkvstore.Upsert(ctx, st, item)
+}
+
+// ReadMany groups the items by the mounted stores, so each store gets a
+// single call
+func (t *prefixStore) ReadMany(ctx context.Context, items []gkvstore.Item) []error {
+	errs := make([]error, len(items))
+	groups := make(map[string][]int)
+	for idx, item := range items {
+		m, found := t.mount(item.GetNamespace())
+		if !found {
+			errs[idx] = gkvstore.WrapError("ReadMany", item, ErrStoreNotConfigured)
+			continue
+		}
+		groups[m] = append(groups[m], idx)
+	}
+	for m, positions := range groups {
+		mItems := make([]gkvstore.Item, len(positions))
+		for idx, pos := range positions {
+			mItems[idx] = items[pos]
+		}
+		for idx, err := range gkvstore.ReadMany(ctx, t.stores[m], mItems) {
+			errs[positions[idx]] = err
+		}
+	}
+	return errs
+}
+
+// Features returns the features supported by all the mounted stores, as the
+// store used depends on the namespace
+func (t *prefixStore) Features() gkvstore.Features {
+	var (
+		f     gkvstore.Features
+		first = true
+	)
+	for _, st := range t.stores {
+		if first {
+			f, first = gkvstore.GetFeatures(st), false
+			continue
+		}
+		f = f.Intersect(gkvstore.GetFeatures(st))
+	}
+	return f
+}
+
+// ListNamespaces returns the namespaces from all the mounted stores in sorted
+// order. Only the namespaces which are routed to the store are included. All
+// the stores need to support namespace management
+func (t *prefixStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	for prefix, st := range t.stores {
+		nsStore, ok := st.(gkvstore.NamespaceManager)
+		if !ok {
+			return nil, gkvstore.ErrNotSupported
+		}
+		stNamespaces, err := nsStore.ListNamespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range stNamespaces {
+			if m, _ := t.mount(ns); m == prefix {
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (t *prefixStore) DropNamespace(ctx context.Context, ns string) error {
+	st, found := t.getStore(ns)
+	if !found {
+		return gkvstore.WrapNamespaceError("DropNamespace", ns, ErrStoreNotConfigured)
+	}
+	nsStore, ok := st.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+	return nsStore.DropNamespace(ctx, ns)
+}
+
+func (t *prefixStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	st, found := t.getStore(ns)
+	if !found {
+		return gkvstore.NamespaceStats{}, gkvstore.WrapNamespaceError("NamespaceStats", ns, ErrStoreNotConfigured)
+	}
+	nsStore, ok := st.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.NamespaceStats{}, gkvstore.ErrNotSupported
+	}
+	return nsStore.NamespaceStats(ctx, ns)
+}
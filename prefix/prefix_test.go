@@ -2,6 +2,7 @@ package prefixstore_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/plexsysio/gkvstore"
@@ -218,3 +219,258 @@ func TestCRUDL(t *testing.T) {
 		}
 	})
 }
+
+func TestTransaction(t *testing.T) {
+	pfxStore := prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  inmem.New(),
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			Store:  syncstore.New(inmem.New()),
+		},
+	)
+
+	txn, err := pfxStore.(gkvstore.Transactional).NewTransaction(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Create(context.TODO(), autoencoding.MustNew(&user{
+		Name: "user1",
+		Age:  20,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Create(context.TODO(), autoencoding.MustNew(&product{
+		Name:  "product1",
+		Price: 100,
+	}))
+	if !errors.Is(err, prefixstore.ErrMultipleStores) {
+		t.Fatal("expected error for transaction on multiple stores", err)
+	}
+	err = txn.Commit(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u1 := &user{Id: "1"}
+	err = pfxStore.Read(context.TODO(), autoencoding.MustNew(u1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u1.Name != "user1" || u1.Age != 20 {
+		t.Fatal("incorrect value read")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	st1 := inmem.New()
+	st2 := syncstore.New(inmem.New())
+	pfxStore := prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  st1,
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			Store:  st2,
+		},
+	)
+
+	b, err := gkvstore.NewBatch(context.TODO(), pfxStore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Put(context.TODO(), autoencoding.MustNew(&user{
+		Name: "user1",
+		Age:  20,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Put(context.TODO(), autoencoding.MustNew(&product{
+		Name:  "product1",
+		Price: 100,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Commit(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u1 := &user{Id: "1"}
+	err = st1.Read(context.TODO(), autoencoding.MustNew(u1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u1.Name != "user1" || u1.Age != 20 {
+		t.Fatal("incorrect value read")
+	}
+	p1 := &product{Id: "1"}
+	err = st2.Read(context.TODO(), autoencoding.MustNew(p1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p1.Name != "product1" || p1.Price != 100 {
+		t.Fatal("incorrect value read")
+	}
+}
+
+type order struct {
+	Id string
+}
+
+func TestReadMany(t *testing.T) {
+	pfxStore := prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  inmem.New(),
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			Store:  syncstore.New(inmem.New()),
+		},
+	)
+
+	err := pfxStore.Create(context.TODO(), autoencoding.MustNew(&user{
+		Name: "user1",
+		Age:  20,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pfxStore.Create(context.TODO(), autoencoding.MustNew(&product{
+		Name:  "product1",
+		Price: 100,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u1, p1 := &user{Id: "1"}, &product{Id: "1"}
+	errs := gkvstore.ReadMany(context.TODO(), pfxStore, []gkvstore.Item{
+		autoencoding.MustNew(u1),
+		autoencoding.MustNew(&user{Id: "2"}),
+		autoencoding.MustNew(p1),
+		autoencoding.MustNew(&order{Id: "1"}),
+	})
+	if len(errs) != 4 {
+		t.Fatal("incorrect no of errors", len(errs))
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatal("unexpected errors", errs[0], errs[2])
+	}
+	if !errors.Is(errs[1], gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error", errs[1])
+	}
+	if !errors.Is(errs[3], prefixstore.ErrStoreNotConfigured) {
+		t.Fatal("expected store not configured error", errs[3])
+	}
+	var se *gkvstore.StoreError
+	if !errors.As(errs[3], &se) || se.Op != "ReadMany" || se.Namespace != "order" || se.ID != "1" {
+		t.Fatal("expected error context", errs[3])
+	}
+	if u1.Name != "user1" || p1.Name != "product1" {
+		t.Fatal("incorrect value read")
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	pfxStore := prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  inmem.New(),
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			Store:  syncstore.New(inmem.New()),
+		},
+	)
+	f := gkvstore.GetFeatures(pfxStore)
+	if !f.SupportsSort(gkvstore.SortCreatedAsc, gkvstore.SortIDDesc) || !f.Transactions || !f.Watch {
+		t.Fatal("expected all inmem features", f)
+	}
+
+	pfxStore = prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  inmem.New(),
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			// Only embedding the Store interface hides the features
+			Store: struct{ gkvstore.Store }{inmem.New()},
+		},
+	)
+	f = gkvstore.GetFeatures(pfxStore)
+	if !f.SupportsSort(gkvstore.SortNatural) || !f.Pagination {
+		t.Fatal("expected basic features", f)
+	}
+	if f.SupportsSort(gkvstore.SortCreatedAsc) || f.Transactions || f.Watch || f.Filter {
+		t.Fatal("expected only basic features", f)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	st1 := inmem.New()
+	pfxStore := prefixstore.New(
+		prefixstore.Mount{
+			Prefix: "user",
+			Store:  st1,
+		},
+		prefixstore.Mount{
+			Prefix: "product",
+			Store:  syncstore.New(inmem.New()),
+		},
+	)
+
+	err := pfxStore.Create(context.TODO(), autoencoding.MustNew(&user{Name: "user1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pfxStore.Create(context.TODO(), autoencoding.MustNew(&product{Name: "product1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Namespaces not routed to the store are ignored
+	err = st1.Create(context.TODO(), autoencoding.MustNew(&order{Id: "1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nm := pfxStore.(gkvstore.NamespaceManager)
+	namespaces, err := nm.ListNamespaces(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 2 || namespaces[0] != "product" || namespaces[1] != "user" {
+		t.Fatal("incorrect namespaces", namespaces)
+	}
+
+	stats, err := nm.NamespaceStats(context.TODO(), "product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Items != 1 {
+		t.Fatal("incorrect stats", stats)
+	}
+
+	err = nm.DropNamespace(context.TODO(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces, err = nm.ListNamespaces(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 1 || namespaces[0] != "product" {
+		t.Fatal("incorrect namespaces after drop", namespaces)
+	}
+
+	err = nm.DropNamespace(context.TODO(), "order")
+	if !errors.Is(err, prefixstore.ErrStoreNotConfigured) {
+		t.Fatal("expected store not configured error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package gkvstore
+
+import "context"
+
+// MultiReader interface can be implemented by stores which can read multiple
+// items in a single call. The returned errors correspond to the items at the
+// same position, nil if the item was read successfully
+type MultiReader interface {
+	ReadMany(context.Context, []Item) []error
+}
+
+// ReadMany uses the MultiReader implementation if the store supports it, else
+// it reads the items one by one
+func ReadMany(ctx context.Context, st Store, items []Item) []error {
+	if ms, ok := st.(MultiReader); ok {
+		return ms.ReadMany(ctx, items)
+	}
+
+	errs := make([]error, len(items))
+	for idx, item := range items {
+		errs[idx] = st.Read(ctx, item)
+	}
+	return errs
+}
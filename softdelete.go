@@ -0,0 +1,11 @@
+package gkvstore
+
+import "context"
+
+// SoftDeleter interface is implemented by stores which keep a tombstone for the
+// deleted items instead of removing them. Deleted items are hidden from Read
+// and List. Undelete restores the item and Purge removes it permanently
+type SoftDeleter interface {
+	Undelete(context.Context, Item) error
+	Purge(context.Context, Item) error
+}
@@ -0,0 +1,57 @@
+package softdelete
+
+import (
+	"context"
+	"strings"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ListNamespaces returns the namespaces of the underlying store without the
+// ones holding the tombstones
+func (s *softDeleteStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	nsStore, ok := s.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+	all, err := nsStore.ListNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := all[:0]
+	for _, ns := range all {
+		if !strings.HasSuffix(ns, tombstoneSuffix) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces, nil
+}
+
+// DropNamespace removes the items of the namespace permanently along with
+// their tombstones
+func (s *softDeleteStore) DropNamespace(ctx context.Context, ns string) error {
+	nsStore, ok := s.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+	if err := validate(ns); err != nil {
+		return gkvstore.WrapNamespaceError("DropNamespace", ns, err)
+	}
+	if err := nsStore.DropNamespace(ctx, ns); err != nil {
+		return err
+	}
+	return nsStore.DropNamespace(ctx, ns+tombstoneSuffix)
+}
+
+// NamespaceStats are the ones of the underlying store, so the soft deleted
+// items are included
+func (s *softDeleteStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	nsStore, ok := s.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.NamespaceStats{}, gkvstore.ErrNotSupported
+	}
+	if err := validate(ns); err != nil {
+		return gkvstore.NamespaceStats{Namespace: ns}, gkvstore.WrapNamespaceError("NamespaceStats", ns, err)
+	}
+	return nsStore.NamespaceStats(ctx, ns)
+}
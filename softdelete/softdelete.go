@@ -0,0 +1,300 @@
+package softdelete
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// tombstoneSuffix is added to the namespace of the item to get the namespace
+// of its tombstone. Keeping the prefix same ensures that the tombstones are
+// routed to the same store in prefixstore. The separator is not allowed in the
+// namespaces of the items, so the tombstones cannot clash with them
+const (
+	tombstoneSep    = "\x1f"
+	tombstoneSuffix = tombstoneSep + "tombstones"
+)
+
+func validate(ns string) error {
+	if strings.Contains(ns, tombstoneSep) {
+		return fmt.Errorf("%w: namespace cannot contain %q", gkvstore.ErrInvalidItem, tombstoneSep)
+	}
+	return nil
+}
+
+// tombstone marks the item with the same ID as deleted
+type tombstone struct {
+	namespace string
+
+	ID        string
+	DeletedAt int64
+}
+
+func newTombstone(item gkvstore.Item) *tombstone {
+	return &tombstone{
+		namespace: item.GetNamespace() + tombstoneSuffix,
+		ID:        item.GetID(),
+	}
+}
+
+func (t *tombstone) GetNamespace() string { return t.namespace }
+
+func (t *tombstone) GetID() string { return t.ID }
+
+func (t *tombstone) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *tombstone) Unmarshal(buf []byte) error { return json.Unmarshal(buf, t) }
+
+// probe is read to check if an item exists, so the item passed by the caller
+// is not overwritten with the stored copy
+type probe struct {
+	namespace string
+	id        string
+}
+
+func (p *probe) GetNamespace() string { return p.namespace }
+
+func (p *probe) GetID() string { return p.id }
+
+func (p *probe) Marshal() ([]byte, error) { return nil, nil }
+
+func (p *probe) Unmarshal([]byte) error { return nil }
+
+type softDeleteStore struct {
+	gkvstore.Store
+}
+
+// New returns a store which soft deletes the items in the underlying store.
+// Delete writes a tombstone with the deletion timestamp and keeps the item, so
+// it can be restored using Undelete
+func New(st gkvstore.Store) gkvstore.Store {
+	return &softDeleteStore{Store: st}
+}
+
+func (s *softDeleteStore) deleted(ctx context.Context, item gkvstore.Item) (bool, error) {
+	err := s.Store.Read(ctx, newTombstone(item))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, gkvstore.ErrRecordNotFound):
+		return false, nil
+	}
+	return false, err
+}
+
+// writer is implemented by both the store and its transactions
+type writer interface {
+	Create(context.Context, gkvstore.Item) error
+	Delete(context.Context, gkvstore.Item) error
+}
+
+// replace creates the item in place of the soft deleted one and removes the
+// tombstone
+func replace(ctx context.Context, w writer, item gkvstore.Item) error {
+	if err := w.Delete(ctx, item); err != nil {
+		return err
+	}
+	if err := w.Create(ctx, item); err != nil {
+		return err
+	}
+	return w.Delete(ctx, newTombstone(item))
+}
+
+// recreate replaces the soft deleted item. If the underlying store is
+// Transactional, the writes are committed together
+func (s *softDeleteStore) recreate(ctx context.Context, item gkvstore.Item) error {
+	if ts, ok := s.Store.(gkvstore.Transactional); ok {
+		txn, err := ts.NewTransaction(ctx)
+		switch {
+		case err == nil:
+			defer txn.Discard(ctx)
+
+			if err := replace(ctx, txn, item); err != nil {
+				return err
+			}
+			return txn.Commit(ctx)
+		case !errors.Is(err, gkvstore.ErrNotSupported):
+			return err
+		}
+	}
+	return replace(ctx, s.Store, item)
+}
+
+// Create replaces the item if it was soft deleted earlier. The tombstone is
+// removed after the item is created, as it is stale if the item was removed
+// from the underlying store on expiry, DropNamespace or by a direct write
+func (s *softDeleteStore) Create(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Create", item, err)
+	}
+	err := s.Store.Create(ctx, item)
+	switch {
+	case errors.Is(err, gkvstore.ErrRecordAlreadyExists):
+		deleted, dErr := s.deleted(ctx, item)
+		if dErr != nil || !deleted {
+			return err
+		}
+		return s.recreate(ctx, item)
+	case err != nil:
+		return err
+	}
+	deleted, err := s.deleted(ctx, item)
+	if err != nil || !deleted {
+		return err
+	}
+	return s.Store.Delete(ctx, newTombstone(item))
+}
+
+func (s *softDeleteStore) Read(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Read", item, err)
+	}
+	deleted, err := s.deleted(ctx, item)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+	}
+	return s.Store.Read(ctx, item)
+}
+
+func (s *softDeleteStore) Update(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Update", item, err)
+	}
+	deleted, err := s.deleted(ctx, item)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return gkvstore.WrapError("Update", item, gkvstore.ErrRecordNotFound)
+	}
+	return s.Store.Update(ctx, item)
+}
+
+// Delete writes the tombstone for the item. Deleting an item which doesn't
+// exist or is already deleted is a no-op
+func (s *softDeleteStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Delete", item, err)
+	}
+	deleted, err := s.deleted(ctx, item)
+	if err != nil || deleted {
+		return err
+	}
+	err = s.Store.Read(ctx, &probe{namespace: item.GetNamespace(), id: item.GetID()})
+	if errors.Is(err, gkvstore.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ts := newTombstone(item)
+	ts.DeletedAt = time.Now().UnixNano()
+	return s.Store.Create(ctx, ts)
+}
+
+func (s *softDeleteStore) Undelete(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Undelete", item, err)
+	}
+	deleted, err := s.deleted(ctx, item)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return gkvstore.WrapError("Undelete", item, gkvstore.ErrRecordNotFound)
+	}
+	return s.Store.Delete(ctx, newTombstone(item))
+}
+
+// Purge removes the item and its tombstone permanently. Items which are not
+// soft deleted can be purged as well
+func (s *softDeleteStore) Purge(ctx context.Context, item gkvstore.Item) error {
+	if err := validate(item.GetNamespace()); err != nil {
+		return gkvstore.WrapError("Purge", item, err)
+	}
+	if err := s.Store.Delete(ctx, item); err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, newTombstone(item))
+}
+
+// List hides the soft deleted items by reading the tombstone of each listed
+// item unless IncludeDeleted is set. As the items are filtered after listing
+// from the underlying store, Page and Limit are applied here
+func (s *softDeleteStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	if err := validate(ns); err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+	if opts.IncludeDeleted {
+		return s.Store.List(ctx, factory, opts)
+	}
+
+	skip, limit := opts.Page*opts.Limit, opts.Limit
+	if opts.Cursor != "" {
+		skip = 0
+	}
+	opts.Page, opts.Limit = 0, 0
+
+	ctx, cancel := context.WithCancel(ctx)
+	res, err := s.Store.List(ctx, factory, opts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	filtered := make(chan *gkvstore.Result)
+	go func() {
+		defer close(filtered)
+		defer cancel()
+
+		var count int64
+		for r := range res {
+			if r.Err == nil {
+				deleted, err := s.deleted(ctx, r.Val)
+				if err != nil {
+					r = &gkvstore.Result{Err: err}
+				} else if deleted {
+					continue
+				}
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case filtered <- r:
+				count++
+			}
+			if count == limit {
+				return
+			}
+		}
+	}()
+	return filtered, nil
+}
+
+// Features of the underlying store are reported without Watch and
+// Transactions, as the events and the transactional writes would bypass the
+// tombstones
+func (s *softDeleteStore) Features() gkvstore.Features {
+	f := gkvstore.GetFeatures(s.Store)
+	f.Watch, f.Transactions = false, false
+	_, f.Namespaces = s.Store.(gkvstore.NamespaceManager)
+	return f
+}
@@ -0,0 +1,277 @@
+package softdelete_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/inmem"
+	"github.com/plexsysio/gkvstore/softdelete"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func TestSuite(t *testing.T) {
+	testsuite.RunTestsuite(t, softdelete.New(inmem.New()), testsuite.Advanced)
+}
+
+type note struct {
+	Id   string
+	Text string
+}
+
+func noteFactory() gkvstore.Item {
+	return autoencoding.MustNew(&note{})
+}
+
+func list(t *testing.T, st gkvstore.Store, opts gkvstore.ListOpt) []string {
+	t.Helper()
+	res, err := st.List(context.TODO(), noteFactory, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		ids = append(ids, r.Val.GetID())
+	}
+	return ids
+}
+
+func TestSoftDelete(t *testing.T) {
+	underlying := inmem.New()
+	st := softdelete.New(underlying)
+	defer st.Close()
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		err := st.Create(context.TODO(), autoencoding.MustNew(&note{Id: id, Text: "note " + id}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Item passed to Delete is not overwritten with the stored copy
+	del := &note{Id: "b", Text: "local"}
+	err := st.Delete(context.TODO(), autoencoding.MustNew(del))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if del.Text != "local" {
+		t.Fatal("item modified on delete", del)
+	}
+	err = st.Read(context.TODO(), autoencoding.MustNew(&note{Id: "b"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error for deleted item", err)
+	}
+	err = st.Update(context.TODO(), autoencoding.MustNew(&note{Id: "b"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error on updating deleted item", err)
+	}
+	// Item is retained in the underlying store
+	err = underlying.Read(context.TODO(), autoencoding.MustNew(&note{Id: "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := list(t, st, gkvstore.ListOpt{Sort: gkvstore.SortIDAsc})
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "c" || ids[2] != "d" {
+		t.Fatal("incorrect items listed", ids)
+	}
+	ids = list(t, st, gkvstore.ListOpt{Sort: gkvstore.SortIDAsc, Page: 1, Limit: 2})
+	if len(ids) != 1 || ids[0] != "d" {
+		t.Fatal("incorrect items listed with pagination", ids)
+	}
+	ids = list(t, st, gkvstore.ListOpt{Sort: gkvstore.SortIDAsc, IncludeDeleted: true})
+	if len(ids) != 4 {
+		t.Fatal("expected deleted items to be listed", ids)
+	}
+
+	sd := st.(gkvstore.SoftDeleter)
+	err = sd.Undelete(context.TODO(), autoencoding.MustNew(&note{Id: "b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &note{Id: "b"}
+	err = st.Read(context.TODO(), autoencoding.MustNew(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Text != "note b" {
+		t.Fatal("incorrect item after undelete", n)
+	}
+	err = sd.Undelete(context.TODO(), autoencoding.MustNew(&note{Id: "b"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error on undeleting item which is not deleted", err)
+	}
+
+	err = st.Delete(context.TODO(), autoencoding.MustNew(&note{Id: "c"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sd.Purge(context.TODO(), autoencoding.MustNew(&note{Id: "c"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = underlying.Read(context.TODO(), autoencoding.MustNew(&note{Id: "c"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error after purge", err)
+	}
+	err = sd.Undelete(context.TODO(), autoencoding.MustNew(&note{Id: "c"}))
+	if !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error on undeleting purged item", err)
+	}
+
+	// Creating a deleted item replaces it
+	err = st.Delete(context.TODO(), autoencoding.MustNew(&note{Id: "d"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Create(context.TODO(), autoencoding.MustNew(&note{Id: "d", Text: "new note"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n = &note{Id: "d"}
+	err = st.Read(context.TODO(), autoencoding.MustNew(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Text != "new note" {
+		t.Fatal("incorrect item after recreate", n)
+	}
+}
+
+type session struct {
+	Id     string
+	Expiry int64
+}
+
+func (s *session) GetNamespace() string { return "session" }
+
+func (s *session) GetID() string { return s.Id }
+
+func (s *session) Marshal() ([]byte, error) { return json.Marshal(s) }
+
+func (s *session) Unmarshal(buf []byte) error { return json.Unmarshal(buf, s) }
+
+func (s *session) GetExpiry() int64 { return s.Expiry }
+
+// TestRecreateExpired checks that the tombstone of an item which expired in
+// the underlying store doesn't hide the item created again
+func TestRecreateExpired(t *testing.T) {
+	st := softdelete.New(inmem.New())
+	defer st.Close()
+
+	err := st.Create(context.TODO(), &session{
+		Id:     "1",
+		Expiry: time.Now().Add(100 * time.Millisecond).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Delete(context.TODO(), &session{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if err := st.Create(context.TODO(), &session{Id: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), &session{Id: "1"}); err != nil {
+		t.Fatal("expected recreated item to be readable", err)
+	}
+	res, err := st.List(context.TODO(), func() gkvstore.Item { return &session{} }, gkvstore.ListOpt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Fatal("expected recreated item to be listed", count)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	st := softdelete.New(inmem.New())
+	defer st.Close()
+
+	for _, id := range []string{"a", "b"} {
+		if err := st.Create(context.TODO(), autoencoding.MustNew(&note{Id: id})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Delete(context.TODO(), autoencoding.MustNew(&note{Id: "a"})); err != nil {
+		t.Fatal(err)
+	}
+
+	nsStore := st.(gkvstore.NamespaceManager)
+	namespaces, err := nsStore.ListNamespaces(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(namespaces) != 1 || namespaces[0] != "note" {
+		t.Fatal("tombstone namespace listed", namespaces)
+	}
+
+	// Tombstones are dropped with the namespace, so the item created again
+	// is not hidden
+	if err := nsStore.DropNamespace(context.TODO(), "note"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(&note{Id: "a"})); err != nil {
+		t.Fatal(err)
+	}
+	if ids := list(t, st, gkvstore.ListOpt{}); len(ids) != 1 || ids[0] != "a" {
+		t.Fatal("incorrect items after drop", ids)
+	}
+}
+
+type record struct {
+	namespace string
+	Id        string
+}
+
+func (r *record) GetNamespace() string { return r.namespace }
+
+func (r *record) GetID() string { return r.Id }
+
+func (r *record) Marshal() ([]byte, error) { return json.Marshal(r) }
+
+func (r *record) Unmarshal(buf []byte) error { return json.Unmarshal(buf, r) }
+
+// TestTombstoneNamespace checks that the items cannot be written to the
+// namespaces of the tombstones
+func TestTombstoneNamespace(t *testing.T) {
+	st := softdelete.New(inmem.New())
+	defer st.Close()
+
+	if err := st.Create(context.TODO(), &record{namespace: "note", Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Delete(context.TODO(), &record{namespace: "note", Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{"note\x1ftombstones", "a\x1fb"} {
+		err := st.Create(context.TODO(), &record{namespace: ns, Id: "a"})
+		if !errors.Is(err, gkvstore.ErrInvalidItem) {
+			t.Fatal("expected invalid item error for namespace", ns, err)
+		}
+	}
+	// Namespace which used to hold the tombstones is a regular namespace
+	if err := st.Create(context.TODO(), &record{namespace: "note.tombstones", Id: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Read(context.TODO(), &record{namespace: "note", Id: "a"}); !errors.Is(err, gkvstore.ErrRecordNotFound) {
+		t.Fatal("expected not found error for deleted item", err)
+	}
+}
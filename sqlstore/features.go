@@ -0,0 +1,26 @@
+package sqlstore
+
+import "github.com/plexsysio/gkvstore"
+
+func (s *sqlStore) Features() gkvstore.Features {
+	return gkvstore.Features{
+		Sorts: []gkvstore.Sort{
+			gkvstore.SortNatural,
+			gkvstore.SortCreatedDesc,
+			gkvstore.SortCreatedAsc,
+			gkvstore.SortUpdatedDesc,
+			gkvstore.SortUpdatedAsc,
+			gkvstore.SortIDAsc,
+			gkvstore.SortIDDesc,
+		},
+		Filter:      true,
+		Pagination:  true,
+		Cursor:      true,
+		IDRange:     true,
+		Index:       true,
+		TimeTracker: true,
+		Versioning:  true,
+		Expiry:      true,
+		Namespaces:  true,
+	}
+}
@@ -0,0 +1,401 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// batchSize is the no of rows read by a query. Rows are not kept open while
+// the results are consumed, the next batch is read after the last row instead
+const batchSize = 100
+
+// position is the place of a row in the listing order. index is the timestamp
+// for the timetracker sorts and value is the secondary index value if an
+// IndexQuery is used with the natural order
+type position struct {
+	id    string
+	index int64
+	value string
+}
+
+func (p position) cursor(s gkvstore.Sort) string {
+	return gkvstore.Cursor{Sort: s, Index: p.index, Value: p.value, Key: []byte(p.id)}.Encode()
+}
+
+func decodePosition(c string, s gkvstore.Sort) (*position, error) {
+	cr, err := gkvstore.DecodeCursor(c, s)
+	if err != nil {
+		return nil, err
+	}
+	return &position{id: string(cr.Key), index: cr.Index, value: cr.Value}, nil
+}
+
+// query builds the statements for the list options
+type query struct {
+	st   *sqlStore
+	ns   string
+	opts gkvstore.ListOpt
+	// column is the first column of the listing order, the ID is used for
+	// the rest
+	column string
+	desc   bool
+}
+
+func (s *sqlStore) newQuery(ns string, opts gkvstore.ListOpt) (*query, error) {
+	if s.closed() {
+		return nil, gkvstore.ErrStoreClosed
+	}
+	q := &query{st: s, ns: ns, opts: opts}
+	switch opts.Sort {
+	case gkvstore.SortNatural:
+		// Natural order with index query is the order of the index values
+		if opts.Index.Name != "" {
+			q.column = "x.value"
+		}
+	case gkvstore.SortIDAsc:
+	case gkvstore.SortIDDesc:
+		q.desc = true
+	case gkvstore.SortCreatedAsc:
+		q.column = "t.created"
+	case gkvstore.SortCreatedDesc:
+		q.column, q.desc = "t.created", true
+	case gkvstore.SortUpdatedAsc:
+		q.column = "t.updated"
+	case gkvstore.SortUpdatedDesc:
+		q.column, q.desc = "t.updated", true
+	default:
+		return nil, gkvstore.ErrInvalidSort
+	}
+	return q, nil
+}
+
+// where returns the FROM and WHERE clauses along with the arguments
+func (q *query) where(after *position) (string, []interface{}) {
+	var (
+		b     strings.Builder
+		args  []interface{}
+		opts  = q.opts
+		items = q.st.tables.items
+	)
+	b.WriteString(" FROM " + items + " t")
+	if opts.Index.Name != "" {
+		b.WriteString(" JOIN " + q.st.tables.indexes + " x ON x.namespace = t.namespace AND x.id = t.id AND x.name = ?")
+		args = append(args, opts.Index.Name)
+	}
+	b.WriteString(" WHERE t.namespace = ? AND (t.expiry = 0 OR t.expiry > ?)")
+	args = append(args, q.ns, time.Now().UnixNano())
+
+	cond := func(c string, a ...interface{}) {
+		b.WriteString(" AND " + c)
+		args = append(args, a...)
+	}
+	if opts.Version > 0 {
+		cond("t.version >= ?", opts.Version)
+	}
+	if opts.StartID != "" {
+		cond("t.id >= ?", opts.StartID)
+	}
+	if opts.EndID != "" {
+		cond("t.id < ?", opts.EndID)
+	}
+	if opts.IDPrefix != "" {
+		cond("t.id >= ?", opts.IDPrefix)
+		if end := gkvstore.PrefixEnd([]byte(opts.IDPrefix)); end != nil {
+			cond("t.id < ?", string(end))
+		}
+	}
+	if opts.Index.Name != "" {
+		if opts.Index.Value != "" {
+			cond("x.value = ?", opts.Index.Value)
+		} else {
+			if opts.Index.Start != "" {
+				cond("x.value >= ?", opts.Index.Start)
+			}
+			if opts.Index.End != "" {
+				cond("x.value < ?", opts.Index.End)
+			}
+		}
+	}
+	// Items which are not time tracked are not listed in the timetracker sorts
+	if q.column == "t.created" || q.column == "t.updated" {
+		cond(q.column + " IS NOT NULL")
+	}
+
+	if after != nil {
+		op := ">"
+		if q.desc {
+			op = "<"
+		}
+		switch q.column {
+		case "":
+			cond("t.id "+op+" ?", after.id)
+		case "x.value":
+			cond("("+q.column+" "+op+" ? OR ("+q.column+" = ? AND t.id "+op+" ?))", after.value, after.value, after.id)
+		default:
+			cond("("+q.column+" "+op+" ? OR ("+q.column+" = ? AND t.id "+op+" ?))", after.index, after.index, after.id)
+		}
+	}
+	return b.String(), args
+}
+
+// row is an item read by the query. The value is only read if required
+type row struct {
+	pos   position
+	value []byte
+}
+
+// fetch reads the rows after the position in the listing order
+func (q *query) fetch(ctx context.Context, after *position, withValue bool, offset, limit int64) ([]row, error) {
+	cols := "t.id, t.created, t.updated, ''"
+	if q.column == "x.value" {
+		cols = "t.id, t.created, t.updated, x.value"
+	}
+	if withValue {
+		cols += ", t.value"
+	}
+	from, args := q.where(after)
+
+	order := " ORDER BY t.id"
+	if q.column != "" {
+		order = " ORDER BY " + q.column + ", t.id"
+	}
+	if q.desc {
+		order = strings.ReplaceAll(order, "t.id", "t.id DESC")
+		if q.column != "" {
+			order = strings.Replace(order, q.column, q.column+" DESC", 1)
+		}
+	}
+
+	rows, err := q.st.db.QueryContext(
+		ctx,
+		"SELECT "+cols+from+order+" LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []row
+	for rows.Next() {
+		var (
+			r                row
+			created, updated sql.NullInt64
+		)
+		dest := []interface{}{&r.pos.id, &created, &updated, &r.pos.value}
+		if withValue {
+			dest = append(dest, &r.value)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		switch q.column {
+		case "t.created":
+			r.pos.index = created.Int64
+		case "t.updated":
+			r.pos.index = updated.Int64
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// scan calls the function for the rows in the listing order till it returns
+// false. Page and Limit are pushed into the query unless a Filter is used, in
+// which case the function has to handle them
+func (q *query) scan(ctx context.Context, withValue bool, fn func(row) bool) error {
+	var (
+		after  *position
+		offset int64
+		limit  = q.opts.Limit
+	)
+	if q.opts.Cursor != "" {
+		c, err := decodePosition(q.opts.Cursor, q.opts.Sort)
+		if err != nil {
+			return err
+		}
+		after = c
+	} else if q.opts.Filter == nil {
+		offset = q.opts.Page * q.opts.Limit
+	}
+	if q.opts.Filter != nil {
+		limit = 0
+	}
+
+	for {
+		n := int64(batchSize)
+		if limit > 0 && limit < n {
+			n = limit
+		}
+		rows, err := q.fetch(ctx, after, withValue, offset, n)
+		if err != nil {
+			return err
+		}
+		offset = 0
+		for _, r := range rows {
+			if !fn(r) {
+				return nil
+			}
+		}
+		if int64(len(rows)) < n {
+			return nil
+		}
+		if limit > 0 {
+			if limit -= n; limit == 0 {
+				return nil
+			}
+		}
+		after = &rows[len(rows)-1].pos
+	}
+}
+
+func (s *sqlStore) List(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.Result, error) {
+
+	ns := factory().GetNamespace()
+	q, err := s.newQuery(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("List", ns, err)
+	}
+	if opts.Cursor != "" {
+		if _, err := decodePosition(opts.Cursor, opts.Sort); err != nil {
+			return nil, gkvstore.WrapNamespaceError("List", ns, err)
+		}
+	}
+
+	// Page is skipped by the query unless the items have to be filtered
+	var skip int64
+	if opts.Filter != nil && opts.Cursor == "" {
+		skip = opts.Page * opts.Limit
+	}
+	res := make(chan *gkvstore.Result)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := q.scan(ctx, true, func(r row) bool {
+			it := factory()
+			err := it.Unmarshal(r.value)
+			if opts.Filter != nil && err == nil && !opts.Filter.Compare(it) {
+				return true
+			}
+			if skip > 0 {
+				skip--
+				return true
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- &gkvstore.Result{Val: it, Err: err, Cursor: r.pos.cursor(opts.Sort)}:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.Result{Err: gkvstore.WrapNamespaceError("List", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+func (s *sqlStore) ListKeys(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (<-chan *gkvstore.KeyResult, error) {
+
+	ns := factory().GetNamespace()
+	q, err := s.newQuery(ns, opts)
+	if err != nil {
+		return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+	}
+	if opts.Cursor != "" {
+		if _, err := decodePosition(opts.Cursor, opts.Sort); err != nil {
+			return nil, gkvstore.WrapNamespaceError("ListKeys", ns, err)
+		}
+	}
+
+	var skip int64
+	if opts.Filter != nil && opts.Cursor == "" {
+		skip = opts.Page * opts.Limit
+	}
+	res := make(chan *gkvstore.KeyResult)
+
+	go func() {
+		defer close(res)
+
+		count := 0
+		err := q.scan(ctx, opts.Filter != nil, func(r row) bool {
+			var err error
+			if opts.Filter != nil {
+				it := factory()
+				err = it.Unmarshal(r.value)
+				if err == nil && !opts.Filter.Compare(it) {
+					return true
+				}
+			}
+			if skip > 0 {
+				skip--
+				return true
+			}
+			kr := &gkvstore.KeyResult{
+				Key:    gkvstore.Key{Namespace: ns, ID: r.pos.id},
+				Err:    err,
+				Cursor: r.pos.cursor(opts.Sort),
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case res <- kr:
+				count++
+			}
+			return int64(count) != opts.Limit
+		})
+		if err != nil && ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case res <- &gkvstore.KeyResult{Err: gkvstore.WrapNamespaceError("ListKeys", ns, err)}:
+			}
+		}
+	}()
+
+	return res, nil
+}
+
+// Count is done by the database. Filters can only be applied on the decoded
+// items, so the count falls back to List if a Filter is provided
+func (s *sqlStore) Count(
+	ctx context.Context,
+	factory gkvstore.Factory,
+	opts gkvstore.ListOpt,
+) (int64, error) {
+
+	if opts.Filter != nil {
+		return 0, gkvstore.ErrNotSupported
+	}
+	ns := factory().GetNamespace()
+	opts.Sort, opts.Cursor = gkvstore.SortNatural, ""
+	q, err := s.newQuery(ns, opts)
+	if err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+	from, args := q.where(nil)
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&count); err != nil {
+		return 0, gkvstore.WrapNamespaceError("Count", ns, err)
+	}
+	return count, nil
+}
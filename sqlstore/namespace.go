@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+// ListNamespaces is a DISTINCT query on the items table. Expired rows which
+// are not yet reaped are left out
+func (s *sqlStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	if s.closed() {
+		return nil, gkvstore.ErrStoreClosed
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT DISTINCT namespace FROM `+s.tables.items+` WHERE expiry = 0 OR expiry > ? ORDER BY namespace`,
+		time.Now().UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var namespaces []string
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, rows.Err()
+}
+
+func (s *sqlStore) DropNamespace(ctx context.Context, ns string) error {
+	return gkvstore.WrapNamespaceError("DropNamespace", ns, s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+s.tables.items+` WHERE namespace = ?`, ns)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+s.tables.indexes+` WHERE namespace = ?`, ns)
+		return err
+	}))
+}
+
+func (s *sqlStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	stats := gkvstore.NamespaceStats{Namespace: ns}
+	if s.closed() {
+		return stats, gkvstore.WrapNamespaceError("NamespaceStats", ns, gkvstore.ErrStoreClosed)
+	}
+	var (
+		size        sql.NullInt64
+		lastUpdated sql.NullInt64
+	)
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*), SUM(LENGTH(value)), MAX(updated) FROM `+s.tables.items+` WHERE namespace = ? AND (expiry = 0 OR expiry > ?)`,
+		ns, time.Now().UnixNano(),
+	).Scan(&stats.Items, &size, &lastUpdated)
+	if err != nil {
+		return stats, gkvstore.WrapNamespaceError("NamespaceStats", ns, err)
+	}
+	stats.Size, stats.LastUpdated = size.Int64, lastUpdated.Int64
+	return stats, nil
+}
@@ -0,0 +1,427 @@
+// Package sqlstore provides a store on database/sql. All the namespaces share
+// a table with the namespace, ID, version, created, updated and expiry as
+// columns, so the sorts, pagination and ID ranges are done by the database
+// using ORDER BY, LIMIT and OFFSET. Secondary indexes are kept in a separate
+// table. The queries use '?' placeholders and the value is a BLOB column, so
+// the store is meant for SQLite databases.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/plexsysio/gkvstore"
+)
+
+const (
+	defaultTable = "gkvstore"
+	// reapInterval is the interval at which the expired rows are deleted
+	reapInterval = time.Second
+)
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Options configure the store
+type Options struct {
+	// Table is the name of the table storing the items. The secondary indexes
+	// and the ID sequence use tables with this as prefix. Default is gkvstore
+	Table string
+	// IsUniqueViolation checks if the error returned by the driver is for a
+	// unique constraint violation. Default uses the extended result codes of
+	// the SQLite drivers exposing them and the error message otherwise
+	IsUniqueViolation func(error) bool
+}
+
+type sqlStore struct {
+	db     *sql.DB
+	opts   Options
+	tables struct{ items, indexes, seq string }
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New creates the tables if required and returns the store. The database is
+// not closed on Close as it is owned by the caller, but the operations on the
+// store fail with ErrStoreClosed after it. A background routine removes the
+// expired items, which is stopped on Close
+func New(db *sql.DB, opts Options) (gkvstore.Store, error) {
+	if opts.Table == "" {
+		opts.Table = defaultTable
+	}
+	if !tableName.MatchString(opts.Table) {
+		return nil, fmt.Errorf("sqlstore: invalid table name %q", opts.Table)
+	}
+	if opts.IsUniqueViolation == nil {
+		opts.IsUniqueViolation = isUniqueViolation
+	}
+	st := &sqlStore{db: db, opts: opts, stop: make(chan struct{})}
+	st.tables.items = opts.Table
+	st.tables.indexes = opts.Table + "_indexes"
+	st.tables.seq = opts.Table + "_seq"
+
+	if err := st.init(context.Background()); err != nil {
+		return nil, fmt.Errorf("sqlstore: failed creating tables: %w", err)
+	}
+
+	st.wg.Add(1)
+	go st.reaper()
+	return st, nil
+}
+
+// SQLite extended result codes of the unique constraint violations
+const (
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+func isUniqueViolation(err error) bool {
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		code := coded.Code()
+		return code == sqliteConstraintPrimaryKey || code == sqliteConstraintUnique
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "unique constraint")
+}
+
+func (s *sqlStore) init(ctx context.Context) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + s.tables.items + ` (
+			namespace VARCHAR(255) NOT NULL,
+			id VARCHAR(255) NOT NULL,
+			value BLOB NOT NULL,
+			version BIGINT NOT NULL,
+			created BIGINT,
+			updated BIGINT,
+			expiry BIGINT NOT NULL,
+			PRIMARY KEY (namespace, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + s.tables.items + `_created ON ` + s.tables.items + ` (namespace, created, id)`,
+		`CREATE INDEX IF NOT EXISTS ` + s.tables.items + `_updated ON ` + s.tables.items + ` (namespace, updated, id)`,
+		`CREATE INDEX IF NOT EXISTS ` + s.tables.items + `_expiry ON ` + s.tables.items + ` (expiry)`,
+		`CREATE TABLE IF NOT EXISTS ` + s.tables.indexes + ` (
+			namespace VARCHAR(255) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			value VARCHAR(255) NOT NULL,
+			id VARCHAR(255) NOT NULL,
+			PRIMARY KEY (namespace, name, value, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + s.tables.indexes + `_item ON ` + s.tables.indexes + ` (namespace, id)`,
+		`CREATE TABLE IF NOT EXISTS ` + s.tables.seq + ` (
+			name VARCHAR(255) NOT NULL PRIMARY KEY,
+			value BIGINT NOT NULL
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO `+s.tables.seq+` (name, value) SELECT 'nonce', 0 WHERE NOT EXISTS (SELECT 1 FROM `+s.tables.seq+` WHERE name = 'nonce')`,
+	)
+	return err
+}
+
+// closed checks if the store is closed
+func (s *sqlStore) closed() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// inTx runs the function in a transaction which is committed if it succeeds
+func (s *sqlStore) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	if s.closed() {
+		return gkvstore.ErrStoreClosed
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) nextID(ctx context.Context, tx *sql.Tx) (string, error) {
+	_, err := tx.ExecContext(ctx, `UPDATE `+s.tables.seq+` SET value = value + 1 WHERE name = 'nonce'`)
+	if err != nil {
+		return "", err
+	}
+	var n int64
+	err = tx.QueryRowContext(ctx, `SELECT value FROM `+s.tables.seq+` WHERE name = 'nonce'`).Scan(&n)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", n), nil
+}
+
+// nullTime stores the timestamps of items which are not time tracked as NULL,
+// so they are not listed in the created and updated sorts
+func nullTime(ts int64, timeTrack bool) sql.NullInt64 {
+	return sql.NullInt64{Int64: ts, Valid: timeTrack}
+}
+
+// removeExpired deletes the item if it is expired and not yet reaped
+func (s *sqlStore) removeExpired(ctx context.Context, tx *sql.Tx, ns, id string, now int64) error {
+	res, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM `+s.tables.items+` WHERE namespace = ? AND id = ? AND expiry != 0 AND expiry <= ?`,
+		ns, id, now,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM `+s.tables.indexes+` WHERE namespace = ? AND id = ?`, ns, id)
+	return err
+}
+
+// setIndexes replaces the secondary index entries of the item
+func (s *sqlStore) setIndexes(ctx context.Context, tx *sql.Tx, item gkvstore.Item) error {
+	ns, id := item.GetNamespace(), item.GetID()
+	_, err := tx.ExecContext(ctx, `DELETE FROM `+s.tables.indexes+` WHERE namespace = ? AND id = ?`, ns, id)
+	if err != nil {
+		return err
+	}
+	idx, ok := item.(gkvstore.Indexable)
+	if !ok {
+		return nil
+	}
+	for name, val := range idx.Indexes() {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO `+s.tables.indexes+` (namespace, name, value, id) VALUES (?, ?, ?, ?)`,
+			ns, name, val, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) Create(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Create", item, s.inTx(ctx, func(tx *sql.Tx) error {
+		if ids, ok := item.(gkvstore.IDSetter); ok {
+			id, err := s.nextID(ctx, tx)
+			if err != nil {
+				return err
+			}
+			ids.SetID(id)
+		}
+
+		ns, id := item.GetNamespace(), item.GetID()
+		timestamp := time.Now().UnixNano()
+		if err := s.removeExpired(ctx, tx, ns, id, timestamp); err != nil {
+			return err
+		}
+
+		_, timeTrack := item.(gkvstore.TimeTracker)
+		if timeTrack {
+			tt := item.(gkvstore.TimeTracker)
+			tt.SetCreated(timestamp)
+			tt.SetUpdated(timestamp)
+		}
+
+		if v, ok := item.(gkvstore.Versioned); ok {
+			v.SetVersion(1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO `+s.tables.items+` (namespace, id, value, version, created, updated, expiry) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			ns, id, itemBuf, 1, nullTime(timestamp, timeTrack), nullTime(timestamp, timeTrack), gkvstore.ItemExpiry(item),
+		)
+		if err != nil {
+			if s.opts.IsUniqueViolation(err) {
+				return gkvstore.ErrRecordAlreadyExists
+			}
+			return err
+		}
+		return s.setIndexes(ctx, tx, item)
+	}))
+}
+
+func (s *sqlStore) Read(ctx context.Context, item gkvstore.Item) error {
+	if s.closed() {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrStoreClosed)
+	}
+	var buf []byte
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT value FROM `+s.tables.items+` WHERE namespace = ? AND id = ? AND (expiry = 0 OR expiry > ?)`,
+		item.GetNamespace(), item.GetID(), time.Now().UnixNano(),
+	).Scan(&buf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return gkvstore.WrapError("Read", item, gkvstore.ErrRecordNotFound)
+	}
+	if err != nil {
+		return gkvstore.WrapError("Read", item, err)
+	}
+	return gkvstore.WrapError("Read", item, item.Unmarshal(buf))
+}
+
+func (s *sqlStore) Update(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Update", item, s.inTx(ctx, func(tx *sql.Tx) error {
+		ns, id := item.GetNamespace(), item.GetID()
+		timestamp := time.Now().UnixNano()
+		if err := s.removeExpired(ctx, tx, ns, id, timestamp); err != nil {
+			return err
+		}
+
+		var (
+			version int64
+			created sql.NullInt64
+			exists  = true
+		)
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT version, created FROM `+s.tables.items+` WHERE namespace = ? AND id = ?`,
+			ns, id,
+		).Scan(&version, &created)
+		if errors.Is(err, sql.ErrNoRows) {
+			exists = false
+		} else if err != nil {
+			return err
+		}
+
+		v, versioned := item.(gkvstore.Versioned)
+		if versioned && v.GetVersion() != version {
+			return gkvstore.ErrVersionConflict
+		}
+
+		tt, timeTrack := item.(gkvstore.TimeTracker)
+		if timeTrack {
+			if created.Valid {
+				tt.SetCreated(created.Int64)
+			} else {
+				tt.SetCreated(timestamp)
+			}
+			tt.SetUpdated(timestamp)
+			created = nullTime(tt.GetCreated(), true)
+		} else {
+			created = sql.NullInt64{}
+		}
+
+		if versioned {
+			v.SetVersion(version + 1)
+		}
+
+		itemBuf, err := item.Marshal()
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			_, err = tx.ExecContext(
+				ctx,
+				`INSERT INTO `+s.tables.items+` (namespace, id, value, version, created, updated, expiry) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				ns, id, itemBuf, version+1, created, nullTime(timestamp, timeTrack), gkvstore.ItemExpiry(item),
+			)
+			if err != nil {
+				// Created concurrently, which is a conflict like the
+				// concurrent updates below
+				if s.opts.IsUniqueViolation(err) {
+					return gkvstore.ErrVersionConflict
+				}
+				return err
+			}
+			return s.setIndexes(ctx, tx, item)
+		}
+
+		// Version is checked again, so concurrent updates are detected even if
+		// the database doesn't lock the row on read
+		res, err := tx.ExecContext(
+			ctx,
+			`UPDATE `+s.tables.items+` SET value = ?, version = ?, created = ?, updated = ?, expiry = ? WHERE namespace = ? AND id = ? AND version = ?`,
+			itemBuf, version+1, created, nullTime(timestamp, timeTrack), gkvstore.ItemExpiry(item), ns, id, version,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return gkvstore.ErrVersionConflict
+		}
+		return s.setIndexes(ctx, tx, item)
+	}))
+}
+
+func (s *sqlStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	return gkvstore.WrapError("Delete", item, s.inTx(ctx, func(tx *sql.Tx) error {
+		ns, id := item.GetNamespace(), item.GetID()
+		_, err := tx.ExecContext(ctx, `DELETE FROM `+s.tables.items+` WHERE namespace = ? AND id = ?`, ns, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+s.tables.indexes+` WHERE namespace = ? AND id = ?`, ns, id)
+		return err
+	}))
+}
+
+func (s *sqlStore) reaper() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// Failed removals are retried on the next run
+			_ = s.reap(context.Background())
+		}
+	}
+}
+
+func (s *sqlStore) reap(ctx context.Context) error {
+	now := time.Now().UnixNano()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			`DELETE FROM `+s.tables.indexes+` WHERE EXISTS (
+				SELECT 1 FROM `+s.tables.items+` t
+				WHERE t.namespace = `+s.tables.indexes+`.namespace AND t.id = `+s.tables.indexes+`.id
+				AND t.expiry != 0 AND t.expiry <= ?
+			)`,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+s.tables.items+` WHERE expiry != 0 AND expiry <= ?`, now)
+		return err
+	})
+}
+
+// Close stops the reaper. The database has to be closed by the caller
+func (s *sqlStore) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,179 @@
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
+	"github.com/plexsysio/gkvstore/sqlstore"
+	"github.com/plexsysio/gkvstore/testsuite"
+)
+
+func openDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	dsn := "file:" + filepath.Join(tb.TempDir(), "test.db") +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSuite(t *testing.T) {
+	st, err := sqlstore.New(openDB(t), sqlstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testsuite.RunTestsuite(t, st, testsuite.Advanced)
+}
+
+func BenchmarkSuite(b *testing.B) {
+	st, err := sqlstore.New(openDB(b), sqlstore.Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer st.Close()
+
+	testsuite.BenchmarkSuite(b, st)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+func TestUniqueViolation(t *testing.T) {
+	var matched bool
+	db := openDB(t)
+	st, err := sqlstore.New(db, sqlstore.Options{
+		Table: "documents",
+		IsUniqueViolation: func(err error) bool {
+			matched = true
+			return true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	doc := &document{Id: "1", Text: "first"}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+	err = st.Create(context.TODO(), autoencoding.MustNew(&document{Id: "1"}))
+	if !errors.Is(err, gkvstore.ErrRecordAlreadyExists) {
+		t.Fatal("expected ErrRecordAlreadyExists", err)
+	}
+	if !matched {
+		t.Fatal("expected unique violation check to be used")
+	}
+
+	// Insert of the missing item fails as if it was created concurrently
+	_, err = db.Exec(`CREATE TRIGGER created_concurrently BEFORE INSERT ON documents
+		WHEN NEW.id = '2' BEGIN SELECT RAISE(ABORT, 'created concurrently'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.Update(context.TODO(), autoencoding.MustNew(&document{Id: "2"}))
+	if !errors.Is(err, gkvstore.ErrVersionConflict) {
+		t.Fatal("expected ErrVersionConflict", err)
+	}
+
+	if _, err := sqlstore.New(openDB(t), sqlstore.Options{Table: "documents; DROP"}); err == nil {
+		t.Fatal("expected error for invalid table name")
+	}
+}
+
+// TestBatches lists more items than a single query reads
+func TestBatches(t *testing.T) {
+	db := openDB(t)
+	st, err := sqlstore.New(db, sqlstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 250
+	for i := 0; i < count; i++ {
+		doc := &document{Id: fmt.Sprintf("%03d", i)}
+		if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(opts gkvstore.ListOpt) ([]string, string) {
+		t.Helper()
+
+		res, err := st.List(context.TODO(), func() gkvstore.Item {
+			return autoencoding.MustNew(&document{})
+		}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var (
+			ids    []string
+			cursor string
+		)
+		for r := range res {
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			ids = append(ids, r.Val.GetID())
+			cursor = r.Cursor
+		}
+		return ids, cursor
+	}
+
+	ids, _ := list(gkvstore.ListOpt{Sort: gkvstore.SortCreatedDesc})
+	if len(ids) != count || ids[0] != "249" || ids[count-1] != "000" {
+		t.Fatal("unexpected items", len(ids))
+	}
+
+	ids, cursor := list(gkvstore.ListOpt{Sort: gkvstore.SortIDAsc, Page: 1, Limit: 120})
+	if len(ids) != 120 || ids[0] != "120" || ids[119] != "239" {
+		t.Fatal("unexpected page", len(ids))
+	}
+	ids, _ = list(gkvstore.ListOpt{Sort: gkvstore.SortIDAsc, Limit: 120, Cursor: cursor})
+	if len(ids) != 10 || ids[0] != "240" {
+		t.Fatal("unexpected page after cursor", len(ids))
+	}
+
+	// Tables are reused and the IDs continue from the last one
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	st, err = sqlstore.New(db, sqlstore.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	doc := &document{}
+	if err := st.Create(context.TODO(), autoencoding.MustNew(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Id != "251" {
+		t.Fatal("unexpected ID", doc.Id)
+	}
+
+	cnt, err := gkvstore.Count(context.TODO(), st, func() gkvstore.Item {
+		return autoencoding.MustNew(&document{})
+	}, gkvstore.ListOpt{IDPrefix: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 100 {
+		t.Fatal("unexpected count", cnt)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"strings"
 )
 
 const (
@@ -17,11 +18,24 @@ const (
 	SortUpdatedDesc
 	// SortUpdatedAsc updated oldest to newset
 	SortUpdatedAsc
+	// SortIDAsc ID in lexicographic order
+	SortIDAsc
+	// SortIDDesc ID in reverse lexicographic order
+	SortIDDesc
 )
 
 var (
 	ErrRecordNotFound      = errors.New("record not found")
 	ErrRecordAlreadyExists = errors.New("record already exists")
+	ErrNotSupported        = errors.New("operation not supported by store")
+	ErrVersionConflict     = errors.New("version conflict")
+	ErrInvalidCursor       = errors.New("invalid cursor")
+	ErrIndexNotFound       = errors.New("index not found")
+	ErrInvalidSort         = errors.New("invalid sort type")
+	ErrStoreClosed         = errors.New("store closed")
+	ErrInvalidItem         = errors.New("invalid item")
+	ErrWatchOverflow       = errors.New("watcher fell behind and events were dropped")
+	ErrTxnClosed           = errors.New("transaction already committed or discarded")
 )
 
 type (
@@ -57,23 +71,52 @@ type (
 	// in the list method
 	Factory func() Item
 
-	// Result contains result of a single result in a list operation
+	// Result contains result of a single result in a list operation. If the
+	// store supports cursors, Cursor can be used in ListOpt to continue the
+	// listing after this result
 	Result struct {
-		Val Item
-		Err error
+		Val    Item
+		Err    error
+		Cursor string
 	}
 
 	// Sort is an enum for using different sorting methods on the query
 	Sort int
 
 	// ListOpt provides different options for querying the DB
-	// Pagination can be used if supported by underlying DB
+	// Pagination can be used if supported by underlying DB. If Version is
+	// set, only items at or above that version are returned. Cursor obtained
+	// from a previous Result resumes the listing after that item, in which
+	// case Page is ignored. Cursors are only valid for the same Sort.
+	// IDPrefix, StartID (inclusive) and EndID (exclusive) restrict the
+	// items based on the ID. If Index is set, only the items matching the
+	// IndexQuery are returned. With SortNatural these are ordered by the
+	// index value. IncludeDeleted lists the soft deleted items as well in
+	// the stores implementing SoftDeleter
 	ListOpt struct {
-		Page    int64
-		Limit   int64
-		Sort    Sort
-		Version int64
-		Filter  ItemFilter
+		Page     int64
+		Limit    int64
+		Sort     Sort
+		Version  int64
+		Filter   ItemFilter
+		Cursor   string
+		IDPrefix string
+		StartID  string
+		EndID    string
+		Index    IndexQuery
+
+		IncludeDeleted bool
+	}
+
+	// IndexQuery selects items using the secondary indexes declared by the
+	// Indexable items. If Value is set, only the items with the exact value
+	// are selected, else the ones with values between Start (inclusive) and
+	// End (exclusive). Empty Name disables the query
+	IndexQuery struct {
+		Name  string
+		Value string
+		Start string
+		End   string
 	}
 
 	ItemFilter interface {
@@ -90,6 +133,30 @@ type (
 		GetUpdated() int64
 	}
 
+	// Versioned interface can be implemented by Items to use optimistic
+	// concurrency control. Stores set the version on every write and Update
+	// fails with ErrVersionConflict if the version on the item is not the
+	// latest one
+	Versioned interface {
+		SetVersion(v int64)
+		GetVersion() int64
+	}
+
+	// Indexable interface can be implemented by Items to maintain secondary
+	// indexes on them. Indexes returns the index names and the values for
+	// the item
+	Indexable interface {
+		Indexes() map[string]string
+	}
+
+	// Expirer interface can be implemented by Items which should be removed
+	// from the store after a deadline. GetExpiry returns the deadline as unix
+	// nano timestamp, 0 means the item never expires. Expired items are not
+	// returned on Read or List
+	Expirer interface {
+		GetExpiry() int64
+	}
+
 	// IDSetter interface can be used by the DB to provide new IDs for objects.
 	// If Item supports this, when we Create the new item we can set a unique ID
 	// based on different DB implementations
@@ -97,3 +164,40 @@ type (
 		SetID(string)
 	}
 )
+
+// MatchID checks if the ID satisfies the IDPrefix, StartID and EndID options
+func (o ListOpt) MatchID(id string) bool {
+	return strings.HasPrefix(id, o.IDPrefix) &&
+		id >= o.StartID &&
+		(o.EndID == "" || id < o.EndID)
+}
+
+// Match checks if the index value satisfies the query
+func (q IndexQuery) Match(val string) bool {
+	if q.Value != "" {
+		return val == q.Value
+	}
+	return val >= q.Start && (q.End == "" || val < q.End)
+}
+
+// ItemExpiry returns the expiry of the item if it is an Expirer, else 0
+func ItemExpiry(item Item) int64 {
+	if e, ok := item.(Expirer); ok {
+		return e.GetExpiry()
+	}
+	return 0
+}
+
+// ItemIndexes returns a copy of the indexes of the item if it is Indexable,
+// so the stores can retain them
+func ItemIndexes(item Item) map[string]string {
+	idx, ok := item.(Indexable)
+	if !ok {
+		return nil
+	}
+	vals := make(map[string]string)
+	for name, val := range idx.Indexes() {
+		vals[name] = val
+	}
+	return vals
+}
@@ -62,9 +62,219 @@ func (t *syncStore) List(ctx context.Context, factory gkvstore.Factory, opts gkv
 		defer t.mu.RUnlock()
 
 		for res := range resChan {
-			relayChan <- res
+			select {
+			case <-ctx.Done():
+				return
+			case relayChan <- res:
+			}
 		}
 	}()
 
 	return relayChan, nil
 }
+
+func (t *syncStore) NewTransaction(ctx context.Context) (gkvstore.Txn, error) {
+	txnStore, ok := t.Store.(gkvstore.Transactional)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	txn, err := txnStore.NewTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncTxn{Txn: txn, mu: &t.mu}, nil
+}
+
+// syncTxn only reads the store while staging operations, so the write lock
+// is required only while committing
+type syncTxn struct {
+	gkvstore.Txn
+
+	mu *sync.RWMutex
+}
+
+func (t *syncTxn) Create(ctx context.Context, item gkvstore.Item) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Txn.Create(ctx, item)
+}
+
+func (t *syncTxn) Read(ctx context.Context, item gkvstore.Item) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Txn.Read(ctx, item)
+}
+
+func (t *syncTxn) Update(ctx context.Context, item gkvstore.Item) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Txn.Update(ctx, item)
+}
+
+func (t *syncTxn) Delete(ctx context.Context, item gkvstore.Item) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.Txn.Delete(ctx, item)
+}
+
+func (t *syncTxn) Commit(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.Txn.Commit(ctx)
+}
+
+func (t *syncStore) NewBatch(ctx context.Context) (gkvstore.Batcher, error) {
+	batchStore, ok := t.Store.(gkvstore.Batching)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	b, err := batchStore.NewBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncBatch{Batcher: b, mu: &t.mu}, nil
+}
+
+// syncBatch only queues the operations till Commit, so the lock is acquired
+// once for the whole batch
+type syncBatch struct {
+	gkvstore.Batcher
+
+	mu *sync.RWMutex
+}
+
+func (t *syncBatch) Commit(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.Batcher.Commit(ctx)
+}
+
+func (t *syncStore) Watch(ctx context.Context, factory gkvstore.Factory, opts gkvstore.WatchOpt) (<-chan *gkvstore.Event, error) {
+	watchStore, ok := t.Store.(gkvstore.Watcher)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return watchStore.Watch(ctx, factory, opts)
+}
+
+func (t *syncStore) Count(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (int64, error) {
+	countStore, ok := t.Store.(gkvstore.Counter)
+	if !ok {
+		return 0, gkvstore.ErrNotSupported
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return countStore.Count(ctx, factory, opts)
+}
+
+func (t *syncStore) ListKeys(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.KeyResult, error) {
+	keyStore, ok := t.Store.(gkvstore.KeyLister)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	t.mu.RLock()
+
+	resChan, err := keyStore.ListKeys(ctx, factory, opts)
+	if err != nil {
+		t.mu.RUnlock()
+		return resChan, err
+	}
+
+	relayChan := make(chan *gkvstore.KeyResult)
+	go func() {
+		defer close(relayChan)
+		defer t.mu.RUnlock()
+
+		for res := range resChan {
+			select {
+			case <-ctx.Done():
+				return
+			case relayChan <- res:
+			}
+		}
+	}()
+
+	return relayChan, nil
+}
+
+// Patch holds the write lock while applying the patch, so the generic read,
+// patch and update is atomic if the underlying store doesn't support patches
+func (t *syncStore) Patch(ctx context.Context, item gkvstore.Item, p gkvstore.Patch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return gkvstore.PatchItem(ctx, t.Store, item, p)
+}
+
+// Upsert holds the write lock, so the generic create or update is atomic if
+// the underlying store doesn't support upserts
+func (t *syncStore) Upsert(ctx context.Context, item gkvstore.Item) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return gkvstore.Upsert(ctx, t.Store, item)
+}
+
+func (t *syncStore) ReadMany(ctx context.Context, items []gkvstore.Item) []error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return gkvstore.ReadMany(ctx, t.Store, items)
+}
+
+func (t *syncStore) Features() gkvstore.Features {
+	return gkvstore.GetFeatures(t.Store)
+}
+
+func (t *syncStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return nsStore.ListNamespaces(ctx)
+}
+
+func (t *syncStore) DropNamespace(ctx context.Context, ns string) error {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return nsStore.DropNamespace(ctx, ns)
+}
+
+func (t *syncStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.NamespaceStats{}, gkvstore.ErrNotSupported
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return nsStore.NamespaceStats(ctx, ns)
+}
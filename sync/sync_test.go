@@ -1,8 +1,12 @@
 package syncstore_test
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/plexsysio/gkvstore"
 	"github.com/plexsysio/gkvstore/inmem"
 	"github.com/plexsysio/gkvstore/sync"
 	"github.com/plexsysio/gkvstore/testsuite"
@@ -15,3 +19,63 @@ func TestSuite(t *testing.T) {
 func BenchmarkSuite(b *testing.B) {
 	testsuite.BenchmarkSuite(b, syncstore.New(inmem.New()))
 }
+
+type note struct {
+	Id string
+}
+
+func (n *note) GetNamespace() string { return "note" }
+
+func (n *note) GetID() string { return n.Id }
+
+func (n *note) Marshal() ([]byte, error) { return json.Marshal(n) }
+
+func (n *note) Unmarshal(buf []byte) error { return json.Unmarshal(buf, n) }
+
+// TestListCancel checks the read lock is released if the consumer stops
+// reading and cancels the context
+func TestListCancel(t *testing.T) {
+	st := syncstore.New(inmem.New())
+	defer st.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := st.Create(context.TODO(), &note{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	factory := func() gkvstore.Item { return &note{} }
+	for _, list := range []func(context.Context) error{
+		func(ctx context.Context) error {
+			res, err := st.List(ctx, factory, gkvstore.ListOpt{})
+			if err == nil {
+				<-res
+			}
+			return err
+		},
+		func(ctx context.Context) error {
+			res, err := gkvstore.ListKeys(ctx, st, factory, gkvstore.ListOpt{})
+			if err == nil {
+				<-res
+			}
+			return err
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := list(ctx); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		done := make(chan error, 1)
+		go func() { done <- st.Update(context.TODO(), &note{Id: "1"}) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("write blocked after cancelling the list")
+		}
+	}
+}
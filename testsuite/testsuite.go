@@ -1,10 +1,13 @@
 package testsuite
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -49,46 +52,177 @@ func (t *testStruct) GetCreated() int64 { return t.CreatedAt }
 
 func (t *testStruct) GetUpdated() int64 { return t.UpdatedAt }
 
+type testVersionedStruct struct {
+	testStruct
+	Version int64
+}
+
+func (t *testVersionedStruct) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *testVersionedStruct) Unmarshal(val []byte) error { return json.Unmarshal(val, t) }
+
+func (t *testVersionedStruct) SetVersion(v int64) { t.Version = v }
+
+func (t *testVersionedStruct) GetVersion() int64 { return t.Version }
+
+type testExpiringStruct struct {
+	testStruct
+	Expiry int64
+}
+
+func (t *testExpiringStruct) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *testExpiringStruct) Unmarshal(val []byte) error { return json.Unmarshal(val, t) }
+
+func (t *testExpiringStruct) GetExpiry() int64 { return t.Expiry }
+
+type testExpiringVersionedStruct struct {
+	testExpiringStruct
+	Version int64
+}
+
+func (t *testExpiringVersionedStruct) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *testExpiringVersionedStruct) Unmarshal(val []byte) error { return json.Unmarshal(val, t) }
+
+func (t *testExpiringVersionedStruct) SetVersion(v int64) { t.Version = v }
+
+func (t *testExpiringVersionedStruct) GetVersion() int64 { return t.Version }
+
+type testIndexedStruct struct {
+	testStruct
+	Category string
+	Score    string
+}
+
+func (t *testIndexedStruct) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *testIndexedStruct) Unmarshal(val []byte) error { return json.Unmarshal(val, t) }
+
+func (t *testIndexedStruct) Indexes() map[string]string {
+	return map[string]string{"category": t.Category, "score": t.Score}
+}
+
+type testPatchStruct struct {
+	testStruct
+	Counter int64
+	Labels  map[string]string
+}
+
+func (t *testPatchStruct) Marshal() ([]byte, error) { return json.Marshal(t) }
+
+func (t *testPatchStruct) Unmarshal(val []byte) error { return json.Unmarshal(val, t) }
+
+func (t *testPatchStruct) ApplyPatch(p store.Patch) error {
+	doc, err := jsonDocument(t)
+	if err != nil {
+		return err
+	}
+	if len(p.Fields) > 0 {
+		src, err := jsonDocument(p.Source)
+		if err != nil {
+			return err
+		}
+		doc = store.ApplyFieldMask(doc, src, p.Fields)
+	}
+	if len(p.Merge) > 0 {
+		var patch interface{}
+		if err := json.Unmarshal(p.Merge, &patch); err != nil {
+			return err
+		}
+		doc = store.MergePatch(doc, patch)
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	*t = testPatchStruct{}
+	return json.Unmarshal(buf, t)
+}
+
+func jsonDocument(val interface{}) (interface{}, error) {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return doc, dec.Decode(&doc)
+}
+
+// RunTestsuite runs the tests on the store. Basic suite runs the tests which
+// every store should pass. Advanced suite runs the tests for the features
+// reported by gkvstore.GetFeatures, so the stores which don't describe their
+// features are only tested for the defaults assumed by it
 func RunTestsuite(t *testing.T, impl store.Store, suite Testsuite) {
 	switch suite {
 	case Basic:
 		t.Run("Basic", func(st *testing.T) {
-			st.Run("NilStore", func(st2 *testing.T) {
-				TestCloseStore(st2, impl)
-			})
 			st.Run("CRUD", func(st2 *testing.T) {
 				TestSimpleCRUD(st2, impl)
 			})
 			st.Run("NaturalLIST", func(st2 *testing.T) {
 				TestSortNaturalLIST(st2, impl)
 			})
-		})
-	case Advanced:
-		t.Run("Advanced", func(st *testing.T) {
+			// Stores are not required to be usable after Close, so it is
+			// the last test
 			st.Run("NilStore", func(st2 *testing.T) {
 				TestCloseStore(st2, impl)
 			})
-			st.Run("CRUD", func(st2 *testing.T) {
-				TestSimpleCRUD(st2, impl)
-			})
-			st.Run("NaturalLIST", func(st2 *testing.T) {
-				TestSortNaturalLIST(st2, impl)
-			})
-			st.Run("CreatedAscLIST", func(st2 *testing.T) {
-				TestSortCreatedAscLIST(st2, impl)
-			})
-			st.Run("CreatedDscLIST", func(st2 *testing.T) {
-				TestSortCreatedDscLIST(st2, impl)
-			})
-			st.Run("UpdatedAscLIST", func(st2 *testing.T) {
-				TestSortUpdatedAscLIST(st2, impl)
-			})
-			st.Run("UpdatedDscLIST", func(st2 *testing.T) {
-				TestSortUpdatedDscLIST(st2, impl)
-			})
-			st.Run("FilterLIST", func(st2 *testing.T) {
-				TestFilterLIST(st2, impl)
-			})
+		})
+	case Advanced:
+		f := store.GetFeatures(impl)
+		timeSorts := f.SupportsSort(
+			store.SortCreatedAsc,
+			store.SortCreatedDesc,
+			store.SortUpdatedAsc,
+			store.SortUpdatedDesc,
+		)
+		idSorts := f.SupportsSort(store.SortIDAsc, store.SortIDDesc)
+		t.Run("Advanced", func(st *testing.T) {
+			for _, tc := range []struct {
+				name      string
+				supported bool
+				test      func(*testing.T, store.Store)
+			}{
+				{"CRUD", true, TestSimpleCRUD},
+				{"NaturalLIST", true, TestSortNaturalLIST},
+				{"CreatedAscLIST", f.SupportsSort(store.SortCreatedAsc), TestSortCreatedAscLIST},
+				{"CreatedDscLIST", f.SupportsSort(store.SortCreatedDesc), TestSortCreatedDscLIST},
+				{"UpdatedAscLIST", f.SupportsSort(store.SortUpdatedAsc), TestSortUpdatedAscLIST},
+				{"UpdatedDscLIST", f.SupportsSort(store.SortUpdatedDesc), TestSortUpdatedDscLIST},
+				{"FilterLIST", f.Filter, TestFilterLIST},
+				{"Count", true, TestCount},
+				{"ListKeys", timeSorts, TestListKeys},
+				{"CursorLIST", f.Cursor && timeSorts, TestCursorLIST},
+				{"IDRangeLIST", f.IDRange && f.Cursor && idSorts && timeSorts, TestIDRangeLIST},
+				{"IndexLIST", f.Index && idSorts, TestIndexLIST},
+				{"Versioning", f.Versioning, TestVersioning},
+				{"ConcurrentVersioning", f.Versioning, TestConcurrentVersioning},
+				{"Expiry", f.Expiry && timeSorts, TestExpiry},
+				{"Batch", timeSorts, TestBatch},
+				{"Patch", f.TimeTracker, TestPatch},
+				{"Upsert", f.TimeTracker, TestUpsert},
+				{"ReadMany", true, TestReadMany},
+				{"Errors", true, TestErrors},
+				{"NamespaceCollision", true, TestNamespaceCollision},
+				{"Watch", f.Watch, TestWatch},
+				{"Transaction", f.Transactions, TestTransaction},
+				{"Namespaces", f.Namespaces, TestNamespaces},
+				// Stores are not usable after Close, so these are the last tests
+				{"NilStore", true, TestCloseStore},
+				{"Closed", true, TestClosedStore},
+			} {
+				if !tc.supported {
+					st.Logf("Skipping %s as the store doesn't support it", tc.name)
+					continue
+				}
+				tc := tc
+				st.Run(tc.name, func(st2 *testing.T) {
+					tc.test(st2, impl)
+				})
+			}
 		})
 	}
 }
@@ -103,6 +237,26 @@ func TestCloseStore(t *testing.T, s store.Store) {
 	}
 }
 
+// TestClosedStore checks the operations on a closed store fail with
+// ErrStoreClosed
+func TestClosedStore(t *testing.T, s store.Store) {
+	d := &testStruct{Namespace: "ClosedSpace", Id: uuid.New().String()}
+	for op, fn := range map[string]func() error{
+		"Create": func() error { return s.Create(context.TODO(), d) },
+		"Read":   func() error { return s.Read(context.TODO(), d) },
+		"Update": func() error { return s.Update(context.TODO(), d) },
+		"Delete": func() error { return s.Delete(context.TODO(), d) },
+		"List": func() error {
+			_, err := s.List(context.TODO(), testFactory, store.ListOpt{})
+			return err
+		},
+	} {
+		if err := fn(); !errors.Is(err, store.ErrStoreClosed) {
+			t.Fatal("Expected store closed error on", op, "after close", err)
+		}
+	}
+}
+
 func TestSimpleCRUD(t *testing.T, s store.Store) {
 	// Create new object
 	d := &testStruct{
@@ -364,3 +518,1216 @@ func TestFilterLIST(t *testing.T, s store.Store) {
 		t.Fatalf("Filter should find only 1 entry Found: %d", count)
 	}
 }
+
+func TestTransaction(t *testing.T, s store.Store) {
+	txn, err := s.(store.Transactional).NewTransaction(context.TODO())
+	if errors.Is(err, store.ErrNotSupported) {
+		t.Skip("transactions not supported")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1 := &testStruct{Namespace: "TxnSpace", Id: uuid.New().String(), RandStr: "random 1"}
+	d2 := &testStruct{Namespace: "TxnSpace", Id: uuid.New().String(), RandStr: "random 2"}
+	err = txn.Create(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Create(context.TODO(), d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes should only be visible inside the transaction before commit
+	nd := &testStruct{Namespace: "TxnSpace", Id: d1.Id}
+	err = s.Read(context.TODO(), nd)
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on read before commit")
+	}
+	err = txn.Read(context.TODO(), nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.RandStr != d1.RandStr {
+		t.Fatal("Incorrect contents during read in transaction")
+	}
+	err = txn.Commit(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*testStruct{d1, d2} {
+		nd := &testStruct{Namespace: "TxnSpace", Id: d.Id}
+		err = s.Read(context.TODO(), nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nd.RandStr != d.RandStr {
+			t.Fatal("Incorrect contents during read after commit")
+		}
+	}
+	err = txn.Commit(context.TODO())
+	if !errors.Is(err, store.ErrTxnClosed) {
+		t.Fatal("Expected txn closed error on second commit")
+	}
+
+	// Conflicting create outside the transaction should fail the commit and
+	// none of the other operations should be applied
+	txn, err = s.(store.Transactional).NewTransaction(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d3 := &testStruct{Namespace: "TxnSpace", Id: uuid.New().String(), RandStr: "random 3"}
+	d1.RandStr = "not random 1"
+	err = txn.Update(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Delete(context.TODO(), d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Create(context.TODO(), d3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Read(context.TODO(), &testStruct{Namespace: "TxnSpace", Id: d2.Id})
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on read after delete in transaction")
+	}
+	err = s.Create(context.TODO(), &testStruct{Namespace: "TxnSpace", Id: d3.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Commit(context.TODO())
+	if !errors.Is(err, store.ErrRecordAlreadyExists) {
+		t.Fatal("Expected already exists error on commit", err)
+	}
+	nd = &testStruct{Namespace: "TxnSpace", Id: d1.Id}
+	err = s.Read(context.TODO(), nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.RandStr != "random 1" {
+		t.Fatal("Update applied from failed transaction")
+	}
+	err = s.Read(context.TODO(), &testStruct{Namespace: "TxnSpace", Id: d2.Id})
+	if err != nil {
+		t.Fatal("Delete applied from failed transaction", err)
+	}
+
+	// Discarded transaction should not apply anything
+	txn, err = s.(store.Transactional).NewTransaction(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = txn.Delete(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Discard(context.TODO())
+	err = txn.Commit(context.TODO())
+	if !errors.Is(err, store.ErrTxnClosed) {
+		t.Fatal("Expected txn closed error on commit after discard")
+	}
+	err = s.Read(context.TODO(), &testStruct{Namespace: "TxnSpace", Id: d1.Id})
+	if err != nil {
+		t.Fatal("Delete applied from discarded transaction", err)
+	}
+}
+
+// runNativeAndGeneric runs the test on the store and on a wrapper which only
+// embeds the Store interface. The wrapper hides the optional interfaces, so
+// the generic implementations are used for it. Name of the run is passed to
+// keep the items of the runs apart
+func runNativeAndGeneric(t *testing.T, s store.Store, fn func(*testing.T, store.Store, string)) {
+	for _, tc := range []struct {
+		name string
+		st   store.Store
+	}{
+		{name: "Native", st: s},
+		{name: "Generic", st: struct{ store.Store }{s}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fn(t, tc.st, tc.name)
+		})
+	}
+}
+
+// TestBatch runs the same checks on the native batch implementation of the
+// store and on the generic one
+func TestBatch(t *testing.T, s store.Store) {
+	runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, name string) {
+		testBatch(t, st, "Batch"+name)
+	})
+}
+
+func testBatch(t *testing.T, s store.Store, ns string) {
+	factory := func() store.Item { return &testStruct{Namespace: ns} }
+
+	b, err := store.NewBatch(context.TODO(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []*testStruct{}
+	for i := 0; i < 10; i++ {
+		d := &testStruct{
+			Namespace: ns,
+			Id:        uuid.New().String(),
+			RandStr:   fmt.Sprintf("random %d", i),
+		}
+		err = b.Put(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, d)
+	}
+	err = b.Commit(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range items {
+		nd := &testStruct{Namespace: ns, Id: d.Id}
+		err = s.Read(context.TODO(), nd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nd.RandStr != d.RandStr {
+			t.Fatal("Incorrect contents during read after batch")
+		}
+	}
+
+	b, err = store.NewBatch(context.TODO(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items[0].RandStr = "not random"
+	err = b.Put(context.TODO(), items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Delete(context.TODO(), items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Commit(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Read(context.TODO(), &testStruct{Namespace: ns, Id: items[1].Id})
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on read after batch delete")
+	}
+
+	ds, err := s.List(context.TODO(), factory, store.ListOpt{Sort: store.SortUpdatedDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for v := range ds {
+		if v.Err != nil {
+			t.Fatal(v.Err)
+		}
+		if count == 0 && v.Val.(*testStruct).RandStr != "not random" {
+			t.Fatal("Expected updated item first in UpdatedDesc List")
+		}
+		count++
+	}
+	if count != 9 {
+		t.Fatal("Invalid no of entries", count, "expected 9")
+	}
+}
+
+// TestPatch runs the same checks on the native patch implementation of the
+// store and on the generic one
+func TestPatch(t *testing.T, s store.Store) {
+	runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, name string) {
+		testPatch(t, st, "Patch"+name)
+	})
+}
+
+func testPatch(t *testing.T, s store.Store, ns string) {
+	d := &testPatchStruct{
+		testStruct: testStruct{
+			Namespace: ns,
+			Id:        uuid.New().String(),
+			RandStr:   "random",
+		},
+		Counter: 1,
+		Labels:  map[string]string{"a": "1", "b": "2"},
+	}
+	err := s.Create(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pd := &testPatchStruct{testStruct: testStruct{Namespace: ns, Id: d.Id}}
+	err = store.PatchItem(context.TODO(), s, pd, store.Patch{
+		Merge: []byte(`{"RandStr":"patched","Labels":{"a":null,"c":"3"}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.RandStr != "patched" || pd.Counter != 1 || len(pd.Labels) != 2 ||
+		pd.Labels["b"] != "2" || pd.Labels["c"] != "3" {
+		t.Fatal("Incorrect item after merge patch", pd)
+	}
+	if pd.CreatedAt != d.CreatedAt || pd.UpdatedAt == d.UpdatedAt {
+		t.Fatal("Incorrect timestamps after merge patch")
+	}
+
+	pd = &testPatchStruct{testStruct: testStruct{Namespace: ns, Id: d.Id}}
+	err = store.PatchItem(context.TODO(), s, pd, store.Patch{
+		Fields: []string{"Counter", "Labels.d"},
+		Source: &testPatchStruct{
+			testStruct: testStruct{RandStr: "ignored"},
+			Counter:    5,
+			Labels:     map[string]string{"d": "4", "e": "5"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rd := &testPatchStruct{testStruct: testStruct{Namespace: ns, Id: d.Id}}
+	err = s.Read(context.TODO(), rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.RandStr != "patched" || rd.Counter != 5 || len(rd.Labels) != 3 ||
+		rd.Labels["d"] != "4" {
+		t.Fatal("Incorrect item after field mask patch", rd)
+	}
+
+	err = store.PatchItem(
+		context.TODO(),
+		s,
+		&testPatchStruct{testStruct: testStruct{Namespace: ns, Id: uuid.New().String()}},
+		store.Patch{Merge: []byte(`{"RandStr":"patched"}`)},
+	)
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on patching missing item", err)
+	}
+}
+
+// TestUpsert runs the same checks on the native upsert implementation of the
+// store and on the generic one
+func TestUpsert(t *testing.T, s store.Store) {
+	runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, name string) {
+		testUpsert(t, st, "Upsert"+name)
+	})
+}
+
+func testUpsert(t *testing.T, s store.Store, ns string) {
+	d := &testStruct{
+		Namespace: ns,
+		Id:        uuid.New().String(),
+		RandStr:   "random",
+	}
+	created, err := store.Upsert(context.TODO(), s, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("Expected item to be created on first upsert")
+	}
+	if d.CreatedAt == 0 || d.CreatedAt != d.UpdatedAt {
+		t.Fatal("Incorrect timestamps after create", d.CreatedAt, d.UpdatedAt)
+	}
+	createdAt := d.CreatedAt
+
+	time.Sleep(time.Millisecond)
+
+	d2 := &testStruct{
+		Namespace: ns,
+		Id:        d.Id,
+		RandStr:   "not random",
+	}
+	created, err = store.Upsert(context.TODO(), s, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Fatal("Expected item to be updated on second upsert")
+	}
+
+	rd := &testStruct{Namespace: ns, Id: d.Id}
+	err = s.Read(context.TODO(), rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rd.RandStr != "not random" {
+		t.Fatal("Incorrect contents after upsert")
+	}
+	if rd.CreatedAt != createdAt || rd.UpdatedAt <= createdAt {
+		t.Fatal("Incorrect timestamps after update", rd.CreatedAt, rd.UpdatedAt)
+	}
+}
+
+// TestReadMany runs the same checks on the native multi-get implementation of
+// the store and on the generic one
+func TestReadMany(t *testing.T, s store.Store) {
+	runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, name string) {
+		testReadMany(t, st, "ReadMany"+name)
+	})
+}
+
+func testReadMany(t *testing.T, s store.Store, ns string) {
+	items := []store.Item{}
+	for i := 0; i < 5; i++ {
+		d := &testStruct{
+			Namespace: ns,
+			Id:        uuid.New().String(),
+			RandStr:   fmt.Sprintf("random %d", i),
+		}
+		err := s.Create(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, &testStruct{Namespace: ns, Id: d.Id})
+	}
+	items = append(items, &testStruct{Namespace: ns, Id: uuid.New().String()})
+
+	errs := store.ReadMany(context.TODO(), s, items)
+	if len(errs) != len(items) {
+		t.Fatal("Invalid no of errors", len(errs), "expected", len(items))
+	}
+	for i, err := range errs[:5] {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if items[i].(*testStruct).RandStr != fmt.Sprintf("random %d", i) {
+			t.Fatal("Incorrect contents after read many")
+		}
+	}
+	if !errors.Is(errs[5], store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error for missing item", errs[5])
+	}
+}
+
+func TestNamespaces(t *testing.T, s store.Store) {
+	ns := "NamespaceSpace"
+	nm := s.(store.NamespaceManager)
+
+	for i := 0; i < 3; i++ {
+		err := s.Create(context.TODO(), &testStruct{
+			Namespace: ns,
+			Id:        uuid.New().String(),
+			RandStr:   fmt.Sprintf("random %d", i),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hasNamespace := func() bool {
+		namespaces, err := nm.ListNamespaces(context.TODO())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range namespaces {
+			if n == ns {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasNamespace() {
+		t.Fatal("Expected namespace in the list")
+	}
+
+	stats, err := nm.NamespaceStats(context.TODO(), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Namespace != ns || stats.Items != 3 || stats.Size == 0 || stats.LastUpdated == 0 {
+		t.Fatal("Incorrect namespace stats", stats)
+	}
+
+	err = nm.DropNamespace(context.TODO(), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasNamespace() {
+		t.Fatal("Expected namespace to be removed from the list")
+	}
+	stats, err = nm.NamespaceStats(context.TODO(), ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Items != 0 || stats.Size != 0 {
+		t.Fatal("Expected no items after drop", stats)
+	}
+	count, err := store.Count(context.TODO(), s, func() store.Item {
+		return &testStruct{Namespace: ns}
+	}, store.ListOpt{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatal("Expected no items after drop", count)
+	}
+}
+
+// TestNamespaceCollision checks that the items are kept apart if the
+// namespace and the ID joined with '/' are the same
+func TestNamespaceCollision(t *testing.T, s store.Store) {
+	items := []*testStruct{
+		{Namespace: "CollisionSpace/a", Id: "b", RandStr: "first"},
+		{Namespace: "CollisionSpace", Id: "a/b", RandStr: "second"},
+	}
+	for _, d := range items {
+		if err := s.Create(context.TODO(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, d := range items {
+		r := &testStruct{Namespace: d.Namespace, Id: d.Id}
+		if err := s.Read(context.TODO(), r); err != nil {
+			t.Fatal(err)
+		}
+		if r.RandStr != d.RandStr {
+			t.Fatal("Incorrect item read", d.Namespace, r.RandStr)
+		}
+	}
+
+	err := s.Delete(context.TODO(), items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range items {
+		ds, err := s.List(context.TODO(), func() store.Item {
+			return &testStruct{Namespace: d.Namespace}
+		}, store.ListOpt{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found []string
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			found = append(found, v.Val.(*testStruct).RandStr)
+		}
+		if d == items[0] && len(found) != 0 {
+			t.Fatal("Expected no items after delete", found)
+		}
+		if d == items[1] && (len(found) != 1 || found[0] != d.RandStr) {
+			t.Fatal("Incorrect items listed", found)
+		}
+	}
+	err = s.Read(context.TODO(), &testStruct{Namespace: items[1].Namespace, Id: items[1].Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestErrors checks the sentinel errors returned by the store. If the store
+// adds context to the errors using StoreError, it should match the item
+func TestErrors(t *testing.T, s store.Store) {
+	ns := "ErrorSpace"
+	d := &testStruct{
+		Namespace: ns,
+		Id:        uuid.New().String(),
+	}
+	err := s.Create(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkErr := func(err, target error, op, id string) {
+		t.Helper()
+		if !errors.Is(err, target) {
+			t.Fatalf("Expected error %v found %v", target, err)
+		}
+		var se *store.StoreError
+		if errors.As(err, &se) && (se.Op != op || se.Namespace != ns || se.ID != id) {
+			t.Fatalf("Incorrect error context %s %s %s", se.Op, se.Namespace, se.ID)
+		}
+	}
+
+	err = s.Create(context.TODO(), d)
+	checkErr(err, store.ErrRecordAlreadyExists, "Create", d.Id)
+
+	missingID := uuid.New().String()
+	err = s.Read(context.TODO(), &testStruct{Namespace: ns, Id: missingID})
+	checkErr(err, store.ErrRecordNotFound, "Read", missingID)
+
+	factory := func() store.Item { return &testStruct{Namespace: ns} }
+	ds, err := s.List(context.TODO(), factory, store.ListOpt{Sort: store.Sort(100)})
+	if err == nil {
+		for v := range ds {
+			if v.Err != nil {
+				err = v.Err
+			}
+		}
+	}
+	checkErr(err, store.ErrInvalidSort, "List", "")
+}
+
+func TestVersioning(t *testing.T, s store.Store) {
+	factory := func() store.Item {
+		return &testVersionedStruct{testStruct: testStruct{Namespace: "VersionSpace"}}
+	}
+
+	items := []*testVersionedStruct{}
+	for i := 0; i < 3; i++ {
+		d := &testVersionedStruct{
+			testStruct: testStruct{
+				Namespace: "VersionSpace",
+				Id:        uuid.New().String(),
+				RandStr:   fmt.Sprintf("random %d", i),
+			},
+		}
+		err := s.Create(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Version != 1 {
+			t.Fatal("Incorrect version after create", d.Version)
+		}
+		items = append(items, d)
+	}
+	// Concurrent writer reads the same version and updates first
+	d1 := &testVersionedStruct{testStruct: testStruct{Namespace: "VersionSpace", Id: items[0].Id}}
+	err := s.Read(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d1.RandStr = "first writer"
+	err = s.Update(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d1.Version != 2 {
+		t.Fatal("Incorrect version after update", d1.Version)
+	}
+	items[0].RandStr = "second writer"
+	err = s.Update(context.TODO(), items[0])
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatal("Expected version conflict on stale update", err)
+	}
+	nd := &testVersionedStruct{testStruct: testStruct{Namespace: "VersionSpace", Id: items[0].Id}}
+	err = s.Read(context.TODO(), nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.RandStr != "first writer" || nd.Version != 2 {
+		t.Fatal("Stale update overwrote the item")
+	}
+	// Update after reading the latest version should succeed
+	nd.RandStr = "second writer"
+	err = s.Update(context.TODO(), nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Update(context.TODO(), items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		version int64
+		count   int
+	}{
+		{version: 0, count: 3},
+		{version: 2, count: 2},
+		{version: 3, count: 1},
+		{version: 4, count: 0},
+	} {
+		ds, err := s.List(context.TODO(), factory, store.ListOpt{Version: tc.version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			if v.Val.(*testVersionedStruct).Version < tc.version {
+				t.Fatal("Found older version in List", v.Val.(*testVersionedStruct).Version)
+			}
+			count++
+		}
+		if count != tc.count {
+			t.Fatal("Invalid no of entries", count, "expected", tc.count)
+		}
+	}
+}
+
+// TestConcurrentVersioning updates the same version of an item concurrently,
+// only one of the updates should succeed in each round
+func TestConcurrentVersioning(t *testing.T, s store.Store) {
+	d := &testVersionedStruct{
+		testStruct: testStruct{
+			Namespace: "ConcurrentVersionSpace",
+			Id:        uuid.New().String(),
+		},
+	}
+	err := s.Create(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writers := 32
+	for round := 0; round < 5; round++ {
+		errs := make([]error, writers)
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				w := *d
+				w.RandStr = fmt.Sprintf("writer %d", i)
+				errs[i] = s.Update(context.TODO(), &w)
+			}(i)
+		}
+		wg.Wait()
+
+		winner := -1
+		for i, err := range errs {
+			switch {
+			case err == nil && winner != -1:
+				t.Fatal("Multiple updates of the same version succeeded", round, winner, i)
+			case err == nil:
+				winner = i
+			case !errors.Is(err, store.ErrVersionConflict):
+				t.Fatal(err)
+			}
+		}
+		if winner == -1 {
+			t.Fatal("Expected one of the updates to succeed", round)
+		}
+
+		err = s.Read(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Version != int64(round+2) || d.RandStr != fmt.Sprintf("writer %d", winner) {
+			t.Fatal("Incorrect item after concurrent updates", d.Version, d.RandStr, winner)
+		}
+	}
+}
+
+func TestWatch(t *testing.T, s store.Store) {
+	factory := func() store.Item { return &testStruct{Namespace: "WatchSpace"} }
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	evs, err := s.(store.Watcher).Watch(ctx, factory, store.WatchOpt{})
+	if errors.Is(err, store.ErrNotSupported) {
+		t.Skip("watch not supported")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := s.(store.Watcher).Watch(ctx, factory, store.WatchOpt{
+		Filter: filterRandStr{str: "not random"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &testStruct{Namespace: "WatchSpace", Id: uuid.New().String(), RandStr: "random"}
+	err = s.Create(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes in other namespaces should not be notified
+	err = s.Create(context.TODO(), &testStruct{Namespace: "Other", Id: uuid.New().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.RandStr = "not random"
+	err = s.Update(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Delete(context.TODO(), d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recv := func(evs <-chan *store.Event) *store.Event {
+		select {
+		case ev := <-evs:
+			if ev.Err != nil {
+				t.Fatal(ev.Err)
+			}
+			return ev
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+		return nil
+	}
+	for _, exp := range []struct {
+		typ     store.EventType
+		randStr string
+	}{
+		{typ: store.EventCreated, randStr: "random"},
+		{typ: store.EventUpdated, randStr: "not random"},
+		{typ: store.EventDeleted, randStr: "not random"},
+	} {
+		ev := recv(evs)
+		if ev.Type != exp.typ || ev.Val.GetID() != d.Id || ev.Val.(*testStruct).RandStr != exp.randStr {
+			t.Fatal("Incorrect event", ev.Type, ev.Val)
+		}
+	}
+	for _, typ := range []store.EventType{store.EventUpdated, store.EventDeleted} {
+		ev := recv(filtered)
+		if ev.Type != typ || ev.Val.(*testStruct).RandStr != "not random" {
+			t.Fatal("Incorrect event on filtered watch", ev.Type, ev.Val)
+		}
+	}
+
+	cancel()
+	for _, ch := range []<-chan *store.Event{evs, filtered} {
+		select {
+		case _, more := <-ch:
+			if more {
+				t.Fatal("Unexpected event after cancel")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Watch not closed after cancel")
+		}
+	}
+}
+
+func TestExpiry(t *testing.T, s store.Store) {
+	factory := func() store.Item {
+		return &testExpiringStruct{testStruct: testStruct{Namespace: "ExpirySpace"}}
+	}
+
+	d1 := &testExpiringStruct{
+		testStruct: testStruct{Namespace: "ExpirySpace", Id: uuid.New().String()},
+		Expiry:     time.Now().Add(200 * time.Millisecond).UnixNano(),
+	}
+	d2 := &testExpiringStruct{
+		testStruct: testStruct{Namespace: "ExpirySpace", Id: uuid.New().String()},
+	}
+	for _, d := range []*testExpiringStruct{d1, d2} {
+		err := s.Create(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	versioned := store.GetFeatures(s).Versioning
+	d3 := &testExpiringVersionedStruct{
+		testExpiringStruct: testExpiringStruct{
+			testStruct: testStruct{Namespace: "ExpiryVersionSpace", Id: uuid.New().String()},
+			Expiry:     time.Now().Add(200 * time.Millisecond).UnixNano(),
+		},
+	}
+	if versioned {
+		err := s.Create(context.TODO(), d3)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Read(context.TODO(), factory())
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on read of unknown item")
+	}
+	err = s.Read(context.TODO(), &testExpiringStruct{testStruct: testStruct{Namespace: "ExpirySpace", Id: d1.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	err = s.Read(context.TODO(), &testExpiringStruct{testStruct: testStruct{Namespace: "ExpirySpace", Id: d1.Id}})
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		t.Fatal("Expected not found error on read after expiry")
+	}
+	for _, sort := range []store.Sort{store.SortNatural, store.SortCreatedAsc} {
+		ds, err := s.List(context.TODO(), factory, store.ListOpt{Sort: sort})
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			if v.Val.GetID() != d2.Id {
+				t.Fatal("Found expired item in List")
+			}
+			count++
+		}
+		if count != 1 {
+			t.Fatal("Invalid no of entries", count, "expected 1")
+		}
+	}
+	// Expired item can be created again
+	d1.Expiry = 0
+	err = s.Create(context.TODO(), d1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !versioned {
+		return
+	}
+	// Failed update of an expired item should not leave it in the indexes
+	d3.Expiry, d3.Version = 0, 5
+	err = s.Update(context.TODO(), d3)
+	if !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatal("Expected version conflict on update of expired item", err)
+	}
+	err = s.Create(context.TODO(), d3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := s.List(
+		context.TODO(),
+		func() store.Item {
+			return &testExpiringVersionedStruct{
+				testExpiringStruct: testExpiringStruct{testStruct: testStruct{Namespace: "ExpiryVersionSpace"}},
+			}
+		},
+		store.ListOpt{Sort: store.SortCreatedAsc},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for v := range ds {
+		if v.Err != nil {
+			t.Fatal(v.Err)
+		}
+		count++
+	}
+	if count != 1 {
+		t.Fatal("Invalid no of entries after recreating expired item", count, "expected 1")
+	}
+}
+
+// TestCursorLIST pages through the items using cursors while deleting the
+// items already seen. Cursor should neither skip nor repeat items
+func TestCursorLIST(t *testing.T, s store.Store) {
+	factory := func() store.Item { return &testStruct{Namespace: "CursorSpace"} }
+
+	ids := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		d := &testStruct{
+			Namespace: "CursorSpace",
+			Id:        uuid.New().String(),
+			RandStr:   fmt.Sprintf("random %d", i),
+		}
+		err := s.Create(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[d.Id] = true
+	}
+
+	for _, sort := range []store.Sort{
+		store.SortNatural,
+		store.SortCreatedAsc,
+		store.SortCreatedDesc,
+		store.SortUpdatedAsc,
+		store.SortUpdatedDesc,
+	} {
+		opts := store.ListOpt{Limit: 3, Sort: sort}
+		seen := map[string]bool{}
+		deleted := []*testStruct{}
+		for {
+			ds, err := s.List(context.TODO(), factory, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			for v := range ds {
+				if v.Err != nil {
+					t.Fatal(v.Err)
+				}
+				if v.Cursor == "" {
+					t.Fatal("Cursor not returned in List result")
+				}
+				if seen[v.Val.GetID()] {
+					t.Fatal("Item repeated while using cursor", sort)
+				}
+				seen[v.Val.GetID()] = true
+				opts.Cursor = v.Cursor
+				if count == 0 {
+					deleted = append(deleted, v.Val.(*testStruct))
+				}
+				count++
+			}
+			if count < 3 {
+				break
+			}
+			// Deleting an item already seen should not affect next page
+			err = s.Delete(context.TODO(), deleted[len(deleted)-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(seen) != len(ids) {
+			t.Fatal("Invalid no of entries", len(seen), "expected", len(ids), sort)
+		}
+		for _, d := range deleted[:len(deleted)-1] {
+			err := s.Create(context.TODO(), d)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	_, err := s.List(context.TODO(), factory, store.ListOpt{Sort: store.SortCreatedAsc, Cursor: "invalid"})
+	if !errors.Is(err, store.ErrInvalidCursor) {
+		t.Fatal("Expected invalid cursor error", err)
+	}
+}
+
+// Test uses entries from the previous List test. Count is checked on the
+// native implementation of the store and on the generic one
+func TestCount(t *testing.T, s store.Store) {
+	runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, _ string) {
+		count, err := store.Count(context.TODO(), st, testFactory, store.ListOpt{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 5 {
+			t.Fatal("Invalid count", count, "expected 5")
+		}
+		count, err = store.Count(context.TODO(), st, testFactory, store.ListOpt{
+			Filter: filterRandStr{str: "random 3"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatal("Invalid count with filter", count, "expected 1")
+		}
+	})
+}
+
+// Test uses entries from the previous List test. Keys should be listed in the
+// same order as the items in List
+func TestListKeys(t *testing.T, s store.Store) {
+	for _, sort := range []store.Sort{
+		store.SortNatural,
+		store.SortCreatedAsc,
+		store.SortCreatedDesc,
+		store.SortUpdatedAsc,
+		store.SortUpdatedDesc,
+	} {
+		opts := store.ListOpt{Sort: sort, Limit: 10}
+		ds, err := s.List(context.TODO(), testFactory, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			ids = append(ids, v.Val.GetID())
+		}
+		runNativeAndGeneric(t, s, func(t *testing.T, st store.Store, _ string) {
+			keys, err := store.ListKeys(context.TODO(), st, testFactory, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx := 0
+			for k := range keys {
+				if k.Err != nil {
+					t.Fatal(k.Err)
+				}
+				if idx >= len(ids) || k.Key.ID != ids[idx] || k.Key.Namespace != "StreamSpace" {
+					t.Fatal("Incorrect key in ListKeys", sort, k.Key)
+				}
+				idx++
+			}
+			if idx != len(ids) || idx != 5 {
+				t.Fatal("Invalid no of keys", idx, "expected 5", sort)
+			}
+		})
+	}
+}
+
+func TestIDRangeLIST(t *testing.T, s store.Store) {
+	factory := func() store.Item { return &testStruct{Namespace: "RangeSpace"} }
+
+	for _, id := range []string{"b1", "a2", "c1", "a1", "b2", "a3"} {
+		err := s.Create(context.TODO(), &testStruct{Namespace: "RangeSpace", Id: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts store.ListOpt
+		ids  []string
+	}{
+		{
+			name: "all",
+			opts: store.ListOpt{Sort: store.SortIDAsc},
+			ids:  []string{"a1", "a2", "a3", "b1", "b2", "c1"},
+		},
+		{
+			name: "prefix",
+			opts: store.ListOpt{Sort: store.SortIDAsc, IDPrefix: "a"},
+			ids:  []string{"a1", "a2", "a3"},
+		},
+		{
+			name: "range",
+			opts: store.ListOpt{Sort: store.SortIDAsc, StartID: "a2", EndID: "b2"},
+			ids:  []string{"a2", "a3", "b1"},
+		},
+		{
+			name: "prefix desc",
+			opts: store.ListOpt{Sort: store.SortIDDesc, IDPrefix: "b"},
+			ids:  []string{"b2", "b1"},
+		},
+		{
+			name: "range with prefix",
+			opts: store.ListOpt{Sort: store.SortIDAsc, IDPrefix: "a", StartID: "a2"},
+			ids:  []string{"a2", "a3"},
+		},
+		{
+			name: "range with limit",
+			opts: store.ListOpt{Sort: store.SortIDDesc, StartID: "a3", Limit: 2, Page: 1},
+			ids:  []string{"b1", "a3"},
+		},
+		{
+			name: "created with prefix",
+			opts: store.ListOpt{Sort: store.SortCreatedAsc, IDPrefix: "a"},
+			ids:  []string{"a2", "a1", "a3"},
+		},
+	} {
+		ds, err := s.List(context.TODO(), factory, tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			ids = append(ids, v.Val.GetID())
+		}
+		if strings.Join(ids, ",") != strings.Join(tc.ids, ",") {
+			t.Fatal("Incorrect entries for", tc.name, ids, "expected", tc.ids)
+		}
+	}
+
+	// Page through the range using cursors
+	opts := store.ListOpt{Sort: store.SortIDAsc, StartID: "a2", Limit: 2}
+	ids := []string{}
+	for {
+		ds, err := s.List(context.TODO(), factory, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			ids = append(ids, v.Val.GetID())
+			opts.Cursor = v.Cursor
+			count++
+		}
+		if count < 2 {
+			break
+		}
+	}
+	if strings.Join(ids, ",") != "a2,a3,b1,b2,c1" {
+		t.Fatal("Incorrect entries using cursor", ids)
+	}
+}
+
+func TestIndexLIST(t *testing.T, s store.Store) {
+	factory := func() store.Item {
+		return &testIndexedStruct{testStruct: testStruct{Namespace: "IndexSpace"}}
+	}
+
+	items := map[string]*testIndexedStruct{}
+	for i, v := range []struct {
+		category string
+		score    string
+	}{
+		{category: "fruit", score: "30"},
+		{category: "vegetable", score: "10"},
+		{category: "fruit", score: "20"},
+		{category: "grain", score: "40"},
+		{category: "fruit", score: "10"},
+	} {
+		d := &testIndexedStruct{
+			testStruct: testStruct{Namespace: "IndexSpace", Id: fmt.Sprintf("%d", i)},
+			Category:   v.category,
+			Score:      v.score,
+		}
+		err := s.Create(context.TODO(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items[d.Id] = d
+	}
+
+	check := func(name string, opts store.ListOpt, exp []string) {
+		t.Helper()
+		ds, err := s.List(context.TODO(), factory, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for v := range ds {
+			if v.Err != nil {
+				t.Fatal(v.Err)
+			}
+			ids = append(ids, v.Val.GetID())
+		}
+		if strings.Join(ids, ",") != strings.Join(exp, ",") {
+			t.Fatal("Incorrect entries for", name, ids, "expected", exp)
+		}
+		if opts.Limit != 0 {
+			return
+		}
+		count, err := store.Count(context.TODO(), s, factory, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != int64(len(exp)) {
+			t.Fatal("Incorrect count for", name, count, "expected", len(exp))
+		}
+	}
+
+	check("equal", store.ListOpt{
+		Index: store.IndexQuery{Name: "category", Value: "fruit"},
+	}, []string{"0", "2", "4"})
+	check("range", store.ListOpt{
+		Index: store.IndexQuery{Name: "score", Start: "10", End: "30"},
+	}, []string{"1", "4", "2"})
+	check("open range", store.ListOpt{
+		Index: store.IndexQuery{Name: "score", Start: "30"},
+	}, []string{"0", "3"})
+	check("with sort", store.ListOpt{
+		Sort:  store.SortIDDesc,
+		Index: store.IndexQuery{Name: "category", Value: "fruit"},
+	}, []string{"4", "2", "0"})
+	check("unknown index", store.ListOpt{
+		Index: store.IndexQuery{Name: "unknown", Value: "fruit"},
+	}, []string{})
+
+	// Indexes should be maintained on update and delete
+	items["1"].Category = "fruit"
+	err := s.Update(context.TODO(), items["1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Delete(context.TODO(), items["0"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after update", store.ListOpt{
+		Index: store.IndexQuery{Name: "category", Value: "fruit"},
+	}, []string{"1", "2", "4"})
+	check("with limit", store.ListOpt{
+		Limit: 2,
+		Page:  1,
+		Index: store.IndexQuery{Name: "category", Value: "fruit"},
+	}, []string{"4"})
+}
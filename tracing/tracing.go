@@ -110,3 +110,354 @@ func (t *TracingStore) List(ctx context.Context, factory gkvstore.Factory, opts
 
 	return shadow, nil
 }
+
+func (t *TracingStore) NewTransaction(ctx context.Context) (gkvstore.Txn, error) {
+	txnStore, ok := t.Store.(gkvstore.Transactional)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "Transaction")
+
+	txn, err := txnStore.NewTransaction(context.WithValue(ctx, contextKey{}, span))
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+		span.Finish()
+		return nil, err
+	}
+
+	return &tracingTxn{Txn: txn, span: span}, nil
+}
+
+// tracingTxn uses a single span for the lifetime of the transaction. Individual
+// operations are logged on the span and it is finished on Commit or Discard
+type tracingTxn struct {
+	gkvstore.Txn
+
+	span opentracing.Span
+	done bool
+}
+
+func (t *tracingTxn) logOp(op string, item gkvstore.Item, err error) {
+	fields := []tlog.Field{
+		tlog.String("operation", op),
+		tlog.String("namespace", item.GetNamespace()),
+		tlog.String("id", item.GetID()),
+	}
+	if err != nil {
+		fields = append(fields, tlog.String("error", err.Error()))
+	}
+	t.span.LogFields(fields...)
+}
+
+func (t *tracingTxn) Create(ctx context.Context, item gkvstore.Item) error {
+	err := t.Txn.Create(context.WithValue(ctx, contextKey{}, t.span), item)
+	t.logOp("Create", item, err)
+	return err
+}
+
+func (t *tracingTxn) Read(ctx context.Context, item gkvstore.Item) error {
+	err := t.Txn.Read(context.WithValue(ctx, contextKey{}, t.span), item)
+	t.logOp("Read", item, err)
+	return err
+}
+
+func (t *tracingTxn) Update(ctx context.Context, item gkvstore.Item) error {
+	err := t.Txn.Update(context.WithValue(ctx, contextKey{}, t.span), item)
+	t.logOp("Update", item, err)
+	return err
+}
+
+func (t *tracingTxn) Delete(ctx context.Context, item gkvstore.Item) error {
+	err := t.Txn.Delete(context.WithValue(ctx, contextKey{}, t.span), item)
+	t.logOp("Delete", item, err)
+	return err
+}
+
+func (t *tracingTxn) Commit(ctx context.Context) error {
+	err := t.Txn.Commit(context.WithValue(ctx, contextKey{}, t.span))
+	if err != nil {
+		t.span.LogFields(tlog.String("error", err.Error()))
+	}
+	t.finish()
+	return err
+}
+
+func (t *tracingTxn) Discard(ctx context.Context) {
+	t.Txn.Discard(context.WithValue(ctx, contextKey{}, t.span))
+	t.finish()
+}
+
+func (t *tracingTxn) finish() {
+	if !t.done {
+		t.done = true
+		t.span.Finish()
+	}
+}
+
+func (t *TracingStore) NewBatch(ctx context.Context) (gkvstore.Batcher, error) {
+	batchStore, ok := t.Store.(gkvstore.Batching)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	b, err := batchStore.NewBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracingBatch{Batcher: b, store: t}, nil
+}
+
+// tracingBatch traces the Commit as a single span with the no of operations
+// queued in the batch
+type tracingBatch struct {
+	gkvstore.Batcher
+
+	store *TracingStore
+	puts  int
+	dels  int
+}
+
+func (t *tracingBatch) Put(ctx context.Context, item gkvstore.Item) error {
+	err := t.Batcher.Put(ctx, item)
+	if err == nil {
+		t.puts++
+	}
+	return err
+}
+
+func (t *tracingBatch) Delete(ctx context.Context, item gkvstore.Item) error {
+	err := t.Batcher.Delete(ctx, item)
+	if err == nil {
+		t.dels++
+	}
+	return err
+}
+
+func (t *tracingBatch) Commit(ctx context.Context) error {
+	span := t.store.startSpan(ctx, "Batch")
+	defer span.Finish()
+
+	span.SetTag("puts", t.puts)
+	span.SetTag("deletes", t.dels)
+	t.puts, t.dels = 0, 0
+
+	err := t.Batcher.Commit(context.WithValue(ctx, contextKey{}, span))
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	return err
+}
+
+func (t *TracingStore) Watch(ctx context.Context, factory gkvstore.Factory, opts gkvstore.WatchOpt) (<-chan *gkvstore.Event, error) {
+	watchStore, ok := t.Store.(gkvstore.Watcher)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "Watch")
+
+	res, err := watchStore.Watch(context.WithValue(ctx, contextKey{}, span), factory, opts)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+		span.Finish()
+		return nil, err
+	}
+
+	shadow := make(chan *gkvstore.Event)
+	go func() {
+		defer close(shadow)
+		defer span.Finish()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, more := <-res:
+				if !more {
+					return
+				}
+				if ev.Err != nil {
+					span.LogFields(tlog.String("error", ev.Err.Error()))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case shadow <- ev:
+				}
+			}
+		}
+	}()
+
+	return shadow, nil
+}
+
+func (t *TracingStore) Count(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (int64, error) {
+	countStore, ok := t.Store.(gkvstore.Counter)
+	if !ok {
+		return 0, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "Count")
+	defer span.Finish()
+
+	count, err := countStore.Count(context.WithValue(ctx, contextKey{}, span), factory, opts)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	span.SetTag("count", count)
+	return count, err
+}
+
+func (t *TracingStore) ListKeys(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.KeyResult, error) {
+	keyStore, ok := t.Store.(gkvstore.KeyLister)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "ListKeys")
+
+	res, err := keyStore.ListKeys(context.WithValue(ctx, contextKey{}, span), factory, opts)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+		span.Finish()
+		return nil, err
+	}
+
+	shadow := make(chan *gkvstore.KeyResult)
+	go func() {
+		defer span.Finish()
+		defer close(shadow)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case r, more := <-res:
+				if !more {
+					return
+				}
+				if r.Err != nil {
+					span.LogFields(tlog.String("error", r.Err.Error()))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case shadow <- r:
+				}
+			}
+		}
+	}()
+
+	return shadow, nil
+}
+
+func (t *TracingStore) Patch(ctx context.Context, item gkvstore.Item, p gkvstore.Patch) error {
+	patchStore, ok := t.Store.(gkvstore.Patcher)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "Patch")
+	defer span.Finish()
+
+	span.SetTag("fields", len(p.Fields))
+	err := patchStore.Patch(context.WithValue(ctx, contextKey{}, span), item, p)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	return err
+}
+
+func (t *TracingStore) Upsert(ctx context.Context, item gkvstore.Item) (bool, error) {
+	upsertStore, ok := t.Store.(gkvstore.Upserter)
+	if !ok {
+		return false, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "Upsert")
+	defer span.Finish()
+
+	created, err := upsertStore.Upsert(context.WithValue(ctx, contextKey{}, span), item)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	span.SetTag("created", created)
+	return created, err
+}
+
+// ReadMany uses a single span for all the items even if the underlying store
+// reads them one by one
+func (t *TracingStore) ReadMany(ctx context.Context, items []gkvstore.Item) []error {
+	span := t.startSpan(ctx, "ReadMany")
+	defer span.Finish()
+
+	span.SetTag("items", len(items))
+	errs := gkvstore.ReadMany(context.WithValue(ctx, contextKey{}, span), t.Store, items)
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		span.LogFields(tlog.Int("failed", failed))
+	}
+	return errs
+}
+
+func (t *TracingStore) Features() gkvstore.Features {
+	return gkvstore.GetFeatures(t.Store)
+}
+
+func (t *TracingStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return nil, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "ListNamespaces")
+	defer span.Finish()
+
+	namespaces, err := nsStore.ListNamespaces(context.WithValue(ctx, contextKey{}, span))
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	span.SetTag("namespaces", len(namespaces))
+	return namespaces, err
+}
+
+func (t *TracingStore) DropNamespace(ctx context.Context, ns string) error {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "DropNamespace")
+	defer span.Finish()
+
+	span.SetTag("namespace", ns)
+	err := nsStore.DropNamespace(context.WithValue(ctx, contextKey{}, span), ns)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	return err
+}
+
+func (t *TracingStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	nsStore, ok := t.Store.(gkvstore.NamespaceManager)
+	if !ok {
+		return gkvstore.NamespaceStats{}, gkvstore.ErrNotSupported
+	}
+
+	span := t.startSpan(ctx, "NamespaceStats")
+	defer span.Finish()
+
+	span.SetTag("namespace", ns)
+	stats, err := nsStore.NamespaceStats(context.WithValue(ctx, contextKey{}, span), ns)
+	if err != nil {
+		span.LogFields(tlog.String("error", err.Error()))
+	}
+	return stats, err
+}
@@ -1,9 +1,16 @@
 package tracing_test
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/plexsysio/gkvstore"
+	"github.com/plexsysio/gkvstore/autoencoding"
 	"github.com/plexsysio/gkvstore/inmem"
 	"github.com/plexsysio/gkvstore/testsuite"
 	"github.com/plexsysio/gkvstore/tracing"
@@ -11,45 +18,447 @@ import (
 
 func TestSuite(t *testing.T) {
 	tracer := mocktracer.New()
-	inmemStore := inmem.New()
+	inmemStore := &countingStore{Store: inmem.New(), calls: make(map[string]int)}
 
 	testsuite.RunTestsuite(t, tracing.NewTracingStore(inmemStore, tracer), testsuite.Advanced)
 
-	// Following values are based on the testsuite operations
-	if len(tracer.FinishedSpans()) != 24 {
-		t.Fatal("incorrect no of spans")
-	}
-	create, read, update, deleteC, list := 0, 0, 0, 0, 0
-	for _, v := range tracer.FinishedSpans() {
-		if v.OperationName == "Create" {
-			create++
+	// Every call to the underlying store should have exactly one span. Spans
+	// of the streaming operations are finished asynchronously
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		spans := make(map[string]int)
+		for _, v := range tracer.FinishedSpans() {
+			spans[v.OperationName]++
 		}
-		if v.OperationName == "Read" {
-			read++
+		calls := inmemStore.counts()
+		if fmt.Sprint(spans) == fmt.Sprint(calls) {
+			break
 		}
-		if v.OperationName == "Update" {
-			update++
+		if time.Now().After(deadline) {
+			t.Fatal("incorrect no of spans", spans, "expected", calls)
 		}
-		if v.OperationName == "Delete" {
-			deleteC++
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// countingStore counts the calls to the store for each traced operation
+type countingStore struct {
+	gkvstore.Store
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingStore) count(op string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls[op]++
+}
+
+func (c *countingStore) counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	calls := make(map[string]int)
+	for k, v := range c.calls {
+		calls[k] = v
+	}
+	return calls
+}
+
+func (c *countingStore) Create(ctx context.Context, item gkvstore.Item) error {
+	c.count("Create")
+	return c.Store.Create(ctx, item)
+}
+
+func (c *countingStore) Read(ctx context.Context, item gkvstore.Item) error {
+	c.count("Read")
+	return c.Store.Read(ctx, item)
+}
+
+func (c *countingStore) Update(ctx context.Context, item gkvstore.Item) error {
+	c.count("Update")
+	return c.Store.Update(ctx, item)
+}
+
+func (c *countingStore) Delete(ctx context.Context, item gkvstore.Item) error {
+	c.count("Delete")
+	return c.Store.Delete(ctx, item)
+}
+
+func (c *countingStore) List(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.Result, error) {
+	c.count("List")
+	return c.Store.List(ctx, factory, opts)
+}
+
+func (c *countingStore) NewTransaction(ctx context.Context) (gkvstore.Txn, error) {
+	c.count("Transaction")
+	return c.Store.(gkvstore.Transactional).NewTransaction(ctx)
+}
+
+func (c *countingStore) NewBatch(ctx context.Context) (gkvstore.Batcher, error) {
+	b, err := c.Store.(gkvstore.Batching).NewBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countingBatch{Batcher: b, store: c}, nil
+}
+
+// countingBatch counts the Commits as the batches are traced on Commit
+type countingBatch struct {
+	gkvstore.Batcher
+
+	store *countingStore
+}
+
+func (b *countingBatch) Commit(ctx context.Context) error {
+	b.store.count("Batch")
+	return b.Batcher.Commit(ctx)
+}
+
+func (c *countingStore) Watch(ctx context.Context, factory gkvstore.Factory, opts gkvstore.WatchOpt) (<-chan *gkvstore.Event, error) {
+	c.count("Watch")
+	return c.Store.(gkvstore.Watcher).Watch(ctx, factory, opts)
+}
+
+func (c *countingStore) Count(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (int64, error) {
+	c.count("Count")
+	return c.Store.(gkvstore.Counter).Count(ctx, factory, opts)
+}
+
+func (c *countingStore) ListKeys(ctx context.Context, factory gkvstore.Factory, opts gkvstore.ListOpt) (<-chan *gkvstore.KeyResult, error) {
+	c.count("ListKeys")
+	return c.Store.(gkvstore.KeyLister).ListKeys(ctx, factory, opts)
+}
+
+func (c *countingStore) Patch(ctx context.Context, item gkvstore.Item, p gkvstore.Patch) error {
+	c.count("Patch")
+	return c.Store.(gkvstore.Patcher).Patch(ctx, item, p)
+}
+
+func (c *countingStore) Upsert(ctx context.Context, item gkvstore.Item) (bool, error) {
+	c.count("Upsert")
+	return c.Store.(gkvstore.Upserter).Upsert(ctx, item)
+}
+
+func (c *countingStore) ReadMany(ctx context.Context, items []gkvstore.Item) []error {
+	c.count("ReadMany")
+	return c.Store.(gkvstore.MultiReader).ReadMany(ctx, items)
+}
+
+func (c *countingStore) Features() gkvstore.Features {
+	return gkvstore.GetFeatures(c.Store)
+}
+
+func (c *countingStore) ListNamespaces(ctx context.Context) ([]string, error) {
+	c.count("ListNamespaces")
+	return c.Store.(gkvstore.NamespaceManager).ListNamespaces(ctx)
+}
+
+func (c *countingStore) DropNamespace(ctx context.Context, ns string) error {
+	c.count("DropNamespace")
+	return c.Store.(gkvstore.NamespaceManager).DropNamespace(ctx, ns)
+}
+
+func (c *countingStore) NamespaceStats(ctx context.Context, ns string) (gkvstore.NamespaceStats, error) {
+	c.count("NamespaceStats")
+	return c.Store.(gkvstore.NamespaceManager).NamespaceStats(ctx, ns)
+}
+
+type document struct {
+	Id      string
+	Text    string
+	Created int64
+	Updated int64
+}
+
+func newDoc(id string) gkvstore.Item {
+	return autoencoding.MustNew(&document{Id: id, Text: "text " + id})
+}
+
+func docFactory() gkvstore.Item { return autoencoding.MustNew(&document{}) }
+
+// span waits for the span of the operation to be finished. Spans of the
+// streaming operations are finished after the channel is closed
+func span(t *testing.T, tracer *mocktracer.MockTracer, op string) *mocktracer.MockSpan {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		spans := tracer.FinishedSpans()
+		if len(spans) > 1 {
+			t.Fatal("expected single span", len(spans))
 		}
-		if v.OperationName == "List" {
-			list++
+		if len(spans) == 1 {
+			if spans[0].OperationName != op {
+				t.Fatal("incorrect span", spans[0].OperationName, "expected", op)
+			}
+			return spans[0]
 		}
+		if time.Now().After(deadline) {
+			t.Fatal("span not finished", op)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if create != 11 {
-		t.Fatal("create count incorrect", create)
-	}
-	if read != 3 {
-		t.Fatal("read count incorrect", read)
+}
+
+// logged returns the values of the field in the logs of the span
+func logged(sp *mocktracer.MockSpan, key string) []string {
+	var vals []string
+	for _, l := range sp.Logs() {
+		for _, f := range l.Fields {
+			if f.Key == key {
+				vals = append(vals, f.ValueString)
+			}
+		}
 	}
-	if update != 1 {
-		t.Fatal("update count incorrect", update)
+	return vals
+}
+
+func drain(t *testing.T, ch <-chan *gkvstore.Result, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
 	}
-	if deleteC != 1 {
-		t.Fatal("delete count incorrect", deleteC)
+	for range ch {
 	}
-	if list != 8 {
-		t.Fatal("list count incorrect", list)
+}
+
+func TestSpans(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		op   string
+		run  func(*testing.T, gkvstore.Store)
+		tags map[string]interface{}
+		logs map[string][]string
+		err  error
+	}{
+		{
+			name: "Create",
+			op:   "Create",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.Create(context.TODO(), newDoc("2")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "CreateError",
+			op:   "Create",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.Create(context.TODO(), newDoc("1")); err == nil {
+					t.Fatal("expected error on duplicate create")
+				}
+			},
+			err: gkvstore.ErrRecordAlreadyExists,
+		},
+		{
+			name: "Read",
+			op:   "Read",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.Read(context.TODO(), newDoc("1")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "Update",
+			op:   "Update",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.Update(context.TODO(), newDoc("1")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "Delete",
+			op:   "Delete",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.Delete(context.TODO(), newDoc("1")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "List",
+			op:   "List",
+			run: func(t *testing.T, st gkvstore.Store) {
+				res, err := st.List(context.TODO(), docFactory, gkvstore.ListOpt{})
+				drain(t, res, err)
+			},
+		},
+		{
+			name: "Transaction",
+			op:   "Transaction",
+			run: func(t *testing.T, st gkvstore.Store) {
+				txn, err := st.(gkvstore.Transactional).NewTransaction(context.TODO())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := txn.Create(context.TODO(), newDoc("2")); err != nil {
+					t.Fatal(err)
+				}
+				if err := txn.Commit(context.TODO()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			logs: map[string][]string{
+				"operation": {"Create"},
+				"namespace": {"document"},
+				"id":        {"2"},
+			},
+		},
+		{
+			name: "Batch",
+			op:   "Batch",
+			run: func(t *testing.T, st gkvstore.Store) {
+				b, err := gkvstore.NewBatch(context.TODO(), st)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, err := range []error{
+					b.Put(context.TODO(), newDoc("2")),
+					b.Put(context.TODO(), newDoc("3")),
+					b.Delete(context.TODO(), newDoc("1")),
+					b.Commit(context.TODO()),
+				} {
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			tags: map[string]interface{}{"puts": 2, "deletes": 1},
+		},
+		{
+			name: "Watch",
+			op:   "Watch",
+			run: func(t *testing.T, st gkvstore.Store) {
+				ctx, cancel := context.WithCancel(context.Background())
+				_, err := st.(gkvstore.Watcher).Watch(ctx, docFactory, gkvstore.WatchOpt{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+			},
+		},
+		{
+			name: "Count",
+			op:   "Count",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if _, err := gkvstore.Count(context.TODO(), st, docFactory, gkvstore.ListOpt{}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"count": int64(1)},
+		},
+		{
+			name: "ListKeys",
+			op:   "ListKeys",
+			run: func(t *testing.T, st gkvstore.Store) {
+				res, err := gkvstore.ListKeys(context.TODO(), st, docFactory, gkvstore.ListOpt{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for range res {
+				}
+			},
+		},
+		{
+			name: "Patch",
+			op:   "Patch",
+			run: func(t *testing.T, st gkvstore.Store) {
+				err := gkvstore.PatchItem(context.TODO(), st, newDoc("1"), gkvstore.Patch{
+					Merge: []byte(`{"Text":"patched"}`),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"fields": 0},
+		},
+		{
+			name: "Upsert",
+			op:   "Upsert",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if _, err := gkvstore.Upsert(context.TODO(), st, newDoc("2")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"created": true},
+		},
+		{
+			name: "ReadMany",
+			op:   "ReadMany",
+			run: func(t *testing.T, st gkvstore.Store) {
+				gkvstore.ReadMany(context.TODO(), st, []gkvstore.Item{newDoc("1"), newDoc("2")})
+			},
+			tags: map[string]interface{}{"items": 2},
+			logs: map[string][]string{"failed": {"1"}},
+		},
+		{
+			name: "ListNamespaces",
+			op:   "ListNamespaces",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if _, err := st.(gkvstore.NamespaceManager).ListNamespaces(context.TODO()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"namespaces": 1},
+		},
+		{
+			name: "DropNamespace",
+			op:   "DropNamespace",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if err := st.(gkvstore.NamespaceManager).DropNamespace(context.TODO(), "document"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"namespace": "document"},
+		},
+		{
+			name: "NamespaceStats",
+			op:   "NamespaceStats",
+			run: func(t *testing.T, st gkvstore.Store) {
+				if _, err := st.(gkvstore.NamespaceManager).NamespaceStats(context.TODO(), "document"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			tags: map[string]interface{}{"namespace": "document"},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			inmemStore := inmem.New()
+			defer inmemStore.Close()
+
+			// Every case starts with a single item which is not traced
+			if err := inmemStore.Create(context.TODO(), newDoc("1")); err != nil {
+				t.Fatal(err)
+			}
+
+			tracer := mocktracer.New()
+			tc.run(t, tracing.NewTracingStore(inmemStore, tracer))
+
+			sp := span(t, tracer, tc.op)
+			for k, v := range tc.tags {
+				if sp.Tag(k) != v {
+					t.Fatal("incorrect tag", k, sp.Tag(k), "expected", v)
+				}
+			}
+			for k, v := range tc.logs {
+				if fmt.Sprint(logged(sp, k)) != fmt.Sprint(v) {
+					t.Fatal("incorrect logs", k, logged(sp, k), "expected", v)
+				}
+			}
+			errs := logged(sp, "error")
+			switch {
+			case tc.err == nil && len(errs) != 0:
+				t.Fatal("unexpected error logged", errs)
+			case tc.err != nil && (len(errs) != 1 || !strings.HasSuffix(errs[0], tc.err.Error())):
+				t.Fatal("incorrect error logged", errs, "expected", tc.err)
+			}
+		})
 	}
 }
@@ -0,0 +1,26 @@
+package gkvstore
+
+import "context"
+
+type (
+	// Transactional interface can be implemented by stores which support
+	// applying multiple operations atomically. Wrappers which implement this
+	// interface return ErrNotSupported if the underlying store does not
+	Transactional interface {
+		NewTransaction(context.Context) (Txn, error)
+	}
+
+	// Txn is a group of operations which are applied all-or-nothing on Commit.
+	// Reads inside the transaction see the writes done earlier in the same
+	// transaction. Discard can be called multiple times and is a no-op after
+	// Commit
+	Txn interface {
+		Create(context.Context, Item) error
+		Read(context.Context, Item) error
+		Update(context.Context, Item) error
+		Delete(context.Context, Item) error
+
+		Commit(context.Context) error
+		Discard(context.Context)
+	}
+)
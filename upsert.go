@@ -0,0 +1,30 @@
+package gkvstore
+
+import (
+	"context"
+	"errors"
+)
+
+// Upserter interface can be implemented by stores which can create or update
+// the item in a single operation. It returns true if the item was created.
+// TimeTracker items keep the Created timestamp of the existing record
+type Upserter interface {
+	Upsert(context.Context, Item) (bool, error)
+}
+
+// Upsert uses the Upserter implementation if the store supports it, else it
+// tries to Create the item and Updates it if it already exists
+func Upsert(ctx context.Context, st Store, item Item) (bool, error) {
+	if us, ok := st.(Upserter); ok {
+		created, err := us.Upsert(ctx, item)
+		if !errors.Is(err, ErrNotSupported) {
+			return created, err
+		}
+	}
+
+	err := st.Create(ctx, item)
+	if !errors.Is(err, ErrRecordAlreadyExists) {
+		return err == nil, err
+	}
+	return false, st.Update(ctx, item)
+}
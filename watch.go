@@ -0,0 +1,40 @@
+package gkvstore
+
+import "context"
+
+const (
+	// EventCreated item was created
+	EventCreated EventType = iota
+	// EventUpdated item was updated
+	EventUpdated
+	// EventDeleted item was deleted. Event contains the last value of the item
+	EventDeleted
+)
+
+type (
+	// Watcher interface can be implemented by stores which can notify clients
+	// about changes in a namespace. The namespace is obtained from the Factory
+	// which is also used to construct the items in the events. The channel is
+	// closed once the context is cancelled or the store is closed. Stores can
+	// end the watch with an ErrWatchOverflow event if the consumer falls
+	// behind, in which case the changes have to be listed again
+	Watcher interface {
+		Watch(context.Context, Factory, WatchOpt) (<-chan *Event, error)
+	}
+
+	// EventType is an enum for the different changes on items
+	EventType int
+
+	// Event contains a single change in the watched namespace
+	Event struct {
+		Type EventType
+		Val  Item
+		Err  error
+	}
+
+	// WatchOpt provides different options for watching a namespace. If Filter
+	// is set, only events for items matching it are returned
+	WatchOpt struct {
+		Filter ItemFilter
+	}
+)